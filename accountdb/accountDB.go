@@ -11,7 +11,6 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"go.uber.org/zap"
 )
@@ -20,6 +19,7 @@ type AccountDB struct {
 	config *conf.Config
 
 	client    *mongo.Client
+	release   func(ctx context.Context) error
 	ColAssets *mongo.Collection
 
 	start chan struct{}
@@ -35,7 +35,8 @@ type AccountDBInterface interface {
 	BsonForUpdateAccountAsset(chainId string, account string, asset *account.Asset) (bson.M, bson.M)
 	BsonForUpdateAccountAssets(chainId string, account string, assets []*account.Asset) *[]mongo.WriteModel
 	BsonForUpdateAccountAssetUse(tradeType account.TradeType, chainId *string, account *string, asset *string, amount *primitive.Decimal128, count int64) (bson.M, bson.A)
-	BsonForUpdateAccountOrder(tradeType account.TradeType, chainId *string, account *string, asset *string, amount, leverage *primitive.Decimal128, count int64) (bson.M, bson.A)
+	BsonForUpdateAccountOrder(tradeType account.TradeType, chainId *string, account *string, asset *string, amount *primitive.Decimal128, count int64) (bson.M, bson.A)
+	BsonForUpdateAccountOrderWithLeverage(tradeType account.TradeType, chainId *string, account *string, asset *string, amount, leverage *primitive.Decimal128, count int64) (bson.M, bson.A)
 	BsonForUpdateAccountPosition(asset *account.Asset) (bson.M, bson.M)
 
 	// calculate
@@ -60,32 +61,40 @@ type AccountDBInterface interface {
 	TransferPosition(tradeType account.TradeType, chainId *string, event *market.EventTransferPosition, value *primitive.Decimal128) error
 
 	Start() error
+	Close(ctx context.Context) error
 }
 
-func NewDB(config *conf.Config) (commondatabase.IRepository, error) {
-	r := &AccountDB{
-		config: config,
-		start:  make(chan struct{}),
-	}
+var _ AccountDBInterface = (*AccountDB)(nil)
 
-	var err error
-	credential := options.Credential{
-		Username: r.config.Repositories["accountDB"]["username"].(string),
-		Password: r.config.Repositories["accountDB"]["pass"].(string),
+// NewDB connects a client of its own for [Repositories.accountDB], which Close
+// disconnects.
+func NewDB(config *conf.Config) (commondatabase.IRepository, error) {
+	client, err := config.Connect(context.Background(), "accountDB")
+	if err != nil {
+		return nil, err
 	}
 
-	clientOptions := options.Client().ApplyURI(config.Repositories["accountDB"]["datasource"].(string)).SetAuth(credential)
-	if r.client, err = mongo.Connect(context.Background(), clientOptions); err != nil {
+	r, err := NewDBWithClient(config, client, client.Disconnect)
+	if err != nil {
+		client.Disconnect(context.Background())
 		return nil, err
 	}
+	return r, nil
+}
 
-	if err = r.client.Ping(context.Background(), nil); err == nil {
-		db := r.client.Database(config.Repositories["accountDB"]["db"].(string))
-		r.ColAssets = db.Collection("assets")
-	} else {
-		return nil, err
+// NewDBWithClient builds the repository on a client shared with other
+// repositories. Close calls release instead of disconnecting the client.
+func NewDBWithClient(config *conf.Config, client *mongo.Client, release func(ctx context.Context) error) (commondatabase.IRepository, error) {
+	r := &AccountDB{
+		config:  config,
+		client:  client,
+		release: release,
+		start:   make(chan struct{}),
 	}
 
+	db := r.client.Database(config.Repositories["accountDB"].DB, config.Repositories["accountDB"].DatabaseOptions())
+	r.ColAssets = db.Collection("assets")
+
 	commonlog.Logger.Debug("load repository",
 		zap.String("accountDB", r.config.Common.ServiceId),
 	)
@@ -103,3 +112,14 @@ func (e *AccountDB) Start() error {
 		return
 	}()
 }
+
+// Close releases the client of the repository.
+func (e *AccountDB) Close(ctx context.Context) error {
+	return e.release(ctx)
+}
+
+// collection returns col tuned for an operation class of
+// [Repositories.accountDB.operations] and the context to run the operation with.
+func (a *AccountDB) collection(col *mongo.Collection, class string) (*mongo.Collection, context.Context, context.CancelFunc) {
+	return a.config.Repositories["accountDB"].Collection(col, class)
+}
@@ -1,9 +1,9 @@
 ﻿package accountdb
 
 import (
-	"context"
 	"errors"
 
+	"github.com/coinmeca/db-connector/conf"
 	"github.com/coinmeca/go-common/commonlog"
 	"github.com/coinmeca/go-common/commonmethod/account"
 	"go.mongodb.org/mongo-driver/bson"
@@ -21,8 +21,10 @@ func (a *AccountDB) GetAccountAsset(chainId, user, asset *string) *account.Asset
 		"address": *asset,
 	}
 
-	err := a.ColAssets.FindOne(
-		context.Background(),
+	col, ctx, cancel := a.collection(a.ColAssets, conf.OpBalanceRead)
+	defer cancel()
+	err := col.FindOne(
+		ctx,
 		filter,
 	).Decode(result)
 	if err != nil {
@@ -39,16 +41,18 @@ func (a *AccountDB) GetAccountAssets(chainId, user *string, assets *[]*string) [
 	filter := a.BsonForGetAccountAssets(*chainId, *user, assets)
 
 	var result []*account.Asset
-	cursor, err := a.ColAssets.Find(context.Background(), filter)
+	col, ctx, cancel := a.collection(a.ColAssets, conf.OpBalanceRead)
+	defer cancel()
+	cursor, err := col.Find(ctx, filter)
 	if err != nil {
 		commonlog.Logger.Error("GetAccountAssets",
 			zap.String("Find", err.Error()),
 		)
 		return result
 	}
-	defer cursor.Close(context.Background())
+	defer cursor.Close(ctx)
 
-	for cursor.Next(context.Background()) {
+	for cursor.Next(ctx) {
 		var a *account.Asset
 		if err := cursor.Decode(&result); err == nil {
 			result = append(result, a)
@@ -93,7 +97,9 @@ func (a *AccountDB) UpdateAccountAssets(chainId, user string, assets *[]account.
 
 	// BulkUpdate
 	models := a.BsonForUpdateAccountAssets(chainId, user, assetlist)
-	_, err := a.ColAssets.BulkWrite(context.Background(), *models)
+	col, ctx, cancel := a.collection(a.ColAssets, conf.OpBalanceWrite)
+	defer cancel()
+	_, err := col.BulkWrite(ctx, *models)
 	if err != nil {
 		commonlog.Logger.Error("UpdateAccountAssets",
 			zap.String("GetAccountAssets", err.Error()),
@@ -121,8 +127,10 @@ func (a *AccountDB) UpdateAccountAsset(
 	filter, update := a.BsonForUpdateAccountAsset(*chainId, *user, asset)
 	option := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
 
-	err := a.ColAssets.FindOneAndUpdate(
-		context.Background(),
+	col, ctx, cancel := a.collection(a.ColAssets, conf.OpBalanceWrite)
+	defer cancel()
+	err := col.FindOneAndUpdate(
+		ctx,
 		filter,
 		update,
 		option,
@@ -1,8 +1,7 @@
 ﻿package accountdb
 
 import (
-	"context"
-
+	"github.com/coinmeca/db-connector/conf"
 	"github.com/coinmeca/go-common/commonlog"
 	"github.com/coinmeca/go-common/commonmethod/account"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -19,8 +18,10 @@ func (a *AccountDB) UpdateAccountOrder(
 	filter, update := a.BsonForUpdateAccountOrder(tradeType, chainId, user, asset, amount, count)
 	option := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
 
-	err := a.ColAssets.FindOneAndUpdate(
-		context.Background(),
+	col, ctx, cancel := a.collection(a.ColAssets, conf.OpBalanceWrite)
+	defer cancel()
+	err := col.FindOneAndUpdate(
+		ctx,
 		filter,
 		update,
 		option,
@@ -44,8 +45,10 @@ func (a *AccountDB) UpdateAccountOrderWithLeverage(
 	filter, update := a.BsonForUpdateAccountOrderWithLeverage(tradeType, chainId, user, asset, amount, leverage, count)
 	option := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
 
-	err := a.ColAssets.FindOneAndUpdate(
-		context.Background(),
+	col, ctx, cancel := a.collection(a.ColAssets, conf.OpBalanceWrite)
+	defer cancel()
+	err := col.FindOneAndUpdate(
+		ctx,
 		filter,
 		update,
 		option,
@@ -69,8 +72,10 @@ func (a *AccountDB) UpdateAccountAssetUse(
 	filter, update := a.BsonForUpdateAccountAssetUse(tradeType, chainId, user, asset, amount, count)
 	option := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
 
-	err := a.ColAssets.FindOneAndUpdate(
-		context.Background(),
+	col, ctx, cancel := a.collection(a.ColAssets, conf.OpBalanceWrite)
+	defer cancel()
+	err := col.FindOneAndUpdate(
+		ctx,
 		filter,
 		update,
 		option,
@@ -1,9 +1,9 @@
 ﻿package accountdb
 
 import (
-	"context"
 	"log"
 
+	"github.com/coinmeca/db-connector/conf"
 	"github.com/coinmeca/go-common/commonlog"
 	"github.com/coinmeca/go-common/commonmethod/account"
 	"go.mongodb.org/mongo-driver/bson"
@@ -20,8 +20,10 @@ func (a *AccountDB) GetAccountPosition(chainId, user, pay, item *string) *accoun
 	filter, projection := a.BsonForGetAccountPosition(chainId, user, pay, item)
 
 	option := options.FindOne().SetProjection(projection)
-	err := a.ColAssets.FindOne(
-		context.Background(),
+	col, ctx, cancel := a.collection(a.ColAssets, conf.OpBalanceRead)
+	defer cancel()
+	err := col.FindOne(
+		ctx,
 		filter,
 		option,
 	).Decode(&result)
@@ -49,8 +51,10 @@ func (a *AccountDB) GetAccountPositions(chainId, user, asset *string) *[]account
 	filter, projection := a.BsonForGetAccountPositions(chainId, user, asset)
 
 	option := options.FindOne().SetProjection(projection)
-	err := a.ColAssets.FindOne(
-		context.Background(),
+	col, ctx, cancel := a.collection(a.ColAssets, conf.OpBalanceRead)
+	defer cancel()
+	err := col.FindOne(
+		ctx,
 		filter,
 		option,
 	).Decode(&result)
@@ -74,8 +78,10 @@ func (a *AccountDB) GetAccountAssetByPosition(chainId, user, pay, item *string)
 	filter, projection := a.BsonForGetAccountPosition(chainId, user, pay, item)
 
 	option := options.FindOne().SetProjection(projection)
-	err := a.ColAssets.FindOne(
-		context.Background(),
+	col, ctx, cancel := a.collection(a.ColAssets, conf.OpBalanceRead)
+	defer cancel()
+	err := col.FindOne(
+		ctx,
 		filter,
 		option,
 	).Decode(&asset)
@@ -123,8 +129,10 @@ func (a *AccountDB) UpdateAccountPosition(
 	}
 
 	option := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
-	err := a.ColAssets.FindOneAndUpdate(
-		context.Background(),
+	col, ctx, cancel := a.collection(a.ColAssets, conf.OpBalanceWrite)
+	defer cancel()
+	err := col.FindOneAndUpdate(
+		ctx,
 		filter,
 		update,
 		option,
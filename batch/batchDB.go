@@ -2,50 +2,63 @@ package batch
 
 import (
 	"context"
-	"fmt"
 
 	"github.com/coinmeca/db-connector/conf"
 	"github.com/coinmeca/go-common/commondatabase"
 	"github.com/coinmeca/go-common/commonlog"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.uber.org/zap"
 )
 
 type BatchDB struct {
 	config *conf.Config
 
-	client *mongo.Client
-	ColJob *mongo.Collection
+	client  *mongo.Client
+	release func(ctx context.Context) error
+	ColJob  *mongo.Collection
 
 	start chan struct{}
 }
 
-func NewDB(config *conf.Config) (commondatabase.IRepository, error) {
-	r := &BatchDB{
-		config: config,
-		start:  make(chan struct{}),
-	}
+type BatchDBInterface interface {
+	// getter
+	GetBatchTableInfos() ([]commondatabase.BatchInfo, error)
 
-	fmt.Println(r.config)
-	var err error
-	credential := options.Credential{
-		Username: r.config.Repositories["batchDB"]["username"].(string),
-		Password: r.config.Repositories["batchDB"]["pass"].(string),
-	}
+	Start() error
+	Close(ctx context.Context) error
+}
 
-	clientOptions := options.Client().ApplyURI(config.Repositories["batchDB"]["datasource"].(string)).SetAuth(credential)
-	if r.client, err = mongo.Connect(context.Background(), clientOptions); err != nil {
+var _ BatchDBInterface = (*BatchDB)(nil)
+
+// NewDB connects a client of its own for [Repositories.batchDB], which Close
+// disconnects.
+func NewDB(config *conf.Config) (commondatabase.IRepository, error) {
+	client, err := config.Connect(context.Background(), "batchDB")
+	if err != nil {
 		return nil, err
 	}
 
-	if err = r.client.Ping(context.Background(), nil); err == nil {
-		db := r.client.Database(config.Repositories["batchDB"]["db"].(string))
-		r.ColJob = db.Collection("job")
-	} else {
+	r, err := NewDBWithClient(config, client, client.Disconnect)
+	if err != nil {
+		client.Disconnect(context.Background())
 		return nil, err
 	}
+	return r, nil
+}
+
+// NewDBWithClient builds the repository on a client shared with other
+// repositories. Close calls release instead of disconnecting the client.
+func NewDBWithClient(config *conf.Config, client *mongo.Client, release func(ctx context.Context) error) (commondatabase.IRepository, error) {
+	r := &BatchDB{
+		config:  config,
+		client:  client,
+		release: release,
+		start:   make(chan struct{}),
+	}
+
+	db := r.client.Database(config.Repositories["batchDB"].DB, config.Repositories["batchDB"].DatabaseOptions())
+	r.ColJob = db.Collection("job")
 
 	commonlog.Logger.Debug("load repository",
 		zap.String("batchDB", r.config.Common.ServiceId),
@@ -65,6 +78,11 @@ func (b *BatchDB) Start() error {
 	}()
 }
 
+// Close releases the client of the repository.
+func (b *BatchDB) Close(ctx context.Context) error {
+	return b.release(ctx)
+}
+
 func (b *BatchDB) GetBatchTableInfos() ([]commondatabase.BatchInfo, error) {
 	var batchTableInfos []commondatabase.BatchInfo
 	cursor, err := b.ColJob.Find(context.Background(), bson.M{})
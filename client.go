@@ -0,0 +1,210 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/coinmeca/db-connector/conf"
+	"github.com/coinmeca/go-common/commonlog"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// clientRegistry hands out one *mongo.Client per datasource and credential,
+// so repositories that point at the same cluster share a connection pool. A
+// client is disconnected once every reference to it is released.
+type clientRegistry struct {
+	lock    sync.Mutex
+	conf    *conf.Config
+	clients map[string]*mongo.Client
+	refs    map[string]int
+	names   map[string]string
+	order   []string
+}
+
+func newClientRegistry(c *conf.Config) *clientRegistry {
+	return &clientRegistry{
+		conf:    c,
+		clients: make(map[string]*mongo.Client),
+		refs:    make(map[string]int),
+		names:   make(map[string]string),
+	}
+}
+
+// clientKey identifies a client by datasource, credential and the settings
+// that cannot differ within one client. The password is hashed so it is not
+// kept around as a map key.
+func clientKey(setting *conf.RepositoryConfig) string {
+	pass := sha256.Sum256([]byte(setting.Pass))
+	return strings.Join([]string{
+		setting.Datasource,
+		setting.Username,
+		hex.EncodeToString(pass[:]),
+		setting.AppName,
+		fmt.Sprintf("%+v", setting.TLS),
+	}, "|")
+}
+
+// acquire returns the client for the named repository setting, connecting it on
+// first use, and a function releasing the reference taken on it. Releasing
+// more than once has no effect.
+func (c *clientRegistry) acquire(name string) (*mongo.Client, func(ctx context.Context) error, error) {
+	setting, err := c.conf.Repository(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if unknown := setting.ExtraKeys(); len(unknown) > 0 {
+		commonlog.Logger.Warn("acquire: unknown settings ignored",
+			zap.String("repository", name),
+			zap.Strings("keys", unknown),
+		)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	key := clientKey(setting)
+	client, ok := c.clients[key]
+	if !ok {
+		clientOptions, err := c.clientOptions(key, setting)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if client, err = mongo.Connect(context.Background(), clientOptions); err != nil {
+			return nil, nil, err
+		}
+
+		if err = client.Ping(context.Background(), nil); err != nil {
+			client.Disconnect(context.Background())
+			return nil, nil, err
+		}
+
+		c.clients[key] = client
+		c.order = append(c.order, key)
+
+		commonlog.Logger.Debug("connect datasource",
+			zap.String("repository", name),
+			zap.Int("shared", len(c.sharing(key))),
+		)
+	}
+	c.names[name] = key
+	c.refs[key]++
+
+	var once sync.Once
+	release := func(ctx context.Context) (err error) {
+		once.Do(func() { err = c.release(ctx, key, client) })
+		return err
+	}
+	return client, release, nil
+}
+
+// release drops a reference to the client of key and disconnects the client
+// when it was the last one.
+func (c *clientRegistry) release(ctx context.Context, key string, client *mongo.Client) error {
+	c.lock.Lock()
+	if c.clients[key] != client {
+		// already disconnected by disconnectAll
+		c.lock.Unlock()
+		return nil
+	}
+	if c.refs[key]--; c.refs[key] > 0 {
+		c.lock.Unlock()
+		return nil
+	}
+
+	delete(c.clients, key)
+	delete(c.refs, key)
+	c.order = slices.DeleteFunc(c.order, func(k string) bool { return k == key })
+	for name, k := range c.names {
+		if k == key {
+			delete(c.names, name)
+		}
+	}
+	c.lock.Unlock()
+
+	return client.Disconnect(ctx)
+}
+
+// clientOptions builds the options for a shared client. Pool sizes and
+// timeouts are taken from every repository sharing the client: the largest
+// value wins so no repository gets less than it asked for.
+func (c *clientRegistry) clientOptions(key string, setting *conf.RepositoryConfig) (*options.ClientOptions, error) {
+	var merged conf.RepositoryConfig
+	for _, name := range c.sharing(key) {
+		s := c.conf.Repositories[name]
+		merged.MaxPoolSize = max(merged.MaxPoolSize, s.MaxPoolSize)
+		merged.MinPoolSize = max(merged.MinPoolSize, s.MinPoolSize)
+		merged.MaxConnIdleTime = max(merged.MaxConnIdleTime, s.MaxConnIdleTime)
+		merged.ConnectTimeout = max(merged.ConnectTimeout, s.ConnectTimeout)
+		merged.ServerSelectionTimeout = max(merged.ServerSelectionTimeout, s.ServerSelectionTimeout)
+		merged.Timeout = max(merged.Timeout, s.Timeout)
+	}
+
+	shared := *setting
+	shared.MaxPoolSize = merged.MaxPoolSize
+	shared.MinPoolSize = merged.MinPoolSize
+	shared.MaxConnIdleTime = merged.MaxConnIdleTime
+	shared.ConnectTimeout = merged.ConnectTimeout
+	shared.ServerSelectionTimeout = merged.ServerSelectionTimeout
+	shared.Timeout = merged.Timeout
+
+	return shared.ClientOptions()
+}
+
+// sharing returns the names of the configured repositories resolving to key.
+func (c *clientRegistry) sharing(key string) []string {
+	names := make([]string, 0)
+	for name, setting := range c.conf.Repositories {
+		if setting != nil && clientKey(setting) == key {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// lookup returns the client acquired for the named repository setting.
+func (c *clientRegistry) lookup(name string) (string, *mongo.Client, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	key, ok := c.names[name]
+	if !ok {
+		return "", nil, false
+	}
+	client, ok := c.clients[key]
+	return key, client, ok
+}
+
+// disconnectAll disconnects every client still referenced, in reverse connect
+// order.
+func (c *clientRegistry) disconnectAll(ctx context.Context) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var errs []error
+	for i := len(c.order) - 1; i >= 0; i-- {
+		if err := c.clients[c.order[i]].Disconnect(ctx); err != nil {
+			errs = append(errs, err)
+		}
+		delete(c.clients, c.order[i])
+	}
+	c.refs = make(map[string]int)
+	c.names = make(map[string]string)
+	c.order = nil
+
+	return errors.Join(errs...)
+}
+
+// checkSetting reports every problem of the named conf.Repositories entry.
+func checkSetting(config *conf.Config, name string) error {
+	_, err := config.Repository(name)
+	return err
+}
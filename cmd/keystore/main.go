@@ -0,0 +1,105 @@
+// Command keystore manages the master key sealing the API keys in keyDB.
+//
+//	keystore generate            print a new master key
+//	keystore -config c encrypt   seal the keys still stored in plaintext
+//	keystore -config c rotate    seal every key with a new master key
+//
+// rotate takes the new master key from -key, a file holding it in hex or
+// base64, or generates one. The new master key is written to master.key of
+// DataDirectory.Keystore and the previous one kept next to it. Running
+// instances pick it up when they meet a key sealed with it. When the master
+// key is set through DBCONN_KEYS_MASTERKEY, set it to the content of
+// master.key afterwards: instances refuse to start with the previous one.
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	db "github.com/coinmeca/db-connector"
+	"github.com/coinmeca/db-connector/conf"
+	"github.com/coinmeca/db-connector/key"
+	"github.com/coinmeca/go-common/commonlog"
+	"go.uber.org/zap"
+)
+
+func main() {
+	config := flag.String("config", "config.toml", "configuration file")
+	masterKey := flag.String("key", "", "file holding the new master key of rotate")
+	flag.Parse()
+
+	if err := run(flag.Arg(0), *config, *masterKey); err != nil {
+		fmt.Fprintln(os.Stderr, "keystore:", err)
+		os.Exit(1)
+	}
+}
+
+func run(command, config, masterKey string) error {
+	if command == "generate" {
+		master, err := key.GenerateMasterKey()
+		if err != nil {
+			return err
+		}
+		fmt.Println(hex.EncodeToString(master))
+		return nil
+	}
+	if command != "encrypt" && command != "rotate" {
+		return fmt.Errorf("unknown command %q, expected generate, encrypt or rotate", command)
+	}
+
+	var master []byte
+	if command == "rotate" {
+		var err error
+		if master, err = readMasterKey(masterKey); err != nil {
+			return err
+		}
+	}
+
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		return err
+	}
+	commonlog.Logger = logger
+
+	c, err := conf.NewConfig(config)
+	if err != nil {
+		return err
+	}
+	r, err := db.NewRepositories(c, db.WithRepositories("keyDB"))
+	if err != nil {
+		return err
+	}
+	defer r.Close(context.Background())
+
+	k, err := db.Get[*key.KeyManager](r)
+	if err != nil {
+		return err
+	}
+
+	var n int
+	if command == "encrypt" {
+		n, err = k.EncryptKeys(context.Background())
+	} else {
+		n, err = k.RotateMasterKey(context.Background(), master)
+	}
+	fmt.Printf("%d keys sealed\n", n)
+	if err == nil && command == "rotate" && c.Keys.MasterKey != "" {
+		fmt.Printf("set DBCONN_KEYS_MASTERKEY to the content of %s\n", filepath.Join(c.DataDirectory.Keystore, key.MasterKeyFile))
+	}
+	return err
+}
+
+func readMasterKey(file string) ([]byte, error) {
+	if file == "" {
+		return key.GenerateMasterKey()
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return key.ParseMasterKey(string(content))
+}
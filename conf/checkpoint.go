@@ -0,0 +1,70 @@
+package conf
+
+import (
+	"fmt"
+	"sort"
+)
+
+// CheckpointConfig configures the checkpoints of contractDB under
+// [Checkpoint].
+type CheckpointConfig struct {
+	// Window is the number of recent blocks kept with the checkpoint of a
+	// chain to find where a reorganization started. It also bounds the depth
+	// of the reorganizations that can be rolled back, and the number of
+	// revisions chart buckets keep to undo the writes made for orphaned
+	// blocks. Defaults to 64.
+	Window int
+	// Finality tells by chain id when a block is final. Chains not listed
+	// use the "finalized" block tag.
+	Finality map[string]FinalityConfig
+}
+
+// FinalityConfig tells when a block of a chain is final.
+type FinalityConfig struct {
+	// Confirmations is the number of blocks on top of a block that make it
+	// final. It takes precedence over Tag.
+	Confirmations int
+	// Tag is the block tag of the last final block, "finalized" (default) or
+	// "safe".
+	Tag string
+}
+
+// FinalityOf returns the finality of chainId with the defaults applied.
+func (c CheckpointConfig) FinalityOf(chainId string) FinalityConfig {
+	finality := c.Finality[chainId]
+	if finality.Confirmations <= 0 && finality.Tag == "" {
+		finality.Tag = "finalized"
+	}
+	return finality
+}
+
+func (c CheckpointConfig) WindowSize() int {
+	if c.Window <= 0 {
+		return 64
+	}
+	return c.Window
+}
+
+func (c CheckpointConfig) validate() []error {
+	var errs []error
+	if c.Window < 0 {
+		errs = append(errs, fmt.Errorf("window %d must not be negative", c.Window))
+	}
+	chainIds := make([]string, 0, len(c.Finality))
+	for chainId := range c.Finality {
+		chainIds = append(chainIds, chainId)
+	}
+	sort.Strings(chainIds)
+	for _, chainId := range chainIds {
+		finality := c.Finality[chainId]
+		if finality.Confirmations < 0 {
+			errs = append(errs, fmt.Errorf("finality of chain %s: confirmations %d must not be negative", chainId, finality.Confirmations))
+		}
+		switch finality.Tag {
+		case "", "finalized", "safe":
+		default:
+			errs = append(errs, fmt.Errorf("finality of chain %s: unknown tag %q", chainId, finality.Tag))
+		}
+	}
+	return errs
+}
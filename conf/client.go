@@ -0,0 +1,120 @@
+package conf
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Repository returns the named conf.Repositories entry, or every problem of it.
+func (c *Config) Repository(name string) (*RepositoryConfig, error) {
+	setting, ok := c.Repositories[name]
+	if !ok || setting == nil {
+		return nil, fmt.Errorf("repository %s is enabled but [Repositories.%s] is not configured", name, name)
+	}
+
+	if err := setting.Validate(); err != nil {
+		return nil, fmt.Errorf("repository %s: %w", name, err)
+	}
+	return setting, nil
+}
+
+// Connect connects a client of its own for the named conf.Repositories entry
+// and pings it. The caller disconnects the client.
+func (c *Config) Connect(ctx context.Context, name string) (*mongo.Client, error) {
+	setting, err := c.Repository(name)
+	if err != nil {
+		return nil, err
+	}
+
+	clientOptions, err := setting.ClientOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := mongo.Connect(ctx, clientOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = client.Ping(ctx, nil); err != nil {
+		client.Disconnect(context.Background())
+		return nil, err
+	}
+	return client, nil
+}
+
+// ClientOptions returns the options of a client connected for this section
+// alone.
+func (c *RepositoryConfig) ClientOptions() (*options.ClientOptions, error) {
+	clientOptions := options.Client().ApplyURI(c.Datasource)
+	if c.Username != "" {
+		clientOptions.SetAuth(options.Credential{
+			Username: c.Username,
+			Password: c.Pass,
+		})
+	}
+	if c.AppName != "" {
+		clientOptions.SetAppName(c.AppName)
+	}
+
+	if c.TLS.Enabled {
+		tlsConfig, err := c.TLS.config()
+		if err != nil {
+			return nil, err
+		}
+		clientOptions.SetTLSConfig(tlsConfig)
+	}
+
+	if c.MaxPoolSize > 0 {
+		clientOptions.SetMaxPoolSize(c.MaxPoolSize)
+	}
+	if c.MinPoolSize > 0 {
+		clientOptions.SetMinPoolSize(c.MinPoolSize)
+	}
+	if c.MaxConnIdleTime > 0 {
+		clientOptions.SetMaxConnIdleTime(c.MaxConnIdleTime)
+	}
+	if c.ConnectTimeout > 0 {
+		clientOptions.SetConnectTimeout(c.ConnectTimeout)
+	}
+	if c.ServerSelectionTimeout > 0 {
+		clientOptions.SetServerSelectionTimeout(c.ServerSelectionTimeout)
+	}
+	if c.Timeout > 0 {
+		clientOptions.SetTimeout(c.Timeout)
+	}
+
+	return clientOptions, nil
+}
+
+func (t TLSConfig) config() (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: t.InsecureSkipVerify}
+
+	if t.CAFile != "" {
+		ca, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate found in %s", t.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
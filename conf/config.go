@@ -1,8 +1,12 @@
 ﻿package conf
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"slices"
+	"sort"
+	"time"
 
 	"github.com/naoina/toml"
 )
@@ -10,6 +14,8 @@ import (
 type Config struct {
 	Common struct {
 		ServiceId string
+		// Repositories lists the repositories to build; empty builds all of them.
+		Repositories []string
 	}
 
 	DataDirectory struct {
@@ -38,12 +44,22 @@ type Config struct {
 		GrpcPort string
 	}
 
-	Repositories map[string]map[string]interface{}
+	Repositories map[string]*RepositoryConfig
 
 	Contracts map[string]map[string]interface{}
 
+	ContractCache ContractCacheConfig
+
+	Checkpoint CheckpointConfig
+
 	Chains []string
 
+	Multicall MulticallConfig
+
+	Failover FailoverConfig
+
+	Indexer IndexerConfig
+
 	Log struct {
 		Terminal struct {
 			Use       bool
@@ -67,20 +83,149 @@ type Config struct {
 	AlchemyAPI struct {
 		Sepolia string
 	}
+
+	// Keys configures the API key pools of the key manager.
+	Keys struct {
+		// PoolSize is the number of keys activated per category and chain.
+		// Keys already active in keyDB are always part of the pool.
+		PoolSize int
+		// Rotation is "weighted", using the weight of each key document, or
+		// "roundRobin", ignoring weights. Defaults to weighted.
+		Rotation string
+		// Quotas limits the keys of each category, e.g. "alchemy".
+		Quotas map[string]QuotaConfig
+		// Providers adds or replaces providers of the key package by name.
+		Providers map[string]ProviderConfig
+		// Rpc names the provider of the RPC keys by chain id. Chains not
+		// listed use "alchemy".
+		Rpc map[string]string
+		// MasterKey seals the keys stored in keyDB, as 32 bytes in hex or
+		// base64. It is best set through DBCONN_KEYS_MASTERKEY or
+		// DBCONN_KEYS_MASTERKEY_FILE; without it the master key is read from
+		// master.key of DataDirectory.Keystore. Keys are stored in plaintext
+		// when neither is set.
+		MasterKey string
+		// Probe runs the health prober of the keys not in rotation.
+		Probe ProbeConfig
+		// Sync is how the pools follow the changes other instances make to
+		// keyDB: "changeStream" (default) watches keyDB and polls when change
+		// streams are not available, "poll" only polls and "off" does neither.
+		Sync string
+		// SyncInterval is the time between two polls. Defaults to 10s.
+		SyncInterval Duration
+	}
 }
 
-func NewConfig(file string) *Config {
+// NewConfig reads the TOML file, applies the environment overrides described
+// at applyEnv and validates the result.
+func NewConfig(file string) (*Config, error) {
 	c := new(Config)
 
-	if file, err := os.Open(file); err != nil {
-		panic(err)
-	} else {
-		defer file.Close()
-		if err := toml.NewDecoder(file).Decode(c); err != nil {
-			panic(err)
-		} else {
-			fmt.Print(c.Repositories)
-			return c
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if err := toml.NewDecoder(f).Decode(c); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+
+	if err := c.applyEnv(); err != nil {
+		return nil, err
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Validate reports every problem of the configuration at once, each prefixed
+// with the section it belongs to. Only the repositories named in
+// Common.Repositories are checked, or all of them when it is empty; the ones
+// an enabled repository requires are checked when Repositories builds them.
+func (c *Config) Validate() error {
+	names := make([]string, 0, len(c.Repositories))
+	for name := range c.Repositories {
+		if len(c.Common.Repositories) == 0 || slices.Contains(c.Common.Repositories, name) {
+			names = append(names, name)
 		}
 	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		repo := c.Repositories[name]
+		if repo == nil {
+			errs = append(errs, fmt.Errorf("repository %s: empty section", name))
+			continue
+		}
+		for _, err := range repo.validate() {
+			errs = append(errs, fmt.Errorf("repository %s: %w", name, err))
+		}
+	}
+
+	switch c.Keys.Rotation {
+	case "", "weighted", "roundRobin":
+	default:
+		errs = append(errs, fmt.Errorf("keys: unknown rotation %q", c.Keys.Rotation))
+	}
+	if c.Keys.PoolSize < 0 {
+		errs = append(errs, fmt.Errorf("keys: poolSize %d must not be negative", c.Keys.PoolSize))
+	}
+
+	switch c.Keys.Sync {
+	case "", "changeStream", "poll", "off":
+	default:
+		errs = append(errs, fmt.Errorf("keys: unknown sync %q", c.Keys.Sync))
+	}
+	if c.Keys.SyncInterval < 0 {
+		errs = append(errs, fmt.Errorf("keys: syncInterval %v must not be negative", time.Duration(c.Keys.SyncInterval)))
+	}
+
+	for _, err := range c.Keys.Probe.validate() {
+		errs = append(errs, fmt.Errorf("keys: probe: %w", err))
+	}
+
+	for _, err := range c.Checkpoint.validate() {
+		errs = append(errs, fmt.Errorf("checkpoint: %w", err))
+	}
+	for _, err := range c.ContractCache.validate() {
+		errs = append(errs, fmt.Errorf("contractCache: %w", err))
+	}
+	for _, err := range c.Failover.validate() {
+		errs = append(errs, fmt.Errorf("failover: %w", err))
+	}
+	for _, err := range c.Indexer.validate() {
+		errs = append(errs, fmt.Errorf("indexer: %w", err))
+	}
+	for _, err := range c.Multicall.validate() {
+		errs = append(errs, fmt.Errorf("multicall: %w", err))
+	}
+
+	cates := make([]string, 0, len(c.Keys.Quotas))
+	for cate := range c.Keys.Quotas {
+		cates = append(cates, cate)
+	}
+	sort.Strings(cates)
+	for _, cate := range cates {
+		for _, err := range c.Keys.Quotas[cate].validate() {
+			errs = append(errs, fmt.Errorf("keys: quota %s: %w", cate, err))
+		}
+	}
+
+	providers := make([]string, 0, len(c.Keys.Providers))
+	for name := range c.Keys.Providers {
+		providers = append(providers, name)
+	}
+	sort.Strings(providers)
+	for _, name := range providers {
+		for _, err := range c.Keys.Providers[name].validate() {
+			errs = append(errs, fmt.Errorf("keys: provider %s: %w", name, err))
+		}
+	}
+
+	return errors.Join(errs...)
 }
@@ -0,0 +1,38 @@
+package conf
+
+import (
+	"fmt"
+	"time"
+)
+
+// ContractCacheConfig configures the contract cache of contractDB under
+// [ContractCache].
+type ContractCacheConfig struct {
+	// Sync is how the cache follows the contract collection: "changeStream"
+	// (default) reloads it on every change, "poll" only every TTL and "off"
+	// disables the cache, reading every contract from the collection.
+	Sync string
+	// TTL is the time after which the cache is reloaded even without a
+	// change. Defaults to 5m.
+	TTL Duration
+}
+
+func (c ContractCacheConfig) TTLDuration() time.Duration {
+	if c.TTL <= 0 {
+		return 5 * time.Minute
+	}
+	return time.Duration(c.TTL)
+}
+
+func (c ContractCacheConfig) validate() []error {
+	var errs []error
+	switch c.Sync {
+	case "", "changeStream", "poll", "off":
+	default:
+		errs = append(errs, fmt.Errorf("unknown sync %q", c.Sync))
+	}
+	if c.TTL < 0 {
+		errs = append(errs, fmt.Errorf("ttl %v must not be negative", time.Duration(c.TTL)))
+	}
+	return errs
+}
@@ -0,0 +1,38 @@
+package conf
+
+import (
+	"fmt"
+	"time"
+)
+
+// Duration is a time.Duration set either as a Go duration string ("1m30s")
+// or as a number of seconds, like the durations of RepositoryConfig.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalTOML(decode func(interface{}) error) error {
+	var value interface{}
+	if err := decode(&value); err != nil {
+		return err
+	}
+	parsed, ok := parseDuration(value)
+	if !ok {
+		return fmt.Errorf("%v is not a non-negative duration", value)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// parseDuration reads a number of seconds or a Go duration string.
+func parseDuration(value interface{}) (time.Duration, bool) {
+	switch v := value.(type) {
+	case int64:
+		if v >= 0 {
+			return time.Duration(v) * time.Second, true
+		}
+	case string:
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			return d, true
+		}
+	}
+	return 0, false
+}
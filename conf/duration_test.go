@@ -0,0 +1,38 @@
+package conf
+
+import (
+	"testing"
+	"time"
+
+	"github.com/naoina/toml"
+)
+
+func TestDuration(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+		err   bool
+	}{
+		{name: "seconds", value: "90", want: 90 * time.Second},
+		{name: "string", value: `"1m30s"`, want: 90 * time.Second},
+		{name: "milliseconds", value: `"250ms"`, want: 250 * time.Millisecond},
+		{name: "negative seconds", value: "-1", err: true},
+		{name: "negative string", value: `"-1s"`, err: true},
+		{name: "not a duration", value: `"soon"`, err: true},
+		{name: "wrong type", value: "true", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var quota QuotaConfig
+			err := toml.Unmarshal([]byte("Backoff = "+tt.value+"\n"), &quota)
+			if (err != nil) != tt.err {
+				t.Fatalf("error = %v, want error %v", err, tt.err)
+			}
+			if got := time.Duration(quota.Backoff); !tt.err && got != tt.want {
+				t.Errorf("Backoff = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix prefixes every environment variable read by NewConfig.
+const EnvPrefix = "DBCONN"
+
+var (
+	durationType     = reflect.TypeOf(time.Duration(0))
+	confDurationType = reflect.TypeOf(Duration(0))
+)
+
+// applyEnv overrides c with environment variables named after the field path,
+// upper-cased and joined with underscores, e.g. DBCONN_REPOSITORIES_MARKETDB_PASS
+// or DBCONN_COINMARKETCAPAPI_APIKEY. For every variable a NAME_FILE variant
+// is read as well; it points at a file holding the value, as mounted by
+// Kubernetes or Docker secrets, and takes precedence over NAME.
+//
+// Map entries are matched case-insensitively against the keys present in the
+// TOML file. Repositories named in Common.Repositories can be configured from
+// the environment alone.
+func (c *Config) applyEnv() error {
+	if errs := applyEnvValue(reflect.ValueOf(&c.Common).Elem(), envName(EnvPrefix, "COMMON")); len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	if c.Repositories == nil {
+		c.Repositories = make(map[string]*RepositoryConfig)
+	}
+	for _, name := range c.Common.Repositories {
+		if findKey(reflect.ValueOf(c.Repositories), name) == "" && hasEnvPrefix(envName(EnvPrefix, "REPOSITORIES", name)) {
+			c.Repositories[name] = &RepositoryConfig{}
+		}
+	}
+
+	errs := applyEnvValue(reflect.ValueOf(c).Elem(), EnvPrefix)
+	for name, repo := range c.Repositories {
+		if repo == nil {
+			continue
+		}
+		if err := repo.dropOverridden(envName(EnvPrefix, "REPOSITORIES", name)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func applyEnvValue(v reflect.Value, prefix string) []error {
+	var errs []error
+
+	switch {
+	case v.Kind() == reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if !t.Field(i).IsExported() {
+				continue
+			}
+			errs = append(errs, applyEnvValue(v.Field(i), envName(prefix, t.Field(i).Name))...)
+		}
+
+	case v.Kind() == reflect.Ptr && v.Type().Elem().Kind() == reflect.Struct:
+		if !v.IsNil() {
+			errs = append(errs, applyEnvValue(v.Elem(), prefix)...)
+		}
+
+	case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String:
+		elemKind := v.Type().Elem().Kind()
+		if elemKind != reflect.Struct && elemKind != reflect.Ptr {
+			return nil
+		}
+		for _, key := range v.MapKeys() {
+			elem := v.MapIndex(key)
+			if elemKind == reflect.Ptr {
+				errs = append(errs, applyEnvValue(elem, envName(prefix, key.String()))...)
+				continue
+			}
+			// map values are not addressable, so the struct is copied and stored back
+			copied := reflect.New(elem.Type()).Elem()
+			copied.Set(elem)
+			errs = append(errs, applyEnvValue(copied, envName(prefix, key.String()))...)
+			v.SetMapIndex(key, copied)
+		}
+
+	default:
+		value, ok, err := lookupEnv(prefix)
+		if err != nil {
+			return []error{err}
+		}
+		if ok {
+			if err := setEnvValue(v, value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", prefix, err))
+			}
+		}
+	}
+
+	return errs
+}
+
+func setEnvValue(v reflect.Value, value string) error {
+	if v.Type() == durationType || v.Type() == confDurationType {
+		if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+			v.SetInt(int64(time.Duration(seconds) * time.Second))
+			return nil
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return nil
+		}
+		items := make([]string, 0)
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	}
+	return nil
+}
+
+// lookupEnv returns the value of name, or the content of the file named by
+// name_FILE when that is set.
+func lookupEnv(name string) (string, bool, error) {
+	value, ok := os.LookupEnv(name)
+
+	if file, found := os.LookupEnv(name + "_FILE"); found {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return "", false, fmt.Errorf("%s_FILE: %w", name, err)
+		}
+		value, ok = strings.TrimRight(string(content), "\r\n"), true
+	}
+
+	return value, ok, nil
+}
+
+func envName(parts ...string) string {
+	return strings.ToUpper(strings.Join(parts, "_"))
+}
+
+func hasEnvPrefix(prefix string) bool {
+	for _, env := range os.Environ() {
+		if strings.HasPrefix(env, prefix+"_") {
+			return true
+		}
+	}
+	return false
+}
+
+// findKey returns the key of m equal to name ignoring case.
+func findKey(m reflect.Value, name string) string {
+	for _, key := range m.MapKeys() {
+		if strings.EqualFold(key.String(), name) {
+			return key.String()
+		}
+	}
+	return ""
+}
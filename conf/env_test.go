@@ -0,0 +1,214 @@
+package conf
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const envTestConfig = `
+Chains = ["1"]
+
+[Port]
+Http = 80
+
+[Repositories.marketDB]
+datasource = "mongodb://localhost"
+db = "market"
+username = "user"
+pass = "from-file"
+
+[Log.Block.1]
+StartBlock = 5
+`
+
+// withMarketSetting returns envTestConfig with setting added to marketDB.
+func withMarketSetting(setting string) string {
+	return strings.Replace(envTestConfig, "pass = \"from-file\"\n", "pass = \"from-file\"\n"+setting+"\n", 1)
+}
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func writeSecret(t *testing.T, content string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestApplyEnv(t *testing.T) {
+	tests := []struct {
+		name string
+		env  func(t *testing.T) map[string]string
+		want func(c *Config) bool
+	}{
+		{
+			name: "nothing set",
+			env:  func(t *testing.T) map[string]string { return nil },
+			want: func(c *Config) bool {
+				return c.Repositories["marketDB"].Pass == "from-file" && c.Port.Http == 80
+			},
+		},
+		{
+			name: "string of a repository",
+			env: func(t *testing.T) map[string]string {
+				return map[string]string{"DBCONN_REPOSITORIES_MARKETDB_PASS": "from-env"}
+			},
+			want: func(c *Config) bool { return c.Repositories["marketDB"].Pass == "from-env" },
+		},
+		{
+			name: "file variant wins",
+			env: func(t *testing.T) map[string]string {
+				return map[string]string{
+					"DBCONN_REPOSITORIES_MARKETDB_PASS":      "from-env",
+					"DBCONN_REPOSITORIES_MARKETDB_PASS_FILE": writeSecret(t, "from-secret\n"),
+				}
+			},
+			want: func(c *Config) bool { return c.Repositories["marketDB"].Pass == "from-secret" },
+		},
+		{
+			name: "durations as seconds or strings",
+			env: func(t *testing.T) map[string]string {
+				return map[string]string{
+					"DBCONN_REPOSITORIES_MARKETDB_TIMEOUT":        "30",
+					"DBCONN_REPOSITORIES_MARKETDB_CONNECTTIMEOUT": "1500ms",
+				}
+			},
+			want: func(c *Config) bool {
+				r := c.Repositories["marketDB"]
+				return r.Timeout == 30*time.Second && r.ConnectTimeout == 1500*time.Millisecond
+			},
+		},
+		{
+			name: "key durations",
+			env: func(t *testing.T) map[string]string {
+				return map[string]string{
+					"DBCONN_KEYS_PROBE_INTERVAL": "90",
+					"DBCONN_KEYS_PROBE_TIMEOUT":  "2s",
+					"DBCONN_KEYS_SYNCINTERVAL":   "500ms",
+				}
+			},
+			want: func(c *Config) bool {
+				p := c.Keys.Probe
+				return p.IntervalDuration() == 90*time.Second && p.TimeoutDuration() == 2*time.Second &&
+					time.Duration(c.Keys.SyncInterval) == 500*time.Millisecond
+			},
+		},
+		{
+			name: "numbers, booleans and lists",
+			env: func(t *testing.T) map[string]string {
+				return map[string]string{
+					"DBCONN_PORT_HTTP":        "8080",
+					"DBCONN_LOG_TERMINAL_USE": "true",
+					"DBCONN_CHAINS":           "1, 137,",
+				}
+			},
+			want: func(c *Config) bool {
+				return c.Port.Http == 8080 && c.Log.Terminal.Use && slices.Equal(c.Chains, []string{"1", "137"})
+			},
+		},
+		{
+			name: "struct map entry",
+			env: func(t *testing.T) map[string]string {
+				return map[string]string{"DBCONN_LOG_BLOCK_1_STARTBLOCK": "100"}
+			},
+			want: func(c *Config) bool { return c.Log.Block["1"].StartBlock == 100 },
+		},
+		{
+			name: "repository from the environment alone",
+			env: func(t *testing.T) map[string]string {
+				return map[string]string{
+					"DBCONN_COMMON_REPOSITORIES":             "marketDB,vaultDB",
+					"DBCONN_REPOSITORIES_VAULTDB_DATASOURCE": "mongodb://vault",
+					"DBCONN_REPOSITORIES_VAULTDB_DB":         "vault",
+				}
+			},
+			want: func(c *Config) bool {
+				v := c.Repositories["vaultDB"]
+				return v != nil && v.Datasource == "mongodb://vault" && v.DB == "vault"
+			},
+		},
+	}
+
+	file := writeConfig(t, envTestConfig)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env(t) {
+				t.Setenv(name, value)
+			}
+			c, err := NewConfig(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.want(c) {
+				t.Errorf("config after overrides: %+v", c)
+			}
+		})
+	}
+}
+
+func TestApplyEnvFixesTypeProblems(t *testing.T) {
+	file := writeConfig(t, withMarketSetting("maxPoolSize = \"many\""))
+	t.Setenv("DBCONN_REPOSITORIES_MARKETDB_MAXPOOLSIZE", "10")
+
+	c, err := NewConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Repositories["marketDB"].MaxPoolSize != 10 {
+		t.Errorf("maxPoolSize = %d, want 10", c.Repositories["marketDB"].MaxPoolSize)
+	}
+}
+
+func TestApplyEnvErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		err  string
+	}{
+		{
+			name: "not a number",
+			env:  map[string]string{"DBCONN_PORT_HTTP": "eighty"},
+			err:  "DBCONN_PORT_HTTP",
+		},
+		{
+			name: "not a duration",
+			env:  map[string]string{"DBCONN_REPOSITORIES_MARKETDB_TIMEOUT": "soon"},
+			err:  "DBCONN_REPOSITORIES_MARKETDB_TIMEOUT",
+		},
+		{
+			name: "type problem not overridden",
+			env:  map[string]string{"DBCONN_REPOSITORIES_MARKETDB_PASS": "secret"},
+			err:  "setting maxPoolSize must be a non-negative integer",
+		},
+		{
+			name: "missing secret file",
+			env:  map[string]string{"DBCONN_REPOSITORIES_MARKETDB_PASS_FILE": "/nonexistent/secret"},
+			err:  "DBCONN_REPOSITORIES_MARKETDB_PASS_FILE",
+		},
+	}
+
+	file := writeConfig(t, withMarketSetting("maxPoolSize = \"many\""))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			if _, err := NewConfig(file); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("error = %v, want one naming %s", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package conf
+
+import (
+	"fmt"
+	"time"
+)
+
+// FailoverConfig configures how RPC requests move between the providers of a
+// chain, under [Failover].
+type FailoverConfig struct {
+	// Providers maps chain ids to the providers tried after the one of
+	// [Keys.Rpc], each with the keys of its own pool.
+	Providers map[string][]string
+	// Failures is the number of failures in a row that open the circuit of a
+	// provider on a chain. Defaults to 5.
+	Failures int
+	// Cooldown is how long an open circuit rejects requests before a single
+	// trial request is let through. Defaults to 30s.
+	Cooldown Duration
+	// Hedge is the time after which a read still waiting for an answer is
+	// sent to the next provider as well, e.g. "200ms". Zero disables hedging.
+	Hedge Duration
+}
+
+func (f FailoverConfig) Threshold() int {
+	if f.Failures <= 0 {
+		return 5
+	}
+	return f.Failures
+}
+
+func (f FailoverConfig) CooldownDuration() time.Duration {
+	if f.Cooldown <= 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(f.Cooldown)
+}
+
+func (f FailoverConfig) HedgeDelay() time.Duration {
+	return time.Duration(f.Hedge)
+}
+
+func (f FailoverConfig) validate() []error {
+	var errs []error
+	if f.Failures < 0 {
+		errs = append(errs, fmt.Errorf("failures %d must not be negative", f.Failures))
+	}
+	if f.Cooldown < 0 {
+		errs = append(errs, fmt.Errorf("cooldown %v must not be negative", time.Duration(f.Cooldown)))
+	}
+	if f.Hedge < 0 {
+		errs = append(errs, fmt.Errorf("hedge %v must not be negative", time.Duration(f.Hedge)))
+	}
+	return errs
+}
@@ -0,0 +1,52 @@
+package conf
+
+import (
+	"fmt"
+	"time"
+)
+
+// IndexerConfig configures the event log indexer under [Indexer].
+type IndexerConfig struct {
+	// Interval is the number of milliseconds between two polls of a chain
+	// that is caught up with its head. Defaults to 2000.
+	Interval int
+	// BlockRange is the largest number of blocks asked for in one
+	// eth_getLogs request. The range shrinks when a provider rejects it and
+	// grows back while requests succeed. Defaults to 2000.
+	BlockRange uint64
+	// MinBlockRange is the number of blocks the range does not shrink below.
+	// Defaults to 1.
+	MinBlockRange uint64
+}
+
+func (i IndexerConfig) IntervalDuration() time.Duration {
+	if i.Interval <= 0 {
+		return 2 * time.Second
+	}
+	return time.Duration(i.Interval) * time.Millisecond
+}
+
+func (i IndexerConfig) MaxRange() uint64 {
+	if i.BlockRange == 0 {
+		return 2000
+	}
+	return i.BlockRange
+}
+
+func (i IndexerConfig) MinRange() uint64 {
+	if i.MinBlockRange == 0 {
+		return 1
+	}
+	return min(i.MinBlockRange, i.MaxRange())
+}
+
+func (i IndexerConfig) validate() []error {
+	var errs []error
+	if i.Interval < 0 {
+		errs = append(errs, fmt.Errorf("interval %d must not be negative", i.Interval))
+	}
+	if i.BlockRange != 0 && i.MinBlockRange > i.BlockRange {
+		errs = append(errs, fmt.Errorf("minBlockRange %d is above blockRange %d", i.MinBlockRange, i.BlockRange))
+	}
+	return errs
+}
@@ -0,0 +1,90 @@
+package conf
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Multicall3Address is the address Multicall3 is deployed at on most chains.
+const Multicall3Address = "0xcA11bde05977b3631167028862bE2a173976CA11"
+
+// MulticallConfig configures the batching of contract reads under [Multicall].
+type MulticallConfig struct {
+	// Address maps chain ids to the Multicall3 contract, for chains where it
+	// is not at Multicall3Address. "none" makes the batches of the chain run
+	// call by call.
+	Address map[string]string
+	// BatchSize is the most calls of one batch. Defaults to 100.
+	BatchSize int
+	// BatchGas is the gas limit of one batch, counting CallGas for the calls
+	// that do not give their own. Defaults to 30000000.
+	BatchGas uint64
+	// BatchBytes is the most call data of one batch. Defaults to 100000.
+	BatchBytes int
+	// CallGas is the gas counted for a call without its own. Defaults to
+	// 200000.
+	CallGas uint64
+}
+
+// AddressOf returns the Multicall3 contract of chainId, or "" if the chain
+// has none.
+func (m MulticallConfig) AddressOf(chainId string) string {
+	address, ok := m.Address[chainId]
+	switch {
+	case !ok || address == "":
+		return Multicall3Address
+	case strings.EqualFold(address, "none"):
+		return ""
+	}
+	return address
+}
+
+func (m MulticallConfig) Size() int {
+	if m.BatchSize <= 0 {
+		return 100
+	}
+	return m.BatchSize
+}
+
+func (m MulticallConfig) Gas() uint64 {
+	if m.BatchGas == 0 {
+		return 30_000_000
+	}
+	return m.BatchGas
+}
+
+func (m MulticallConfig) Bytes() int {
+	if m.BatchBytes <= 0 {
+		return 100_000
+	}
+	return m.BatchBytes
+}
+
+func (m MulticallConfig) DefaultCallGas() uint64 {
+	if m.CallGas == 0 {
+		return 200_000
+	}
+	return m.CallGas
+}
+
+func (m MulticallConfig) validate() []error {
+	var errs []error
+	if m.BatchSize < 0 {
+		errs = append(errs, fmt.Errorf("batchSize %d must not be negative", m.BatchSize))
+	}
+	if m.BatchBytes < 0 {
+		errs = append(errs, fmt.Errorf("batchBytes %d must not be negative", m.BatchBytes))
+	}
+	chainIds := make([]string, 0, len(m.Address))
+	for chainId := range m.Address {
+		chainIds = append(chainIds, chainId)
+	}
+	sort.Strings(chainIds)
+	for _, chainId := range chainIds {
+		if address := m.Address[chainId]; address != "" && !strings.EqualFold(address, "none") && (len(address) != 42 || !strings.HasPrefix(address, "0x")) {
+			errs = append(errs, fmt.Errorf("address of chain %s: %q is not an address", chainId, address))
+		}
+	}
+	return errs
+}
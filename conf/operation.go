@@ -0,0 +1,184 @@
+package conf
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+// Operation classes that can be tuned per repository under
+// [Repositories.<name>.operations.<class>].
+const (
+	OpChartRead    = "chartRead"
+	OpChartWrite   = "chartWrite"
+	OpInfoRead     = "infoRead"
+	OpInfoWrite    = "infoWrite"
+	OpHistoryWrite = "historyWrite"
+	OpAggregate    = "aggregate"
+	OpBalanceRead  = "balanceRead"
+	OpBalanceWrite = "balanceWrite"
+)
+
+// defaultOperations apply over the section settings unless the class is
+// configured explicitly. Balances are only acknowledged once a majority of
+// the replica set has them, so they survive a failover.
+var defaultOperations = map[string]OperationConfig{
+	normKey(OpBalanceWrite): {WriteConcern: "majority"},
+}
+
+// OperationConfig overrides the section settings for one operation class.
+// Empty fields fall back to the section. The server selection timeout is a
+// client setting, but Timeout bounds the server selection of the operation
+// as well.
+type OperationConfig struct {
+	Timeout        time.Duration
+	ReadPreference string
+	WriteConcern   string
+}
+
+func (c *RepositoryConfig) operations(key string, value interface{}) {
+	classes, ok := value.(map[string]interface{})
+	if !ok {
+		c.problem(key, fmt.Errorf("setting %s must be a table", key))
+		return
+	}
+
+	names := make([]string, 0, len(classes))
+	for name := range classes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if c.Operations == nil {
+		c.Operations = make(map[string]*OperationConfig)
+	}
+	for _, name := range names {
+		settings, ok := classes[name].(map[string]interface{})
+		if !ok {
+			c.problem(key+"."+name, fmt.Errorf("setting %s.%s must be a table", key, name))
+			continue
+		}
+
+		op := &OperationConfig{}
+		for k, value := range settings {
+			path := key + "." + name + "." + k
+			switch normKey(k) {
+			case "timeout":
+				op.Timeout = c.duration(path, value)
+			case "readpreference":
+				op.ReadPreference = c.str(path, value)
+			case "writeconcern":
+				op.WriteConcern = c.writeConcern(path, value)
+			default:
+				c.problem(path, fmt.Errorf("unknown setting %s", path))
+			}
+		}
+		c.Operations[normKey(name)] = op
+	}
+}
+
+func (c *RepositoryConfig) writeConcern(key string, value interface{}) string {
+	if v, ok := value.(int64); ok {
+		return strconv.FormatInt(v, 10)
+	}
+	return c.str(key, value)
+}
+
+// Operation returns the settings of class: the section settings, overridden
+// by the defaults of the class and then by [operations.<class>].
+func (c *RepositoryConfig) Operation(class string) OperationConfig {
+	op := OperationConfig{
+		Timeout:        c.Timeout,
+		ReadPreference: c.ReadPreference,
+		WriteConcern:   c.WriteConcern,
+	}
+
+	overrides := []OperationConfig{defaultOperations[normKey(class)]}
+	if configured, ok := c.Operations[normKey(class)]; ok && configured != nil {
+		overrides = append(overrides, *configured)
+	}
+	for _, o := range overrides {
+		if o.Timeout > 0 {
+			op.Timeout = o.Timeout
+		}
+		if o.ReadPreference != "" {
+			op.ReadPreference = o.ReadPreference
+		}
+		if o.WriteConcern != "" {
+			op.WriteConcern = o.WriteConcern
+		}
+	}
+
+	return op
+}
+
+// Collection returns col with the read preference and write concern of class
+// and a context bounded by its timeout. The caller must call cancel once the
+// operation, including the iteration of a returned cursor, is done.
+func (c *RepositoryConfig) Collection(col *mongo.Collection, class string) (*mongo.Collection, context.Context, context.CancelFunc) {
+	op := c.Operation(class)
+
+	opts := options.Collection()
+	if rp := readPreference(op.ReadPreference); rp != nil {
+		opts.SetReadPreference(rp)
+	}
+	if wc := writeConcern(op.WriteConcern); wc != nil {
+		opts.SetWriteConcern(wc)
+	}
+	if opts.ReadPreference != nil || opts.WriteConcern != nil {
+		if clone, err := col.Clone(opts); err == nil {
+			col = clone
+		}
+	}
+
+	if op.Timeout > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), op.Timeout)
+		return col, ctx, cancel
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return col, ctx, cancel
+}
+
+func (o *OperationConfig) validate() []error {
+	var errs []error
+
+	if o.ReadPreference != "" {
+		if _, err := readpref.ModeFromString(o.ReadPreference); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if n, err := strconv.Atoi(o.WriteConcern); err == nil && n < 0 {
+		errs = append(errs, fmt.Errorf("write concern %d must not be negative", n))
+	}
+
+	return errs
+}
+
+func readPreference(mode string) *readpref.ReadPref {
+	m, err := readpref.ModeFromString(mode)
+	if err != nil {
+		return nil
+	}
+	rp, err := readpref.New(m)
+	if err != nil {
+		return nil
+	}
+	return rp
+}
+
+func writeConcern(w string) *writeconcern.WriteConcern {
+	if w == "" {
+		return nil
+	}
+	if n, err := strconv.Atoi(w); err == nil {
+		return &writeconcern.WriteConcern{W: n}
+	}
+	return &writeconcern.WriteConcern{W: w}
+}
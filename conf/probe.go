@@ -0,0 +1,51 @@
+package conf
+
+import (
+	"fmt"
+	"time"
+)
+
+// ProbeConfig configures the key health prober under [Keys.Probe].
+type ProbeConfig struct {
+	// Interval is the time between two rounds of probes. The prober does not
+	// run when it is zero.
+	Interval Duration
+	// Timeout is how long a probe may take. Defaults to 10s.
+	Timeout Duration
+	// MinSuccess is the success rate, between 0 and 1, from which an expired
+	// key that answered its last probe is used again. Defaults to 0.5.
+	MinSuccess float64
+}
+
+func (p ProbeConfig) IntervalDuration() time.Duration {
+	return time.Duration(p.Interval)
+}
+
+func (p ProbeConfig) TimeoutDuration() time.Duration {
+	if p.Timeout <= 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(p.Timeout)
+}
+
+// Healthy returns MinSuccess or its default.
+func (p ProbeConfig) Healthy() float64 {
+	if p.MinSuccess <= 0 {
+		return 0.5
+	}
+	return p.MinSuccess
+}
+
+func (p ProbeConfig) validate() []error {
+	var errs []error
+	if p.Interval < 0 {
+		errs = append(errs, fmt.Errorf("interval %v must not be negative", time.Duration(p.Interval)))
+	}
+	if p.Timeout < 0 {
+		errs = append(errs, fmt.Errorf("timeout %v must not be negative", time.Duration(p.Timeout)))
+	}
+	if p.MinSuccess < 0 || p.MinSuccess > 1 {
+		errs = append(errs, fmt.Errorf("minSuccess %v must be between 0 and 1", p.MinSuccess))
+	}
+	return errs
+}
@@ -0,0 +1,55 @@
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ProviderConfig defines an RPC or API provider under
+// [Keys.Providers.<name>], next to the ones built into the key package.
+type ProviderConfig struct {
+	// URL is the endpoint template, see key.Provider.
+	URL string
+	// Auth is path (default), query, header, jwt or none.
+	Auth string
+	// Param is the query parameter or header carrying the key.
+	Param  string
+	Prefix string
+	// Chains maps the supported chain ids to their name in URL; all chains
+	// are supported when it is empty.
+	Chains   map[string]string
+	PerChain bool
+	// Probe is how the health prober checks a key: rpc (default) calls
+	// eth_chainId, none skips the keys of the provider and a path starting
+	// with / is fetched from URL with the key.
+	Probe string
+}
+
+func (p ProviderConfig) validate() []error {
+	var errs []error
+
+	switch strings.ToLower(p.Auth) {
+	case "", "path", "jwt", "none":
+	case "query", "header":
+		if p.Param == "" {
+			errs = append(errs, fmt.Errorf("%s auth requires param", strings.ToLower(p.Auth)))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown auth %q", p.Auth))
+	}
+	switch probe := strings.ToLower(p.Probe); {
+	case probe == "", probe == "rpc", probe == "none":
+	case strings.HasPrefix(probe, "/"):
+		if p.URL == "" {
+			errs = append(errs, errors.New("probe path requires url"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown probe %q", p.Probe))
+	}
+	if strings.Contains(p.URL, "{chain}") && len(p.Chains) == 0 {
+		errs = append(errs, errors.New("url uses {chain} but no chains are named"))
+	}
+
+	return errs
+}
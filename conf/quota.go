@@ -0,0 +1,81 @@
+package conf
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// QuotaConfig is the quota of every key of a provider, configured under
+// [Keys.Quotas.<cate>]. Limits left at zero are not enforced.
+type QuotaConfig struct {
+	CallsPerMinute int64
+	CallsPerDay    int64
+	UnitsPerMinute int64
+	UnitsPerDay    int64
+
+	// Units is the compute units charged per RPC method. Methods not listed
+	// cost DefaultUnits, or 1 if that is not set either.
+	Units        map[string]int64
+	DefaultUnits int64
+
+	// Threshold is the share of a limit, between 0 and 1, from which a key is
+	// only used while no other key of its pool is below it. Defaults to 0.9.
+	Threshold float64
+
+	// Backoff is how long a key rests after a rate-limit error that does not
+	// say how long to wait. Defaults to a minute.
+	Backoff Duration
+}
+
+// Cost returns the compute units charged for method.
+func (q QuotaConfig) Cost(method string) int64 {
+	if units, ok := q.Units[method]; ok {
+		return units
+	}
+	if q.DefaultUnits > 0 {
+		return q.DefaultUnits
+	}
+	return 1
+}
+
+// BackoffDuration returns Backoff, or its default when it is not set.
+func (q QuotaConfig) BackoffDuration() time.Duration {
+	if q.Backoff <= 0 {
+		return time.Minute
+	}
+	return time.Duration(q.Backoff)
+}
+
+// Share returns Threshold, or its default when it is not set.
+func (q QuotaConfig) Share() float64 {
+	if q.Threshold <= 0 {
+		return 0.9
+	}
+	return q.Threshold
+}
+
+func (q QuotaConfig) validate() []error {
+	var errs []error
+
+	for name, limit := range map[string]int64{
+		"callsPerMinute": q.CallsPerMinute,
+		"callsPerDay":    q.CallsPerDay,
+		"unitsPerMinute": q.UnitsPerMinute,
+		"unitsPerDay":    q.UnitsPerDay,
+		"defaultUnits":   q.DefaultUnits,
+	} {
+		if limit < 0 {
+			errs = append(errs, fmt.Errorf("%s %d must not be negative", name, limit))
+		}
+	}
+	if q.Threshold < 0 || q.Threshold > 1 {
+		errs = append(errs, fmt.Errorf("threshold %v must be between 0 and 1", q.Threshold))
+	}
+	if q.Backoff < 0 {
+		errs = append(errs, fmt.Errorf("backoff %v must not be negative", time.Duration(q.Backoff)))
+	}
+
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return errs
+}
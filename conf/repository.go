@@ -0,0 +1,347 @@
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RepositoryConfig is one [Repositories.<name>] section. Keys are matched case
+// insensitively and without underscores, so existing files using datasource,
+// db, username and pass keep working. Durations are either a Go duration
+// string ("5s") or a number of seconds.
+type RepositoryConfig struct {
+	Datasource string
+	DB         string
+	Username   string
+	Pass       string
+
+	MaxPoolSize     uint64
+	MinPoolSize     uint64
+	MaxConnIdleTime time.Duration
+
+	ConnectTimeout         time.Duration
+	ServerSelectionTimeout time.Duration
+	Timeout                time.Duration
+
+	TLS TLSConfig
+
+	// ReadPreference is one of primary, primaryPreferred, secondary,
+	// secondaryPreferred or nearest.
+	ReadPreference string
+	// WriteConcern is "majority", a number of nodes or a tag set name.
+	WriteConcern string
+	AppName      string
+
+	// Operations tunes classes of operations, see OperationConfig. Keys are
+	// normalized like setting names.
+	Operations map[string]*OperationConfig
+
+	// Extra holds keys that are not part of RepositoryConfig, for repositories
+	// registered outside this module.
+	Extra map[string]interface{}
+
+	problems []problem
+}
+
+// problem is a setting that failed to decode. key is its path in the section.
+type problem struct {
+	key string
+	err error
+}
+
+type TLSConfig struct {
+	Enabled            bool
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	InsecureSkipVerify bool
+}
+
+// UnmarshalTOML decodes a repository section without failing on wrong types;
+// type problems are kept and reported by Validate so that all of them show up
+// at once, unless the environment overrides the setting. Unknown keys close to
+// a setting are reported as typos, the others are kept in Extra.
+func (c *RepositoryConfig) UnmarshalTOML(decode func(interface{}) error) error {
+	raw := make(map[string]interface{})
+	if err := decode(&raw); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(raw))
+	for key := range raw {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := raw[key]
+		switch normKey(key) {
+		case "datasource":
+			c.Datasource = c.str(key, value)
+		case "db":
+			c.DB = c.str(key, value)
+		case "username":
+			c.Username = c.str(key, value)
+		case "pass", "password":
+			c.Pass = c.str(key, value)
+		case "maxpoolsize":
+			c.MaxPoolSize = c.uint(key, value)
+		case "minpoolsize":
+			c.MinPoolSize = c.uint(key, value)
+		case "maxconnidletime":
+			c.MaxConnIdleTime = c.duration(key, value)
+		case "connecttimeout":
+			c.ConnectTimeout = c.duration(key, value)
+		case "serverselectiontimeout":
+			c.ServerSelectionTimeout = c.duration(key, value)
+		case "timeout":
+			c.Timeout = c.duration(key, value)
+		case "tls":
+			c.tls(key, value)
+		case "readpreference":
+			c.ReadPreference = c.str(key, value)
+		case "writeconcern":
+			c.WriteConcern = c.writeConcern(key, value)
+		case "operations":
+			c.operations(key, value)
+		case "appname":
+			c.AppName = c.str(key, value)
+		default:
+			if known := closestSetting(key); known != "" {
+				c.problem(key, fmt.Errorf("unknown setting %s, did you mean %s?", key, known))
+				continue
+			}
+			if c.Extra == nil {
+				c.Extra = make(map[string]interface{})
+			}
+			c.Extra[key] = value
+		}
+	}
+
+	return nil
+}
+
+// ExtraKeys returns the sorted keys of Extra. Repositories of this module
+// ignore them, so they are likely settings of an older or newer version.
+func (c *RepositoryConfig) ExtraKeys() []string {
+	keys := make([]string, 0, len(c.Extra))
+	for key := range c.Extra {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (c *RepositoryConfig) problem(key string, err error) {
+	c.problems = append(c.problems, problem{key: key, err: err})
+}
+
+// dropOverridden forgets the problems of the settings the environment sets
+// under prefix, as the values that failed to decode are replaced.
+func (c *RepositoryConfig) dropOverridden(prefix string) error {
+	kept := c.problems[:0]
+	for _, p := range c.problems {
+		parts := []string{prefix}
+		for _, part := range strings.Split(p.key, ".") {
+			if part = normKey(part); part == "password" {
+				part = "pass"
+			}
+			parts = append(parts, part)
+		}
+		_, ok, err := lookupEnv(envName(parts...))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			kept = append(kept, p)
+		}
+	}
+	c.problems = kept
+	return nil
+}
+
+// settings are the normalized keys of RepositoryConfig.
+var settings = []string{
+	"datasource", "db", "username", "pass", "password",
+	"maxpoolsize", "minpoolsize", "maxconnidletime",
+	"connecttimeout", "serverselectiontimeout", "timeout",
+	"tls", "readpreference", "writeconcern", "operations", "appname",
+}
+
+// closestSetting returns the setting key is most likely a typo of, or "" if
+// it is too far from all of them to be one.
+func closestSetting(key string) string {
+	key = normKey(key)
+	best, bestDistance := "", 3
+	for _, setting := range settings {
+		if d := distance(key, setting); d < bestDistance && d < len(setting)/3+1 {
+			best, bestDistance = setting, d
+		}
+	}
+	return best
+}
+
+// distance is the Levenshtein distance between a and b.
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func (c *RepositoryConfig) tls(key string, value interface{}) {
+	switch v := value.(type) {
+	case bool:
+		c.TLS.Enabled = v
+	case map[string]interface{}:
+		c.TLS.Enabled = true
+		for k, value := range v {
+			switch normKey(k) {
+			case "enabled":
+				c.TLS.Enabled = c.bool(key+"."+k, value)
+			case "cafile":
+				c.TLS.CAFile = c.str(key+"."+k, value)
+			case "certfile":
+				c.TLS.CertFile = c.str(key+"."+k, value)
+			case "keyfile":
+				c.TLS.KeyFile = c.str(key+"."+k, value)
+			case "insecureskipverify":
+				c.TLS.InsecureSkipVerify = c.bool(key+"."+k, value)
+			default:
+				c.problem(key+"."+k, fmt.Errorf("unknown setting %s.%s", key, k))
+			}
+		}
+	default:
+		c.problem(key, fmt.Errorf("setting %s must be a boolean or a table", key))
+	}
+}
+
+func (c *RepositoryConfig) str(key string, value interface{}) string {
+	v, ok := value.(string)
+	if !ok {
+		c.problem(key, fmt.Errorf("setting %s must be a string", key))
+	}
+	return v
+}
+
+func (c *RepositoryConfig) bool(key string, value interface{}) bool {
+	v, ok := value.(bool)
+	if !ok {
+		c.problem(key, fmt.Errorf("setting %s must be a boolean", key))
+	}
+	return v
+}
+
+func (c *RepositoryConfig) uint(key string, value interface{}) uint64 {
+	v, ok := value.(int64)
+	if !ok || v < 0 {
+		c.problem(key, fmt.Errorf("setting %s must be a non-negative integer", key))
+		return 0
+	}
+	return uint64(v)
+}
+
+func (c *RepositoryConfig) duration(key string, value interface{}) time.Duration {
+	if d, ok := parseDuration(value); ok {
+		return d
+	}
+	c.problem(key, fmt.Errorf("setting %s must be a non-negative duration", key))
+	return 0
+}
+
+func normKey(key string) string {
+	return strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(key))
+}
+
+// Validate reports every problem of the section at once.
+func (c *RepositoryConfig) Validate() error {
+	return errors.Join(c.validate()...)
+}
+
+func (c *RepositoryConfig) validate() []error {
+	var errs []error
+	for _, p := range c.problems {
+		errs = append(errs, p.err)
+	}
+
+	if c.Datasource == "" {
+		errs = append(errs, errors.New("missing setting datasource"))
+	} else if !strings.HasPrefix(c.Datasource, "mongodb://") && !strings.HasPrefix(c.Datasource, "mongodb+srv://") {
+		errs = append(errs, fmt.Errorf("datasource %q is not a mongodb:// or mongodb+srv:// URI", c.Datasource))
+	}
+	if c.DB == "" {
+		errs = append(errs, errors.New("missing setting db"))
+	}
+	if c.Pass != "" && c.Username == "" {
+		errs = append(errs, errors.New("pass is set without username"))
+	}
+	if c.MaxPoolSize > 0 && c.MinPoolSize > c.MaxPoolSize {
+		errs = append(errs, fmt.Errorf("minPoolSize %d is larger than maxPoolSize %d", c.MinPoolSize, c.MaxPoolSize))
+	}
+
+	section := OperationConfig{ReadPreference: c.ReadPreference, WriteConcern: c.WriteConcern}
+	errs = append(errs, section.validate()...)
+
+	classes := make([]string, 0, len(c.Operations))
+	for class := range c.Operations {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	for _, class := range classes {
+		if c.Operations[class] == nil {
+			continue
+		}
+		for _, err := range c.Operations[class].validate() {
+			errs = append(errs, fmt.Errorf("operations.%s: %w", class, err))
+		}
+	}
+
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		errs = append(errs, errors.New("tls certFile and keyFile must be set together"))
+	}
+	for _, file := range []string{c.TLS.CAFile, c.TLS.CertFile, c.TLS.KeyFile} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			errs = append(errs, fmt.Errorf("tls file: %w", err))
+		}
+	}
+
+	return errs
+}
+
+// DatabaseOptions returns the read preference and write concern of the
+// section, which are applied per database so repositories sharing a client
+// can still use their own.
+func (c *RepositoryConfig) DatabaseOptions() *options.DatabaseOptions {
+	opts := options.Database()
+
+	if rp := readPreference(c.ReadPreference); rp != nil {
+		opts.SetReadPreference(rp)
+	}
+	if wc := writeConcern(c.WriteConcern); wc != nil {
+		opts.SetWriteConcern(wc)
+	}
+
+	return opts
+}
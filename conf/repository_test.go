@@ -0,0 +1,223 @@
+package conf
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/naoina/toml"
+)
+
+func decodeRepository(t *testing.T, section string) *RepositoryConfig {
+	t.Helper()
+	var c struct {
+		Repositories map[string]*RepositoryConfig
+	}
+	if err := toml.Unmarshal([]byte("[Repositories.test]\n"+section), &c); err != nil {
+		t.Fatal(err)
+	}
+	return c.Repositories["test"]
+}
+
+func TestRepositoryConfigDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		section string
+		want    func(c *RepositoryConfig) bool
+	}{
+		{
+			name:    "legacy keys",
+			section: "datasource = \"mongodb://localhost\"\ndb = \"market\"\nusername = \"user\"\npass = \"secret\"\n",
+			want: func(c *RepositoryConfig) bool {
+				return c.Datasource == "mongodb://localhost" && c.DB == "market" && c.Username == "user" && c.Pass == "secret"
+			},
+		},
+		{
+			name:    "keys ignore case and separators",
+			section: "DataSource = \"mongodb://localhost\"\nmax_pool_size = 20\nMin-Pool-Size = 2\npassword = \"secret\"\n",
+			want: func(c *RepositoryConfig) bool {
+				return c.Datasource == "mongodb://localhost" && c.MaxPoolSize == 20 && c.MinPoolSize == 2 && c.Pass == "secret"
+			},
+		},
+		{
+			name:    "durations as strings or seconds",
+			section: "connectTimeout = \"1500ms\"\ntimeout = 30\nmaxConnIdleTime = \"2m\"\n",
+			want: func(c *RepositoryConfig) bool {
+				return c.ConnectTimeout == 1500*time.Millisecond && c.Timeout == 30*time.Second && c.MaxConnIdleTime == 2*time.Minute
+			},
+		},
+		{
+			name:    "write concern as a number",
+			section: "writeConcern = 2\n",
+			want:    func(c *RepositoryConfig) bool { return c.WriteConcern == "2" },
+		},
+		{
+			name:    "tls as a boolean",
+			section: "tls = true\n",
+			want:    func(c *RepositoryConfig) bool { return c.TLS.Enabled && c.TLS.CAFile == "" },
+		},
+		{
+			name:    "tls as a table",
+			section: "[Repositories.test.tls]\ncaFile = \"ca.pem\"\ninsecure_skip_verify = true\n",
+			want: func(c *RepositoryConfig) bool {
+				return c.TLS.Enabled && c.TLS.CAFile == "ca.pem" && c.TLS.InsecureSkipVerify
+			},
+		},
+		{
+			name:    "unknown keys kept in extra",
+			section: "collection = \"orders\"\n",
+			want:    func(c *RepositoryConfig) bool { return c.Extra["collection"] == "orders" },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if c := decodeRepository(t, tt.section); !tt.want(c) {
+				t.Errorf("decoded %+v", c)
+			}
+		})
+	}
+}
+
+func TestRepositoryConfigValidate(t *testing.T) {
+	const valid = "datasource = \"mongodb://localhost\"\ndb = \"market\"\n"
+
+	tests := []struct {
+		name    string
+		section string
+		errs    []string
+	}{
+		{
+			name:    "valid",
+			section: valid,
+		},
+		{
+			name:    "srv datasource",
+			section: "datasource = \"mongodb+srv://cluster.example.com\"\ndb = \"market\"\n",
+		},
+		{
+			name:    "empty section",
+			section: "",
+			errs:    []string{"missing setting datasource", "missing setting db"},
+		},
+		{
+			name:    "not a mongodb uri",
+			section: "datasource = \"http://localhost\"\ndb = \"market\"\n",
+			errs:    []string{"is not a mongodb:// or mongodb+srv:// URI"},
+		},
+		{
+			name:    "every type problem at once",
+			section: valid + "username = 1\nmaxPoolSize = \"many\"\ntimeout = \"soon\"\ntls = \"yes\"\n",
+			errs: []string{
+				"setting username must be a string",
+				"setting maxPoolSize must be a non-negative integer",
+				"setting timeout must be a non-negative duration",
+				"setting tls must be a boolean or a table",
+			},
+		},
+		{
+			name:    "negative duration",
+			section: valid + "connectTimeout = -1\n",
+			errs:    []string{"setting connectTimeout must be a non-negative duration"},
+		},
+		{
+			name:    "pass without username",
+			section: valid + "pass = \"secret\"\n",
+			errs:    []string{"pass is set without username"},
+		},
+		{
+			name:    "pool sizes swapped",
+			section: valid + "maxPoolSize = 2\nminPoolSize = 5\n",
+			errs:    []string{"minPoolSize 5 is larger than maxPoolSize 2"},
+		},
+		{
+			name:    "unknown read preference",
+			section: valid + "readPreference = \"closest\"\n",
+			errs:    []string{"closest"},
+		},
+		{
+			name:    "negative write concern",
+			section: valid + "writeConcern = -1\n",
+			errs:    []string{"write concern -1 must not be negative"},
+		},
+		{
+			name:    "tls cert without key",
+			section: valid + "[Repositories.test.tls]\ncertFile = \"cert.pem\"\n",
+			errs:    []string{"tls certFile and keyFile must be set together", "tls file:"},
+		},
+		{
+			name:    "likely typo",
+			section: valid + "maxPoolSise = 10\n",
+			errs:    []string{"unknown setting maxPoolSise, did you mean maxpoolsize?"},
+		},
+		{
+			name:    "unknown tls setting",
+			section: valid + "[Repositories.test.tls]\nca = \"ca.pem\"\n",
+			errs:    []string{"unknown setting tls.ca"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := decodeRepository(t, tt.section).Validate()
+			if len(tt.errs) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("no error, want %q", tt.errs)
+			}
+			for _, want := range tt.errs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not report %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled []string
+		want    string
+	}{
+		{
+			name: "every repository",
+			want: "repository farmDB: empty section\nrepository vaultDB: missing setting db",
+		},
+		{
+			name:    "enabled repositories only",
+			enabled: []string{"marketDB", "vaultDB"},
+			want:    "repository vaultDB: missing setting db",
+		},
+		{
+			name:    "disabled repositories not checked",
+			enabled: []string{"marketDB"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Config{Repositories: map[string]*RepositoryConfig{
+				"marketDB": decodeRepository(t, "datasource = \"mongodb://localhost\"\ndb = \"market\"\n"),
+				"vaultDB":  decodeRepository(t, "datasource = \"mongodb://localhost\"\n"),
+				"farmDB":   nil,
+			}}
+			c.Common.Repositories = tt.enabled
+
+			err := c.Validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("error = %q, want none", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
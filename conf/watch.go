@@ -0,0 +1,198 @@
+package conf
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/coinmeca/go-common/commonlog"
+	"go.uber.org/zap"
+)
+
+// Event is published by Watcher when a reloadable setting changes.
+type Event interface {
+	event()
+}
+
+// ChainsChanged is published when Config.Chains changes.
+type ChainsChanged struct {
+	Old, New []string
+}
+
+// VerbosityChanged is published when Log.Terminal or Log.File verbosity
+// changes.
+type VerbosityChanged struct {
+	Terminal, File int
+}
+
+// StartBlockChanged is published per chain when Log.Block[chainId].StartBlock
+// changes. Old is 0 for a chain that was added, New is 0 for one that was
+// removed.
+type StartBlockChanged struct {
+	ChainId  string
+	Old, New int
+}
+
+func (ChainsChanged) event()     {}
+func (VerbosityChanged) event()  {}
+func (StartBlockChanged) event() {}
+
+// Watcher reloads a config file when it changes and publishes the changes of
+// the reloadable settings to its subscribers. A file that fails to load or
+// validate is logged and ignored, the previous config stays active. The file
+// is polled rather than watched, which also follows the symlink swaps used by
+// Kubernetes config maps.
+type Watcher struct {
+	file     string
+	interval time.Duration
+
+	lock    sync.RWMutex
+	current *Config
+	sum     [sha256.Size]byte
+	subs    map[int]func(Event)
+	nextSub int
+}
+
+// NewWatcher returns a watcher for file, starting from the already loaded
+// config c.
+func NewWatcher(file string, c *Config, interval time.Duration) *Watcher {
+	w := &Watcher{
+		file:     file,
+		interval: interval,
+		current:  c,
+		subs:     make(map[int]func(Event)),
+	}
+	if content, err := os.ReadFile(file); err == nil {
+		w.sum = sha256.Sum256(content)
+	}
+	return w
+}
+
+// Config returns the config that is currently active.
+func (w *Watcher) Config() *Config {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	return w.current
+}
+
+// Subscribe registers fn for every published event. Events are delivered on
+// the watcher goroutine in the order they are detected.
+func (w *Watcher) Subscribe(fn func(Event)) (unsubscribe func()) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	id := w.nextSub
+	w.nextSub++
+	w.subs[id] = fn
+
+	return func() {
+		w.lock.Lock()
+		defer w.lock.Unlock()
+		delete(w.subs, id)
+	}
+}
+
+// Run polls the file until ctx is done.
+func (w *Watcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := w.Reload(); err != nil {
+				commonlog.Logger.Error("Watcher",
+					zap.String("file", w.file),
+					zap.String("reload failed", err.Error()),
+				)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Reload loads the file if its content changed and publishes the changes.
+// Environment overrides are applied again, as NewConfig does.
+func (w *Watcher) Reload() error {
+	content, err := os.ReadFile(w.file)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(content)
+	w.lock.RLock()
+	unchanged := bytes.Equal(sum[:], w.sum[:])
+	w.lock.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	next, err := NewConfig(w.file)
+	if err != nil {
+		// remember the broken content so it is reported once, not on every poll
+		w.lock.Lock()
+		w.sum = sum
+		w.lock.Unlock()
+		return err
+	}
+
+	w.lock.Lock()
+	prev := w.current
+	w.current = next
+	w.sum = sum
+	subs := make([]func(Event), 0, len(w.subs))
+	ids := make([]int, 0, len(w.subs))
+	for id := range w.subs {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		subs = append(subs, w.subs[id])
+	}
+	w.lock.Unlock()
+
+	for _, event := range diff(prev, next) {
+		for _, fn := range subs {
+			fn(event)
+		}
+	}
+	return nil
+}
+
+func diff(prev, next *Config) []Event {
+	events := make([]Event, 0)
+
+	if !slices.Equal(prev.Chains, next.Chains) {
+		events = append(events, ChainsChanged{Old: prev.Chains, New: next.Chains})
+	}
+
+	if prev.Log.Terminal.Verbosity != next.Log.Terminal.Verbosity || prev.Log.File.Verbosity != next.Log.File.Verbosity {
+		events = append(events, VerbosityChanged{Terminal: next.Log.Terminal.Verbosity, File: next.Log.File.Verbosity})
+	}
+
+	chains := make([]string, 0, len(prev.Log.Block)+len(next.Log.Block))
+	for chainId := range prev.Log.Block {
+		chains = append(chains, chainId)
+	}
+	for chainId := range next.Log.Block {
+		if _, ok := prev.Log.Block[chainId]; !ok {
+			chains = append(chains, chainId)
+		}
+	}
+	sort.Strings(chains)
+
+	for _, chainId := range chains {
+		before, after := prev.Log.Block[chainId].StartBlock, next.Log.Block[chainId].StartBlock
+		if before != after {
+			events = append(events, StartBlockChanged{ChainId: chainId, Old: before, New: after})
+		}
+	}
+
+	return events
+}
@@ -43,6 +43,8 @@ func (c *ContractDB) SaveCheckpoint(chainId *string, blockNumber *big.Int) error
 	return nil
 }
 
+// GetCheckpoint returns the head checkpoint of chainId, which may include
+// blocks that are not final yet; see GetFinalizedCheckpoint.
 func (c *ContractDB) GetCheckpoint(chainId *string) *big.Int {
 	chain := c.GetChain(chainId)
 	if chain == nil || chain.Checkpoint == 0 {
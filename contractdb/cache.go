@@ -0,0 +1,351 @@
+package contractdb
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coinmeca/go-common/commondatabase"
+	"github.com/coinmeca/go-common/commonlog"
+	"github.com/coinmeca/go-common/commonprotocol"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// contractCache holds every contract of the contract collection with the
+// parsed ABI of each version, indexed by name, by chain and name and by chain
+// and address, old deployments included. Versions with the same ABI share one
+// parsed instance.
+type contractCache struct {
+	lock      sync.RWMutex
+	loaded    time.Time
+	contracts []*cachedContract
+	names     map[string]*cachedContract
+	chains    map[string]*cachedContract
+	addresses map[string]*commonprotocol.Contract
+	abis      map[[32]byte]*abi.ABI
+}
+
+func newContractCache() *contractCache {
+	return &contractCache{
+		names:     make(map[string]*cachedContract),
+		chains:    make(map[string]*cachedContract),
+		addresses: make(map[string]*commonprotocol.Contract),
+		abis:      make(map[[32]byte]*abi.ABI),
+	}
+}
+
+func chainKey(chainId, name string) string {
+	return chainId + "/" + name
+}
+
+func addressKey(chainId, address string) string {
+	return chainId + "/" + strings.ToLower(address)
+}
+
+// parse returns the contract of doc with every version, reusing the parsed
+// ABIs of the cache.
+func (cache *contractCache) parse(doc *contractDocument) (*cachedContract, error) {
+	current, err := cache.contract(&doc.Contract, doc.Address, doc.Abi)
+	if err != nil {
+		return nil, err
+	}
+
+	cc := &cachedContract{Contract: current}
+	for _, v := range doc.Versions {
+		contract, err := cache.contract(&doc.Contract, v.Address, v.Abi)
+		if err != nil {
+			return nil, fmt.Errorf("version %d: %w", v.Version, err)
+		}
+		cc.versions = append(cc.versions, &cachedVersion{ContractVersion: v, contract: contract})
+	}
+	return cc, nil
+}
+
+func (cache *contractCache) contract(temp *commondatabase.Contract, address string, rawAbi *[]map[string]interface{}) (*commonprotocol.Contract, error) {
+	raw, err := json.Marshal(rawAbi)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(raw)
+
+	cache.lock.RLock()
+	parsed, ok := cache.abis[sum]
+	cache.lock.RUnlock()
+
+	if !ok {
+		result, err := abi.JSON(strings.NewReader(string(raw)))
+		if err != nil {
+			return nil, err
+		}
+		parsed = &result
+
+		cache.lock.Lock()
+		if existing, ok := cache.abis[sum]; ok {
+			parsed = existing
+		} else {
+			cache.abis[sum] = parsed
+		}
+		cache.lock.Unlock()
+	}
+
+	return &commonprotocol.Contract{
+		Id:        temp.Id,
+		ChainId:   temp.ChainId,
+		ServiceId: temp.ServiceId,
+		Cate:      temp.Cate,
+		Name:      temp.Name,
+		Address:   address,
+		Abi:       parsed,
+	}, nil
+}
+
+// replace makes contracts the content of the cache.
+func (cache *contractCache) replace(contracts []*cachedContract) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	cache.contracts = nil
+	cache.names = make(map[string]*cachedContract, len(contracts))
+	cache.chains = make(map[string]*cachedContract, len(contracts))
+	cache.addresses = make(map[string]*commonprotocol.Contract, len(contracts))
+	for _, cc := range contracts {
+		cache.index(cc)
+	}
+
+	// ABIs no contract uses any more are dropped
+	used := make(map[*abi.ABI]bool, len(contracts))
+	for _, cc := range contracts {
+		used[cc.Abi] = true
+		for _, v := range cc.versions {
+			used[v.contract.Abi] = true
+		}
+	}
+	for sum, parsed := range cache.abis {
+		if !used[parsed] {
+			delete(cache.abis, sum)
+		}
+	}
+
+	cache.loaded = time.Now()
+}
+
+// put adds a contract read outside of a reload.
+func (cache *contractCache) put(cc *cachedContract) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	if cached, ok := cache.chains[chainKey(cc.ChainId, cc.Name)]; ok && cached.Id == cc.Id {
+		return
+	}
+	cache.index(cc)
+}
+
+// index adds cc to the cache, in place of the contract of the same chain and
+// name.
+func (cache *contractCache) index(cc *cachedContract) {
+	if old, ok := cache.chains[chainKey(cc.ChainId, cc.Name)]; ok {
+		cache.unindex(old)
+		cache.contracts[slices.Index(cache.contracts, old)] = cc
+	} else {
+		cache.contracts = append(cache.contracts, cc)
+	}
+
+	if _, ok := cache.names[cc.Name]; !ok {
+		cache.names[cc.Name] = cc
+	}
+	cache.chains[chainKey(cc.ChainId, cc.Name)] = cc
+	for _, v := range cc.versions {
+		cache.addresses[addressKey(cc.ChainId, v.Address)] = v.contract
+	}
+	if cc.Address != "" {
+		cache.addresses[addressKey(cc.ChainId, cc.Address)] = cc.Contract
+	}
+}
+
+// unindex drops the name and addresses of cc from the cache.
+func (cache *contractCache) unindex(cc *cachedContract) {
+	if cache.names[cc.Name] == cc {
+		delete(cache.names, cc.Name)
+	}
+	for _, v := range cc.versions {
+		if cache.addresses[addressKey(cc.ChainId, v.Address)] == v.contract {
+			delete(cache.addresses, addressKey(cc.ChainId, v.Address))
+		}
+	}
+	if cache.addresses[addressKey(cc.ChainId, cc.Address)] == cc.Contract {
+		delete(cache.addresses, addressKey(cc.ChainId, cc.Address))
+	}
+}
+
+// ready reports whether the cache holds the whole collection.
+func (cache *contractCache) ready() bool {
+	cache.lock.RLock()
+	defer cache.lock.RUnlock()
+	return !cache.loaded.IsZero()
+}
+
+func (cache *contractCache) byName(name string) (*cachedContract, bool) {
+	cache.lock.RLock()
+	defer cache.lock.RUnlock()
+	cc, ok := cache.names[name]
+	return cc, ok
+}
+
+func (cache *contractCache) byChain(chainId, name string) (*cachedContract, bool) {
+	cache.lock.RLock()
+	defer cache.lock.RUnlock()
+	cc, ok := cache.chains[chainKey(chainId, name)]
+	return cc, ok
+}
+
+func (cache *contractCache) byAddress(chainId, address string) (*commonprotocol.Contract, bool) {
+	cache.lock.RLock()
+	defer cache.lock.RUnlock()
+	contract, ok := cache.addresses[addressKey(chainId, address)]
+	return contract, ok
+}
+
+// addressesOn returns the address of every contract version on chainId.
+func (cache *contractCache) addressesOn(chainId string) []string {
+	cache.lock.RLock()
+	defer cache.lock.RUnlock()
+
+	result := make([]string, 0)
+	prefix := addressKey(chainId, "")
+	for key := range cache.addresses {
+		if address, ok := strings.CutPrefix(key, prefix); ok {
+			result = append(result, address)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// list returns a copy of the version in use of the cached contracts that
+// match.
+func (cache *contractCache) list(match func(contract *commonprotocol.Contract) bool) []*commonprotocol.Contract {
+	cache.lock.RLock()
+	defer cache.lock.RUnlock()
+
+	result := make([]*commonprotocol.Contract, 0)
+	for _, cc := range cache.contracts {
+		if match == nil || match(cc.Contract) {
+			copied := *cc.Contract
+			result = append(result, &copied)
+		}
+	}
+	return result
+}
+
+// cached reports whether contracts are served from the cache.
+func (c *ContractDB) cached() bool {
+	return c.conf.ContractCache.Sync != "off" && c.contracts.ready()
+}
+
+// ReloadContracts reads the whole contract collection into the cache.
+// Contracts whose ABI does not parse are left out.
+func (c *ContractDB) ReloadContracts(ctx context.Context) error {
+	cursor, err := c.ColContract.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	contracts := make([]*cachedContract, 0)
+	for cursor.Next(ctx) {
+		doc := &contractDocument{}
+		if err := cursor.Decode(doc); err != nil {
+			return err
+		}
+		cc, err := c.contracts.parse(doc)
+		if err != nil {
+			commonlog.Logger.Error("ReloadContracts",
+				zap.String("contract", doc.Name),
+				zap.String("chainId", doc.ChainId),
+				zap.String("abi", err.Error()),
+			)
+			continue
+		}
+		contracts = append(contracts, cc)
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	c.contracts.replace(contracts)
+	return nil
+}
+
+// cacheLoop reloads the cache on every change of the contract collection, if
+// change streams are available, and every [ContractCache.TTL].
+func (c *ContractDB) cacheLoop() {
+	defer c.workers.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-c.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	changes := make(chan struct{}, 1)
+	if c.conf.ContractCache.Sync != "poll" {
+		go c.watchContracts(ctx, changes)
+	}
+
+	ticker := time.NewTicker(c.conf.ContractCache.TTLDuration())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-changes:
+		case <-ctx.Done():
+			return
+		}
+		if err := c.ReloadContracts(ctx); err != nil && ctx.Err() == nil {
+			commonlog.Logger.Error("ReloadContracts", zap.Error(err))
+		}
+	}
+}
+
+// watchContracts signals changes of the contract collection until ctx is done
+// or the change stream fails, leaving the reloads to the TTL.
+func (c *ContractDB) watchContracts(ctx context.Context, changes chan<- struct{}) {
+	stream, err := c.ColContract.Watch(ctx, mongo.Pipeline{})
+	if err != nil {
+		if ctx.Err() == nil {
+			commonlog.Logger.Warn("watchContracts: change stream not available, reloading every ttl",
+				zap.String("error", err.Error()),
+			)
+		}
+		return
+	}
+	defer stream.Close(context.Background())
+
+	for stream.Next(ctx) {
+		select {
+		case changes <- struct{}{}:
+		default:
+			// a reload is pending already
+		}
+	}
+	if err := stream.Err(); err != nil && ctx.Err() == nil {
+		commonlog.Logger.Warn("watchContracts: change stream failed, reloading every ttl",
+			zap.String("error", err.Error()),
+		)
+	}
+}
@@ -0,0 +1,65 @@
+package contractdb
+
+import (
+	"testing"
+
+	"github.com/coinmeca/go-common/commonprotocol"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func testContract(chainId, name, address string, versions ...string) *cachedContract {
+	cc := &cachedContract{Contract: &commonprotocol.Contract{
+		Id:      primitive.NewObjectID(),
+		ChainId: chainId,
+		Name:    name,
+		Address: address,
+	}}
+	for i, address := range versions {
+		cc.versions = append(cc.versions, &cachedVersion{
+			ContractVersion: ContractVersion{Version: i + 1, Address: address},
+			contract:        &commonprotocol.Contract{ChainId: chainId, Name: name, Address: address},
+		})
+	}
+	return cc
+}
+
+func TestContractCachePut(t *testing.T) {
+	cache := newContractCache()
+	other := testContract("2", "Vault", "0xb")
+	old := testContract("1", "Vault", "0xa", "0x1")
+	cache.put(old)
+	cache.put(other)
+
+	// the same contract again is kept as it is
+	cache.put(&cachedContract{Contract: old.Contract})
+	if cc, _ := cache.byChain("1", "Vault"); cc != old {
+		t.Fatal("the same contract replaced the cached one")
+	}
+
+	// a new document for the chain and name replaces the cached one
+	redeployed := testContract("1", "Vault", "0xc", "0x2")
+	cache.put(redeployed)
+
+	if len(cache.contracts) != 2 || cache.contracts[0] != redeployed || cache.contracts[1] != other {
+		t.Errorf("contracts = %v, want the redeployed contract in place of the old one", cache.contracts)
+	}
+	if cc, _ := cache.byChain("1", "Vault"); cc != redeployed {
+		t.Errorf("byChain = %v, want the redeployed contract", cc)
+	}
+	if cc, _ := cache.byName("Vault"); cc != redeployed {
+		t.Errorf("byName = %v, want the redeployed contract", cc)
+	}
+	for _, address := range []string{"0xa", "0x1"} {
+		if _, ok := cache.byAddress("1", address); ok {
+			t.Errorf("address %s of the old contract still cached", address)
+		}
+	}
+	for _, address := range []string{"0xc", "0x2"} {
+		if _, ok := cache.byAddress("1", address); !ok {
+			t.Errorf("address %s of the redeployed contract not cached", address)
+		}
+	}
+	if _, ok := cache.byAddress("2", "0xb"); !ok {
+		t.Error("contract of another chain dropped")
+	}
+}
@@ -2,72 +2,147 @@
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"math/big"
 
+	"github.com/coinmeca/db-connector/key"
 	"github.com/coinmeca/go-common/commonlog"
+	commonrepository "github.com/coinmeca/go-common/commonrepository"
 	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/rpc"
 	"go.uber.org/zap"
 )
 
+// ContractCall runs msg with eth_call and returns its result, or nil on any
+// error. Use CallMethod to get the error, reverts included.
 func (c *ContractDB) ContractCall(ctx context.Context, chainId string, msg ethereum.CallMsg, blockNumber *big.Int) []byte {
-	ethRepo := c.GetEthRepo(chainId)
-	callResult, err := ethRepo.GetEthClient().CallContract(ctx, msg, blockNumber)
-
+	callResult, err := c.contractCall(ctx, chainId, msg, blockNumber)
 	if err != nil {
-		fmt.Println("callResult", callResult)
-		fmt.Println("callResultErr", err)
-
-		keys, err := c.key.GetNewKeys("alchemy", chainId)
-		if err != nil {
-			commonlog.Logger.Error("ContractVaultGetAll",
-				zap.String("GetNewKeys", err.Error()),
-			)
-			return nil
-		}
+		commonlog.Logger.Error("ContractCall",
+			zap.String("chainId", chainId),
+			zap.String("error", err.Error()),
+		)
+		return nil
+	}
+	return callResult
+}
 
-		for _, new := range keys {
-			ethRepo = c.GetEthRepoByKey(chainId, new)
+func (c *ContractDB) contractCall(ctx context.Context, chainId string, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	return failover(ctx, c, chainId, true, func(ctx context.Context, cate string) ([]byte, error) {
+		var callResult []byte
+		err := c.withKeys(cate, chainId, "eth_call", func(ethRepo *commonrepository.EthRepository) (err error) {
 			callResult, err = ethRepo.GetEthClient().CallContract(ctx, msg, blockNumber)
-			if err == nil {
-				c.key.SetKey("alchemy", chainId, new.Key)
-				break
-			}
-		}
+			return err
+		})
+		return callResult, err
+	})
+}
 
-		return callResult
+// Call runs the RPC method with the providers of chainId, reads sent to
+// several of them when hedging is enabled, and decodes the answer into result.
+func (c *ContractDB) Call(chainId string, result interface{}, method string, args ...interface{}) error {
+	raw, err := failover(context.Background(), c, chainId, hedgeable(method), func(ctx context.Context, cate string) (json.RawMessage, error) {
+		var raw json.RawMessage
+		// the rpc client is called directly, EthRepository.Call unwraps the
+		// error and loses rate-limit responses
+		err := c.withKeys(cate, chainId, method, func(ethRepo *commonrepository.EthRepository) error {
+			return ethRepo.GetEthClient().Client().CallContext(ctx, &raw, method, args...)
+		})
+		return raw, err
+	})
+	if err != nil || result == nil || len(raw) == 0 {
+		return err
 	}
+	return json.Unmarshal(raw, result)
+}
 
-	return callResult
+// BatchCall sends elems as one JSON-RPC batch to the providers of chainId,
+// trying the next provider if the batch as a whole fails. The errors of single
+// calls are left in their Error.
+func (c *ContractDB) BatchCall(chainId string, elems []rpc.BatchElem) error {
+	_, err := failover(context.Background(), c, chainId, false, func(ctx context.Context, cate string) (struct{}, error) {
+		err := c.withKeys(cate, chainId, "batch", func(ethRepo *commonrepository.EthRepository) error {
+			return ethRepo.GetEthClient().Client().BatchCallContext(ctx, elems)
+		})
+		return struct{}{}, err
+	})
+	return err
 }
 
-func (c *ContractDB) Call(chainId string, result interface{}, method string, args ...interface{}) error {
-	ethRepo := c.GetEthRepo(chainId)
-	err := ethRepo.Call(&result, method, args...)
+// withKeys runs call with the client of the current key of cate on chainId
+// and, if the key fails, with the other keys of the provider until one works.
+func (c *ContractDB) withKeys(cate, chainId, method string, call func(ethRepo *commonrepository.EthRepository) error) error {
+	current := c.key.GetCurrentKey(cate, chainId)
+	if current == nil {
+		return fmt.Errorf("no active %s key for chain %s", cate, chainId)
+	}
 
-	if err != nil {
-		fmt.Println("callResultErr", err)
+	err := fmt.Errorf("no %s endpoint for chain %s", cate, chainId)
+	if ethRepo := c.ethRepoFor(cate, chainId, current); ethRepo != nil {
+		c.key.RecordUsage(cate, chainId, current.Key, method)
+		err = call(ethRepo)
+	}
+	if !keyFailure(err) {
+		return err
+	}
 
-		keys, err := c.key.GetNewKeys("alchemy", chainId)
-		if err != nil {
-			commonlog.Logger.Error("Call",
-				zap.String("GetNewKeys", err.Error()),
-			)
-			return err
-		}
+	c.releaseKey(cate, chainId, current.Key, err)
 
-		for _, new := range keys {
-			ethRepo = c.GetEthRepoByKey(chainId, new)
-			err = ethRepo.Call(result, method, args...)
+	keys, kerr := c.key.GetNewKeys(cate, chainId)
+	if kerr != nil {
+		commonlog.Logger.Error("withKeys",
+			zap.String("cate", cate),
+			zap.String("GetNewKeys", kerr.Error()),
+		)
+		return err
+	}
 
-			if err == nil {
-				c.key.SetKey("alchemy", chainId, new.Key)
-				break
+	for _, new := range keys {
+		if new.Key == current.Key {
+			continue
+		}
+		ethRepo := c.ethRepoFor(cate, chainId, new)
+		if ethRepo == nil {
+			continue
+		}
+		c.key.RecordUsage(cate, chainId, new.Key, method)
+		err = call(ethRepo)
+		if !keyFailure(err) {
+			if err == nil || isRevert(err) {
+				c.key.SetKey(cate, chainId, new.Key)
 			}
+			break
 		}
-
-		return err
+		c.releaseKey(cate, chainId, new.Key, err)
 	}
 
 	return err
 }
+
+// keyFailure reports whether err may be the fault of the key it was sent
+// with: not a revert, which is the answer of the contract, and not the end of
+// the context of the caller.
+func keyFailure(err error) bool {
+	return err != nil && !isRevert(err) && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+// releaseKey takes a key out of rotation after err, as classified by the
+// provider: for the time the provider asked on a rate limit, for good when
+// the key is rejected, otherwise until the pool is filled again.
+func (c *ContractDB) releaseKey(cate, chainId, current string, err error) {
+	class, wait := key.ClassifyError(err)
+	if provider, perr := c.key.Provider(cate); perr == nil {
+		class, wait = provider.ClassifyError(err)
+	}
+
+	switch class {
+	case key.ErrorRateLimit:
+		c.key.BackoffKey(cate, chainId, current, wait)
+	case key.ErrorAuth:
+		c.key.ExpiredKey(cate, chainId, current)
+	default:
+		c.key.DropKey(cate, chainId, current)
+	}
+}
@@ -2,8 +2,10 @@
 
 import (
 	"context"
+	"slices"
 	"time"
 
+	"github.com/coinmeca/db-connector/conf"
 	"github.com/coinmeca/go-common/commondatabase"
 	"github.com/coinmeca/go-common/commonlog"
 	"go.mongodb.org/mongo-driver/bson"
@@ -61,11 +63,14 @@ func (c *ContractDB) GetChain(chainId *string) *commondatabase.Chain {
 
 func (c *ContractDB) GetTargetChains() []string {
 	now := time.Now().Unix()
+	c.chainsLock.RLock()
 	if c.chainsUpdate > (now-86400) && c.chains != nil && len(c.chains) > 0 {
+		defer c.chainsLock.RUnlock()
 		return c.chains
 	}
+	chains := slices.Clone(c.targets)
+	c.chainsLock.RUnlock()
 
-	chains := c.conf.Chains
 	if len(chains) == 0 {
 
 		chainsInfo := c.GetChains()
@@ -80,7 +85,24 @@ func (c *ContractDB) GetTargetChains() []string {
 		return nil
 	}
 
+	c.chainsLock.Lock()
 	c.chains = chains
 	c.chainsUpdate = now
+	c.chainsLock.Unlock()
 	return chains
 }
+
+// OnConfigChange replaces the configured target chains when the config is
+// reloaded. The next GetTargetChains call picks them up.
+func (c *ContractDB) OnConfigChange(event conf.Event) {
+	if e, ok := event.(conf.ChainsChanged); ok {
+		c.chainsLock.Lock()
+		c.targets = e.New
+		c.chainsUpdate = 0
+		c.chainsLock.Unlock()
+
+		commonlog.Logger.Info("OnConfigChange",
+			zap.Strings("chains", e.New),
+		)
+	}
+}
@@ -2,112 +2,116 @@
 
 import (
 	"context"
-	"encoding/json"
 	"strings"
 
-	"github.com/coinmeca/go-common/commondatabase"
 	"github.com/coinmeca/go-common/commonprotocol"
-	"github.com/ethereum/go-ethereum/accounts/abi"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-func convertAbiType(inputData *[]map[string]interface{}) (*abi.ABI, error) {
-	if abiBytes, err := json.Marshal(inputData); err != nil {
-		return nil, err
-	} else if result, err := abi.JSON(strings.NewReader(string(abiBytes))); err != nil {
+// GetContract returns the version in use of the first contract named name on
+// any chain, from the cache once it is loaded. GetContractByName picks the
+// chain.
+func (c *ContractDB) GetContract(name string) (*commonprotocol.Contract, error) {
+	cc, err := c.lookupContract(bson.M{"name": name}, func(cache *contractCache) (*cachedContract, bool) {
+		return cache.byName(name)
+	})
+	if err != nil {
 		return nil, err
-	} else {
-		return &result, nil
 	}
+	return copyContract(cc.Contract, nil)
 }
 
-func (c *ContractDB) GetContract(name string) (*commonprotocol.Contract, error) {
-	temp := &commondatabase.Contract{}
-	err := c.ColContract.FindOne(context.Background(), bson.M{
-		"name": name,
-	}).Decode(temp)
-	if err != nil {
-		return nil, err
+// GetContractByName returns the version in use of the contract named name on
+// chainId.
+func (c *ContractDB) GetContractByName(chainId, name string) (*commonprotocol.Contract, error) {
+	return c.GetContractAt(chainId, name, nil)
+}
+
+// GetContractByAddress returns the contract deployed at address on chainId,
+// with the ABI of that deployment when address is one of a replaced version.
+func (c *ContractDB) GetContractByAddress(chainId, address string) (*commonprotocol.Contract, error) {
+	address = strings.ToLower(address)
+	if c.cached() {
+		if contract, ok := c.contracts.byAddress(chainId, address); ok {
+			return copyContract(contract, nil)
+		}
 	}
 
-	abiData, err := convertAbiType(temp.Abi)
+	filter := bson.M{
+		"chainId": chainId,
+		"$or": bson.A{
+			bson.M{"address": address},
+			bson.M{"versions.address": address},
+		},
+	}
+	// the address indexes ignore case, so do the lookups using them
+	option := options.FindOne().SetCollation(addressCollation)
+	cc, err := c.lookupContract(filter, func(*contractCache) (*cachedContract, bool) { return nil, false }, option)
 	if err != nil {
 		return nil, err
 	}
+	return copyContract(cc.byAddress(address), nil)
+}
 
-	result := &commonprotocol.Contract{
-		Id:        temp.Id,
-		ChainId:   temp.ChainId,
-		ServiceId: temp.ServiceId,
-		Cate:      temp.Cate,
-		Name:      temp.Name,
-		Address:   temp.Address,
-		Abi:       abiData,
+func (c *ContractDB) GetContracts() ([]*commonprotocol.Contract, error) {
+	if c.cached() {
+		return c.contracts.list(nil), nil
 	}
+	return c.findContracts(bson.M{})
+}
 
-	return result, nil
+func (c *ContractDB) GetContractsByCate(cate string) ([]*commonprotocol.Contract, error) {
+	if c.cached() {
+		return c.contracts.list(func(contract *commonprotocol.Contract) bool {
+			return contract.Cate == cate
+		}), nil
+	}
+	return c.findContracts(bson.M{"cate": cate})
 }
 
-func (c *ContractDB) GetContracts() ([]*commonprotocol.Contract, error) {
-	result := make([]*commonprotocol.Contract, 0)
-	if cursor, err := c.ColContract.Find(context.Background(), bson.M{}); err != nil {
+// GetContractAddresses returns the address of every contract on chainId,
+// those of replaced versions included.
+func (c *ContractDB) GetContractAddresses(chainId string) ([]string, error) {
+	if c.cached() {
+		return c.contracts.addressesOn(chainId), nil
+	}
+
+	cursor, err := c.ColContract.Find(context.Background(), bson.M{"chainId": chainId})
+	if err != nil {
 		return nil, err
-	} else {
-		defer cursor.Close(context.Background())
-		for cursor.Next(context.TODO()) {
-			temp := &commondatabase.Contract{}
-			if err := cursor.Decode(temp); err != nil {
-				return nil, err
-			}
-			abiData, err := convertAbiType(temp.Abi)
-			if err != nil {
-				return nil, err
-			}
+	}
+	defer cursor.Close(context.Background())
 
-			result = append(result, &commonprotocol.Contract{
-				Id:        temp.Id,
-				ChainId:   temp.ChainId,
-				ServiceId: temp.ServiceId,
-				Cate:      temp.Cate,
-				Name:      temp.Name,
-				Address:   temp.Address,
-				Abi:       abiData,
-			})
+	result := make([]string, 0)
+	for cursor.Next(context.TODO()) {
+		doc := &contractDocument{}
+		if err := cursor.Decode(doc); err != nil {
+			return nil, err
 		}
-		return result, nil
+		result = append(result, doc.addresses()...)
 	}
-
+	return result, cursor.Err()
 }
 
-func (c *ContractDB) GetContractsByCate(cate string) ([]*commonprotocol.Contract, error) {
+func (c *ContractDB) findContracts(filter bson.M) ([]*commonprotocol.Contract, error) {
 	result := make([]*commonprotocol.Contract, 0)
-	filter := bson.M{
-		"cate": cate,
-	}
-	if cursor, err := c.ColContract.Find(context.Background(), filter); err != nil {
+	cursor, err := c.ColContract.Find(context.Background(), filter)
+	if err != nil {
 		return nil, err
-	} else {
-		defer cursor.Close(context.Background())
-		for cursor.Next(context.TODO()) {
-			temp := &commondatabase.Contract{}
-			if err := cursor.Decode(temp); err != nil {
-				return nil, err
-			}
-			abiData, err := convertAbiType(temp.Abi)
-			if err != nil {
-				return nil, err
-			}
+	}
+	defer cursor.Close(context.Background())
 
-			result = append(result, &commonprotocol.Contract{
-				Id:        temp.Id,
-				ChainId:   temp.ChainId,
-				ServiceId: temp.ServiceId,
-				Cate:      temp.Cate,
-				Name:      temp.Name,
-				Address:   temp.Address,
-				Abi:       abiData,
-			})
+	for cursor.Next(context.TODO()) {
+		doc := &contractDocument{}
+		if err := cursor.Decode(doc); err != nil {
+			return nil, err
+		}
+		cc, err := c.contracts.parse(doc)
+		if err != nil {
+			return nil, err
 		}
-		return result, nil
+		result = append(result, cc.Contract)
 	}
+	return result, nil
 }
@@ -2,7 +2,10 @@ package contractdb
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"math/big"
+	"sync"
 
 	"github.com/coinmeca/db-connector/conf"
 	"github.com/coinmeca/db-connector/key"
@@ -11,6 +14,10 @@ import (
 	"github.com/coinmeca/go-common/commonprotocol"
 	commonrepository "github.com/coinmeca/go-common/commonrepository"
 	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rpc"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.uber.org/zap"
@@ -20,61 +27,125 @@ type ContractDB struct {
 	conf *conf.Config
 
 	client       *mongo.Client
+	release      func(ctx context.Context) error
 	ColContract  *mongo.Collection
 	ColChain     *mongo.Collection
 	ColChainInfo *mongo.Collection
 
-	key          *key.KeyManager
+	key *key.KeyManager
+	// ethRepo holds the RPC clients by endpoint and key, one per key in rotation.
+	ethRepoLock  sync.Mutex
 	ethRepo      map[string]*commonrepository.EthRepository
+	chainsLock   sync.RWMutex
+	targets      []string
 	chains       []string
 	chainsUpdate int64
 	start        chan struct{}
+	stop         chan struct{}
+	stopOnce     sync.Once
+	workers      sync.WaitGroup
+
+	contracts *contractCache
+
+	// multicall holds the Multicall3 contract of every chain checked, nil
+	// for chains without one.
+	multicallLock sync.Mutex
+	multicall     map[string]*common.Address
+
+	// endpoints holds the health of every provider by chain.
+	endpointsLock sync.Mutex
+	endpoints     map[string]*endpoint
 }
 
 type ContractDBInterface interface {
 	ConnectKeyManager(key *key.KeyManager)
 
 	Call(chainId string, result interface{}, method string, args ...interface{}) error
+	BatchCall(chainId string, elems []rpc.BatchElem) error
 	ContractCall(ctx context.Context, chainId string, msg ethereum.CallMsg, blockNumber *big.Int) []byte
+	CallMethod(ctx context.Context, chainId, contractName, method string, blockNumber *big.Int, args ...interface{}) ([]interface{}, error)
+	CallMethodTo(ctx context.Context, chainId, contractName, method string, blockNumber *big.Int, result interface{}, args ...interface{}) error
+	NewBatch(chainId string) *Batch
+	FindReorg(chainId string, next BlockRef) (*Reorg, error)
+	ReloadContracts(ctx context.Context) error
+
+	// setter
+	AddContractVersion(chainId, name string, version ContractVersion) error
+	RewindCheckpoint(chainId *string, ancestor BlockRef) error
+	SaveCheckpoint(chainId *string, blockNumber *big.Int) error
+	SaveCheckpointBlocks(chainId *string, blocks []BlockRef) error
+	SaveFinalizedCheckpoint(chainId *string, blockNumber *big.Int) error
 
 	// getter
+	GetBlockRef(chainId string, number uint64) (*BlockRef, error)
+	GetBlockRefs(chainId string, from, to uint64) ([]BlockRef, error)
 	GetChains() []*commondatabase.Chain
+	GetCheckpoint(chainId *string) *big.Int
+	GetCheckpointBlocks(chainId *string) ([]BlockRef, error)
+	GetCheckpointNumber(chainId *string) (uint64, error)
 	GetContract(name string) (*commonprotocol.Contract, error)
+	GetContractAddresses(chainId string) ([]string, error)
+	GetContractAt(chainId, name string, atBlock *big.Int) (*commonprotocol.Contract, error)
+	GetContractByAddress(chainId, address string) (*commonprotocol.Contract, error)
+	GetContractByName(chainId, name string) (*commonprotocol.Contract, error)
 	GetContracts() ([]*commonprotocol.Contract, error)
 	GetContractsByCate(cate string) ([]*commonprotocol.Contract, error)
+	GetEndpointStatus(chainId string) []EndpointStatus
 	GetEthRepo(chainId string) *commonrepository.EthRepository
 	GetEthRepoByKey(chainId string, key *commondatabase.APIKey) *commonrepository.EthRepository
+	GetFinalizedBlock(chainId string) (uint64, error)
+	GetFinalizedCheckpoint(chainId *string) *big.Int
+	GetRpcProvider(chainId string) string
+	GetRpcProviders(chainId string) []string
 	GetTargetChains() []string
 
+	OnConfigChange(event conf.Event)
+
 	Start() error
+	Close(ctx context.Context) error
 }
 
-func NewDB(config *conf.Config, key *key.KeyManager) (commondatabase.IRepository, error) {
-	var err error
+var _ ContractDBInterface = (*ContractDB)(nil)
 
-	r := &ContractDB{
-		conf:    config,
-		key:     key,
-		start:   make(chan struct{}),
-		ethRepo: make(map[string]*commonrepository.EthRepository),
-		chains:  make([]string, 0),
+// NewDB connects a client of its own for [Repositories.contractDB], which
+// Close disconnects.
+func NewDB(config *conf.Config, key *key.KeyManager) (commondatabase.IRepository, error) {
+	client, err := config.Connect(context.Background(), "contractDB")
+	if err != nil {
+		return nil, err
 	}
 
-	credential := options.Credential{
-		Username: config.Repositories["contractDB"]["username"].(string),
-		Password: config.Repositories["contractDB"]["pass"].(string),
+	r, err := NewDBWithClient(config, client, client.Disconnect, key)
+	if err != nil {
+		client.Disconnect(context.Background())
+		return nil, err
 	}
+	return r, nil
+}
 
-	clientOptions := options.Client().ApplyURI(config.Repositories["contractDB"]["datasource"].(string)).SetAuth(credential)
-	if r.client, err = mongo.Connect(context.Background(), clientOptions); err != nil {
-		return nil, err
+// NewDBWithClient builds the repository on a client shared with other
+// repositories. Close calls release instead of disconnecting the client.
+func NewDBWithClient(config *conf.Config, client *mongo.Client, release func(ctx context.Context) error, key *key.KeyManager) (commondatabase.IRepository, error) {
+	r := &ContractDB{
+		conf:      config,
+		client:    client,
+		release:   release,
+		key:       key,
+		start:     make(chan struct{}),
+		ethRepo:   make(map[string]*commonrepository.EthRepository),
+		targets:   config.Chains,
+		chains:    make([]string, 0),
+		multicall: make(map[string]*common.Address),
+		endpoints: make(map[string]*endpoint),
+		stop:      make(chan struct{}),
+		contracts: newContractCache(),
 	}
 
-	if err = r.client.Ping(context.Background(), nil); err == nil {
-		db := r.client.Database(config.Repositories["contractDB"]["db"].(string))
-		r.ColContract = db.Collection("contract")
-		r.ColChain = db.Collection("chain")
-	} else {
+	db := r.client.Database(config.Repositories["contractDB"].DB, config.Repositories["contractDB"].DatabaseOptions())
+	r.ColContract = db.Collection("contract")
+	r.ColChain = db.Collection("chain")
+
+	if err := contractIndex(r.ColContract); err != nil {
 		return nil, err
 	}
 
@@ -92,10 +163,186 @@ func (c *ContractDB) Start() error {
 			}
 		}()
 		close(c.start)
+
+		if c.conf.ContractCache.Sync != "off" {
+			if err := c.ReloadContracts(context.Background()); err != nil {
+				// contracts are read from the collection until a reload works
+				commonlog.Logger.Error("ReloadContracts", zap.Error(err))
+			}
+			c.workers.Add(1)
+			go c.cacheLoop()
+		}
 		return
 	}()
 }
 
+// Close stops the contract cache, closes the RPC clients opened for each key
+// and releases the mongo client.
+func (c *ContractDB) Close(ctx context.Context) error {
+	c.stopOnce.Do(func() { close(c.stop) })
+
+	done := make(chan struct{})
+	go func() {
+		c.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	c.ethRepoLock.Lock()
+	defer c.ethRepoLock.Unlock()
+
+	for id, ethRepo := range c.ethRepo {
+		ethRepo.GetEthClient().Close()
+		delete(c.ethRepo, id)
+	}
+	return c.release(ctx)
+}
+
 func (c *ContractDB) ConnectKeyManager(key *key.KeyManager) {
 	c.key = key
 }
+
+// addressCollation compares addresses ignoring case, so checksummed and
+// lower-cased spellings of an address are the same.
+var addressCollation = &options.Collation{Locale: "en", Strength: 2}
+
+// contractIndex keeps one contract per name and per address on each chain and
+// finds contracts by the address of any of their versions. Addresses are
+// stored lower-cased; the documents written before are migrated, and the
+// address indexes ignore case for those written by other tools. Duplicates
+// the unique indexes cannot be built over are reported first.
+func contractIndex(col *mongo.Collection) error {
+	if err := normalizeAddresses(col); err != nil {
+		return err
+	}
+	if err := checkDuplicates(col); err != nil {
+		return err
+	}
+
+	indexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "chainId", Value: 1},
+				{Key: "name", Value: 1},
+			},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{
+				{Key: "chainId", Value: 1},
+				{Key: "address", Value: 1},
+			},
+			Options: options.Index().SetName("chainId_1_address_1_ci").SetUnique(true).SetSparse(true).SetCollation(addressCollation),
+		},
+		{
+			Keys: bson.D{
+				{Key: "chainId", Value: 1},
+				{Key: "versions.address", Value: 1},
+			},
+			Options: options.Index().SetName("chainId_1_versions.address_1_ci").SetSparse(true).SetCollation(addressCollation),
+		},
+	}
+
+	_, err := col.Indexes().CreateMany(context.Background(), indexes)
+	return err
+}
+
+// normalizeAddresses lower-cases the addresses of the contracts, those of
+// their versions included.
+func normalizeAddresses(col *mongo.Collection) error {
+	upper := primitive.Regex{Pattern: "[A-F]"}
+	filter := bson.M{"$or": bson.A{
+		bson.M{"address": upper},
+		bson.M{"versions.address": upper},
+	}}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"address": lowerString("$address"),
+			"versions": bson.M{"$cond": bson.A{
+				bson.M{"$isArray": "$versions"},
+				bson.M{"$map": bson.M{
+					"input": "$versions",
+					"in": bson.M{"$mergeObjects": bson.A{
+						"$$this",
+						bson.M{"address": lowerString("$$this.address")},
+					}},
+				}},
+				"$versions",
+			}},
+		}}},
+	}
+
+	result, err := col.UpdateMany(context.Background(), filter, update)
+	if err != nil {
+		return fmt.Errorf("normalize contract addresses: %w", err)
+	}
+	if result.ModifiedCount > 0 {
+		commonlog.Logger.Info("normalizeAddresses",
+			zap.Int64("contracts", result.ModifiedCount),
+		)
+	}
+	return nil
+}
+
+// lowerString lower-cases the field at path if it is a string and leaves it
+// as it is otherwise; $toLower alone turns a missing address into "", which
+// the sparse address index would not skip.
+func lowerString(path string) bson.M {
+	return bson.M{"$cond": bson.A{
+		bson.M{"$eq": bson.A{bson.M{"$type": path}, "string"}},
+		bson.M{"$toLower": path},
+		path,
+	}}
+}
+
+// checkDuplicates reports the contracts sharing a name, or an address in any
+// case, on a chain.
+func checkDuplicates(col *mongo.Collection) error {
+	groups := []struct {
+		field string
+		match bson.M
+		value interface{}
+	}{
+		{field: "name", match: bson.M{}, value: "$name"},
+		{field: "address", match: bson.M{"address": bson.M{"$type": "string"}}, value: bson.M{"$toLower": "$address"}},
+	}
+
+	var errs []error
+	for _, group := range groups {
+		pipeline := mongo.Pipeline{
+			{{Key: "$match", Value: group.match}},
+			{{Key: "$group", Value: bson.M{
+				"_id":   bson.M{"chainId": "$chainId", "value": group.value},
+				"count": bson.M{"$sum": 1},
+			}}},
+			{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+		}
+		cursor, err := col.Aggregate(context.Background(), pipeline)
+		if err != nil {
+			return fmt.Errorf("find duplicate contracts: %w", err)
+		}
+
+		var duplicates []struct {
+			Id struct {
+				ChainId interface{} `bson:"chainId"`
+				Value   interface{} `bson:"value"`
+			} `bson:"_id"`
+			Count int `bson:"count"`
+		}
+		if err := cursor.All(context.Background(), &duplicates); err != nil {
+			return fmt.Errorf("find duplicate contracts: %w", err)
+		}
+		for _, d := range duplicates {
+			errs = append(errs, fmt.Errorf("%d contracts with %s %v on chain %v", d.Count, group.field, d.Id.Value, d.Id.ChainId))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("contract collection has duplicates, remove them so the unique indexes can be built: %w", errors.Join(errs...))
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+package contractdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coinmeca/go-common/commonlog"
+	"go.uber.org/zap"
+)
+
+// EndpointStatus is the health of a provider on a chain as seen by this
+// process.
+type EndpointStatus struct {
+	Provider string        `json:"provider"`
+	Open     bool          `json:"open"`
+	Failures int           `json:"failures"`
+	Latency  time.Duration `json:"latency"`
+	Requests int64         `json:"requests"`
+	Errors   int64         `json:"errors"`
+}
+
+// endpoint tracks the health of a provider on a chain. Its circuit opens after
+// Failover.Failures failures in a row; once the cooldown is over a trial
+// request is let through, closing the circuit again if it succeeds.
+type endpoint struct {
+	lock      sync.Mutex
+	failures  int
+	openUntil time.Time
+	latency   time.Duration
+	requests  int64
+	errors    int64
+}
+
+// available reports whether a request may be sent now, without taking the
+// trial request of an open circuit whose cooldown is over.
+func (e *endpoint) available(now time.Time) bool {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	return e.openUntil.IsZero() || !now.Before(e.openUntil)
+}
+
+// acquire reports whether a request may be sent now and, for an open circuit
+// whose cooldown is over, takes its trial: one request is let through per
+// cooldown.
+func (e *endpoint) acquire(now time.Time, cooldown time.Duration) bool {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.openUntil.IsZero() {
+		return true
+	}
+	if now.Before(e.openUntil) {
+		return false
+	}
+	e.openUntil = now.Add(cooldown)
+	return true
+}
+
+func (e *endpoint) record(err error, latency time.Duration, threshold int, cooldown time.Duration) (opened bool) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.requests++
+	if err == nil {
+		e.failures = 0
+		e.openUntil = time.Time{}
+		if e.latency == 0 {
+			e.latency = latency
+		} else {
+			e.latency = (4*e.latency + latency) / 5
+		}
+		return false
+	}
+
+	e.errors++
+	e.failures++
+	if e.failures >= threshold {
+		opened = e.openUntil.IsZero()
+		e.openUntil = time.Now().Add(cooldown)
+	}
+	return opened
+}
+
+func (e *endpoint) status(provider string) EndpointStatus {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	return EndpointStatus{
+		Provider: provider,
+		Open:     !e.openUntil.IsZero(),
+		Failures: e.failures,
+		Latency:  e.latency,
+		Requests: e.requests,
+		Errors:   e.errors,
+	}
+}
+
+// GetRpcProviders returns the providers of chainId in the order of
+// preference: the one of [Keys.Rpc] first, then those of [Failover.Providers].
+func (c *ContractDB) GetRpcProviders(chainId string) []string {
+	providers := []string{c.GetRpcProvider(chainId)}
+	for _, name := range c.conf.Failover.Providers[chainId] {
+		if name != "" && !slices.Contains(providers, name) {
+			providers = append(providers, name)
+		}
+	}
+	return providers
+}
+
+// GetEndpointStatus returns the health of every provider of chainId.
+func (c *ContractDB) GetEndpointStatus(chainId string) []EndpointStatus {
+	providers := c.GetRpcProviders(chainId)
+	status := make([]EndpointStatus, 0, len(providers))
+	for _, name := range providers {
+		status = append(status, c.endpoint(chainId, name).status(name))
+	}
+	return status
+}
+
+func (c *ContractDB) endpoint(chainId, provider string) *endpoint {
+	c.endpointsLock.Lock()
+	defer c.endpointsLock.Unlock()
+
+	id := chainId + "/" + provider
+	e, ok := c.endpoints[id]
+	if !ok {
+		e = &endpoint{}
+		c.endpoints[id] = e
+	}
+	return e
+}
+
+// candidates returns the providers of chainId to try, fastest first among
+// those with a closed circuit or a trial to take; providers not measured yet
+// keep their order of preference ahead of the others. When every circuit is
+// open, all providers are tried in their order of preference and forced is
+// set. Listing a provider does not take its trial, see acquire.
+func (c *ContractDB) candidates(chainId string) (providers []string, forced bool) {
+	providers = c.GetRpcProviders(chainId)
+
+	now := time.Now()
+	allowed := make([]string, 0, len(providers))
+	latency := make(map[string]time.Duration, len(providers))
+	for _, name := range providers {
+		e := c.endpoint(chainId, name)
+		if !e.available(now) {
+			continue
+		}
+		allowed = append(allowed, name)
+		latency[name] = e.status(name).Latency
+	}
+	if len(allowed) == 0 {
+		return providers, true
+	}
+
+	sort.SliceStable(allowed, func(i, j int) bool {
+		return latency[allowed[i]] < latency[allowed[j]]
+	})
+	return allowed, false
+}
+
+func (c *ContractDB) recordEndpoint(chainId, provider string, err error, latency time.Duration) {
+	if err != nil && isRevert(err) {
+		err = nil
+	}
+	if c.endpoint(chainId, provider).record(err, latency, c.conf.Failover.Threshold(), c.conf.Failover.CooldownDuration()) {
+		commonlog.Logger.Warn("circuit opened",
+			zap.String("chainId", chainId),
+			zap.String("provider", provider),
+			zap.String("error", err.Error()),
+		)
+	}
+}
+
+// errCircuitOpen is returned for a provider skipped because its circuit is
+// open.
+var errCircuitOpen = errors.New("circuit open")
+
+// hedgeable reports whether method only reads, so it can be sent to several
+// providers at once.
+func hedgeable(method string) bool {
+	return method == "eth_call" || method == "eth_chainId" || method == "eth_blockNumber" || strings.HasPrefix(method, "eth_get")
+}
+
+// failover runs call with the providers of chainId until one answers, a revert
+// counting as an answer. With hedge, a provider that has not answered after
+// [Failover.Hedge] is joined by the next one and the first answer wins.
+func failover[T any](ctx context.Context, c *ContractDB, chainId string, hedge bool, call func(ctx context.Context, cate string) (T, error)) (T, error) {
+	var zero T
+	candidates, forced := c.candidates(chainId)
+	if len(candidates) == 0 {
+		return zero, fmt.Errorf("no rpc provider for chain %s", chainId)
+	}
+
+	attempt := func(ctx context.Context, cate string) (T, error) {
+		// the trial of a circuit may have been taken since it was listed
+		if !c.endpoint(chainId, cate).acquire(time.Now(), c.conf.Failover.CooldownDuration()) && !forced {
+			return zero, fmt.Errorf("provider %s on chain %s: %w", cate, chainId, errCircuitOpen)
+		}
+		start := time.Now()
+		result, err := call(ctx, cate)
+		// requests canceled because another provider answered say nothing
+		// about the health of this one
+		if !errors.Is(err, context.Canceled) {
+			c.recordEndpoint(chainId, cate, err, time.Since(start))
+		}
+		return result, err
+	}
+
+	delay := c.conf.Failover.HedgeDelay()
+	if !hedge || delay <= 0 || len(candidates) < 2 {
+		var err error
+		for _, cate := range candidates {
+			var result T
+			if result, err = attempt(ctx, cate); err == nil || isRevert(err) {
+				return result, err
+			}
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		return zero, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type outcome struct {
+		result T
+		err    error
+	}
+	outcomes := make(chan outcome, len(candidates))
+	next, pending := 0, 0
+	var hedgeC <-chan time.Time
+	launch := func() {
+		cate := candidates[next]
+		next++
+		pending++
+		hedgeC = time.After(delay)
+		go func() {
+			result, err := attempt(ctx, cate)
+			outcomes <- outcome{result, err}
+		}()
+	}
+
+	launch()
+	var err error
+	for pending > 0 {
+		select {
+		case o := <-outcomes:
+			pending--
+			if o.err == nil || isRevert(o.err) {
+				return o.result, o.err
+			}
+			err = o.err
+			if next < len(candidates) {
+				launch()
+			}
+		case <-hedgeC:
+			hedgeC = nil
+			if next < len(candidates) {
+				launch()
+			}
+		case <-ctx.Done():
+			return zero, ctx.Err()
+		}
+	}
+	return zero, err
+}
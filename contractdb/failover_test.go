@@ -0,0 +1,225 @@
+package contractdb
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coinmeca/db-connector/conf"
+)
+
+// testFailover returns a ContractDB with the providers a, b and c on chain 1,
+// in that order of preference.
+func testFailover(failover conf.FailoverConfig) *ContractDB {
+	failover.Providers = map[string][]string{"1": {"b", "c"}}
+	c := &ContractDB{
+		conf:      &conf.Config{Failover: failover},
+		endpoints: make(map[string]*endpoint),
+	}
+	c.conf.Keys.Rpc = map[string]string{"1": "a"}
+	return c
+}
+
+// providers answers the calls of failover with the error set for each
+// provider, and records the order they were called in.
+type providers struct {
+	lock   sync.Mutex
+	errs   map[string]error
+	called []string
+}
+
+func (p *providers) call(ctx context.Context, cate string) (string, error) {
+	p.lock.Lock()
+	p.called = append(p.called, cate)
+	err := p.errs[cate]
+	p.lock.Unlock()
+	if err != nil {
+		return "", err
+	}
+	return cate, nil
+}
+
+func TestFailover(t *testing.T) {
+	down := errors.New("connection refused")
+	revert := &rpcError{code: 3, message: "execution reverted"}
+
+	tests := []struct {
+		name   string
+		errs   map[string]error
+		result string
+		err    error
+		called []string
+	}{
+		{
+			name:   "first provider answers",
+			result: "a",
+			called: []string{"a"},
+		},
+		{
+			name:   "next provider after a failure",
+			errs:   map[string]error{"a": down},
+			result: "b",
+			called: []string{"a", "b"},
+		},
+		{
+			name:   "revert is an answer",
+			errs:   map[string]error{"a": revert},
+			err:    revert,
+			called: []string{"a"},
+		},
+		{
+			name:   "every provider fails",
+			errs:   map[string]error{"a": down, "b": down, "c": down},
+			err:    down,
+			called: []string{"a", "b", "c"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testFailover(conf.FailoverConfig{})
+			p := &providers{errs: tt.errs}
+
+			result, err := failover(context.Background(), c, "1", false, p.call)
+			if result != tt.result || !errors.Is(err, tt.err) {
+				t.Errorf("failover = %q, %v, want %q, %v", result, err, tt.result, tt.err)
+			}
+			if !slices.Equal(p.called, tt.called) {
+				t.Errorf("called %v, want %v", p.called, tt.called)
+			}
+		})
+	}
+}
+
+func TestFailoverHedge(t *testing.T) {
+	c := testFailover(conf.FailoverConfig{Hedge: conf.Duration(10 * time.Millisecond)})
+
+	canceled := make(chan struct{})
+	result, err := failover(context.Background(), c, "1", true, func(ctx context.Context, cate string) (string, error) {
+		if cate == "a" {
+			<-ctx.Done()
+			close(canceled)
+			return "", ctx.Err()
+		}
+		return cate, nil
+	})
+	if result != "b" || err != nil {
+		t.Fatalf("failover = %q, %v, want the answer of b", result, err)
+	}
+
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("the request to a was not canceled")
+	}
+	if status := c.endpoint("1", "a").status("a"); status.Failures != 0 || status.Requests != 0 {
+		t.Errorf("canceled request counted against a: %+v", status)
+	}
+}
+
+func TestCandidates(t *testing.T) {
+	tests := []struct {
+		name    string
+		latency map[string]time.Duration
+		open    []string
+		want    []string
+		forced  bool
+	}{
+		{
+			name: "order of preference",
+			want: []string{"a", "b", "c"},
+		},
+		{
+			name:    "fastest first, unmeasured ahead",
+			latency: map[string]time.Duration{"a": 30 * time.Millisecond, "b": 10 * time.Millisecond},
+			want:    []string{"c", "b", "a"},
+		},
+		{
+			name:    "open circuits skipped",
+			latency: map[string]time.Duration{"a": 30 * time.Millisecond, "b": 10 * time.Millisecond},
+			open:    []string{"b"},
+			want:    []string{"c", "a"},
+		},
+		{
+			name:   "every circuit open",
+			open:   []string{"a", "b", "c"},
+			want:   []string{"a", "b", "c"},
+			forced: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testFailover(conf.FailoverConfig{Failures: 1})
+			for name, latency := range tt.latency {
+				c.endpoint("1", name).record(nil, latency, 1, time.Minute)
+			}
+			for _, name := range tt.open {
+				c.endpoint("1", name).record(errors.New("down"), 0, 1, time.Minute)
+			}
+
+			got, forced := c.candidates("1")
+			if !slices.Equal(got, tt.want) || forced != tt.forced {
+				t.Errorf("candidates = %v, %v, want %v, %v", got, forced, tt.want, tt.forced)
+			}
+		})
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	const cooldown = time.Minute
+	down := errors.New("down")
+	e := &endpoint{}
+
+	if e.record(down, 0, 2, cooldown) {
+		t.Error("circuit opened before the threshold")
+	}
+	if !e.record(down, 0, 2, cooldown) {
+		t.Error("circuit not opened at the threshold")
+	}
+	if e.record(down, 0, 2, cooldown) {
+		t.Error("open circuit reported as opened again")
+	}
+
+	now := time.Now()
+	if e.available(now) || e.acquire(now, cooldown) {
+		t.Error("open circuit lets a request through during the cooldown")
+	}
+	later := now.Add(2 * cooldown)
+	if !e.available(later) || !e.available(later) {
+		t.Error("trial request not available after the cooldown")
+	}
+	if !e.acquire(later, cooldown) {
+		t.Error("no trial request after the cooldown")
+	}
+	if e.available(later) || e.acquire(later, cooldown) {
+		t.Error("second trial request within one cooldown")
+	}
+
+	e.record(nil, time.Millisecond, 2, cooldown)
+	if !e.acquire(later, cooldown) || e.status("a").Open {
+		t.Error("successful trial does not close the circuit")
+	}
+}
+
+func TestFailoverTrial(t *testing.T) {
+	c := testFailover(conf.FailoverConfig{Failures: 1})
+	// the cooldown of b is over, so it is listed with a trial to take
+	c.endpoint("1", "b").record(errors.New("down"), 0, 1, -time.Second)
+
+	p := &providers{}
+	if result, err := failover(context.Background(), c, "1", false, p.call); result != "a" || err != nil {
+		t.Fatalf("failover = %q, %v, want the answer of a", result, err)
+	}
+	if !c.endpoint("1", "b").acquire(time.Now(), time.Minute) {
+		t.Error("the trial of b was taken although b was not called")
+	}
+
+	// the trial is taken now, so b is left out until its cooldown is over
+	if got, _ := c.candidates("1"); slices.Contains(got, "b") {
+		t.Errorf("candidates = %v, want b left out while its trial is taken", got)
+	}
+}
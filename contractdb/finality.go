@@ -0,0 +1,81 @@
+package contractdb
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/coinmeca/go-common/commonlog"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// GetFinalizedBlock returns the number of the last final block of chainId, as
+// set by [Checkpoint.Finality].
+func (c *ContractDB) GetFinalizedBlock(chainId string) (uint64, error) {
+	finality := c.conf.Checkpoint.FinalityOf(chainId)
+	if finality.Confirmations > 0 {
+		var head hexutil.Uint64
+		if err := c.Call(chainId, &head, "eth_blockNumber"); err != nil {
+			return 0, err
+		}
+		return uint64(max(int64(head)-int64(finality.Confirmations), 0)), nil
+	}
+
+	var block *rpcBlock
+	if err := c.Call(chainId, &block, "eth_getBlockByNumber", finality.Tag, false); err != nil {
+		return 0, err
+	}
+	if block == nil {
+		return 0, fmt.Errorf("no %s block on chain %s", finality.Tag, chainId)
+	}
+	return uint64(block.Number), nil
+}
+
+func (c *ContractDB) BsonForFinalizedCheckpoint(chainId *string, blockNumber *big.Int) (bson.M, bson.M) {
+	filter := bson.M{
+		"chainId": *chainId,
+	}
+
+	update := bson.M{
+		"$setOnInsert": bson.M{
+			"chainId": *chainId,
+		},
+		"$max": bson.M{
+			"finalized": blockNumber.Int64(),
+		},
+	}
+
+	return filter, update
+}
+
+// SaveFinalizedCheckpoint moves the finalized checkpoint of chainId, the last
+// block whose data is final, up to blockNumber. The head checkpoint of
+// SaveCheckpoint may be ahead of it with data a reorganization can still
+// remove.
+func (c *ContractDB) SaveFinalizedCheckpoint(chainId *string, blockNumber *big.Int) error {
+	filter, update := c.BsonForFinalizedCheckpoint(chainId, blockNumber)
+	option := options.Update().SetUpsert(true)
+
+	_, err := c.ColChain.UpdateOne(context.Background(), filter, update, option)
+	if err != nil {
+		commonlog.Logger.Error("SaveFinalizedCheckpoint",
+			zap.String("chainId", *chainId),
+			zap.String("error", err.Error()),
+		)
+		return err
+	}
+	return nil
+}
+
+// GetFinalizedCheckpoint returns the finalized checkpoint of chainId, 0 if
+// none is saved yet.
+func (c *ContractDB) GetFinalizedCheckpoint(chainId *string) *big.Int {
+	doc := &checkpointDocument{}
+	if err := c.ColChain.FindOne(context.Background(), bson.M{"chainId": *chainId}).Decode(doc); err != nil {
+		return big.NewInt(0)
+	}
+	return big.NewInt(doc.Finalized)
+}
@@ -0,0 +1,68 @@
+package contractdb
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/coinmeca/go-common/commonprotocol"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// CallMethod calls the view method of the contract named contractName on
+// chainId with args, packed and unpacked with the ABI of the version active at
+// blockNumber. A nil blockNumber calls the version in use at the latest block.
+// Reverts are returned as *RevertError.
+func (c *ContractDB) CallMethod(ctx context.Context, chainId, contractName, method string, blockNumber *big.Int, args ...interface{}) ([]interface{}, error) {
+	contract, output, err := c.callMethod(ctx, chainId, contractName, method, blockNumber, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := contract.Abi.Unpack(method, output)
+	if err != nil {
+		return nil, fmt.Errorf("%s.%s: %w", contractName, method, err)
+	}
+	return result, nil
+}
+
+// CallMethodTo is CallMethod decoding the outputs into result, a pointer to a
+// struct with a field per output or to the single output.
+func (c *ContractDB) CallMethodTo(ctx context.Context, chainId, contractName, method string, blockNumber *big.Int, result interface{}, args ...interface{}) error {
+	contract, output, err := c.callMethod(ctx, chainId, contractName, method, blockNumber, args...)
+	if err != nil {
+		return err
+	}
+
+	if err := contract.Abi.UnpackIntoInterface(result, method, output); err != nil {
+		return fmt.Errorf("%s.%s: %w", contractName, method, err)
+	}
+	return nil
+}
+
+// CallMethodAs is CallMethodTo returning the outputs as T.
+func CallMethodAs[T any](ctx context.Context, c *ContractDB, chainId, contractName, method string, blockNumber *big.Int, args ...interface{}) (T, error) {
+	var result T
+	err := c.CallMethodTo(ctx, chainId, contractName, method, blockNumber, &result, args...)
+	return result, err
+}
+
+func (c *ContractDB) callMethod(ctx context.Context, chainId, contractName, method string, blockNumber *big.Int, args ...interface{}) (*commonprotocol.Contract, []byte, error) {
+	contract, err := c.GetContractAt(chainId, contractName, blockNumber)
+	if err != nil {
+		return nil, nil, fmt.Errorf("contract %s on chain %s: %w", contractName, chainId, err)
+	}
+
+	input, err := contract.Abi.Pack(method, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s.%s: %w", contractName, method, err)
+	}
+
+	to := common.HexToAddress(contract.Address)
+	output, err := c.contractCall(ctx, chainId, ethereum.CallMsg{To: &to, Data: input}, blockNumber)
+	if err != nil {
+		return nil, nil, revertError(contract.Abi, contractName, method, err)
+	}
+	return contract, output, nil
+}
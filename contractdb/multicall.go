@@ -0,0 +1,324 @@
+package contractdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/coinmeca/go-common/commonlog"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"go.uber.org/zap"
+)
+
+var multicall3, _ = abi.JSON(strings.NewReader(`[{
+	"type": "function", "name": "aggregate3", "stateMutability": "payable",
+	"inputs": [{"name": "calls", "type": "tuple[]", "components": [
+		{"name": "target", "type": "address"},
+		{"name": "allowFailure", "type": "bool"},
+		{"name": "callData", "type": "bytes"}
+	]}],
+	"outputs": [{"name": "returnData", "type": "tuple[]", "components": [
+		{"name": "success", "type": "bool"},
+		{"name": "returnData", "type": "bytes"}
+	]}]
+}]`))
+
+type multicallCall struct {
+	Target       common.Address
+	AllowFailure bool
+	CallData     []byte
+}
+
+type multicallResult struct {
+	Success    bool
+	ReturnData []byte
+}
+
+// BatchCall is a call queued in a Batch. Once the batch ran, Err is nil and
+// ReturnData is set if the call succeeded; Outputs is set as well for calls
+// added with AddMethod.
+type BatchCall struct {
+	Target common.Address
+	Data   []byte
+	// Gas is the gas the call is expected to use, counted against the gas
+	// limit of its batch. Zero counts conf.MulticallConfig.CallGas.
+	Gas uint64
+
+	ReturnData []byte
+	Outputs    []interface{}
+	Err        error
+
+	abi          *abi.ABI
+	contractName string
+	method       string
+	args         []interface{}
+}
+
+// Unpack decodes the outputs of a call added with AddMethod into result, a
+// pointer to a struct with a field per output or to the single output.
+func (b *BatchCall) Unpack(result interface{}) error {
+	if b.Err != nil {
+		return b.Err
+	}
+	if b.abi == nil {
+		return errors.New("call added without abi")
+	}
+	return b.abi.UnpackIntoInterface(result, b.method, b.ReturnData)
+}
+
+func (b *BatchCall) finish(data []byte, err error) {
+	if err != nil {
+		if b.abi != nil {
+			err = revertError(b.abi, b.contractName, b.method, err)
+		}
+		b.Err = err
+		return
+	}
+
+	b.ReturnData = data
+	if b.abi != nil {
+		if b.Outputs, err = b.abi.Unpack(b.method, data); err != nil {
+			b.Err = fmt.Errorf("%s.%s: %w", b.contractName, b.method, err)
+		}
+	}
+}
+
+// Batch queues contract reads of one chain and runs them through Multicall3
+// at a single block.
+type Batch struct {
+	c       *ContractDB
+	chainId string
+	calls   []*BatchCall
+	// call runs msg with eth_call on the chain of the batch.
+	call func(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error)
+}
+
+// NewBatch returns an empty batch of reads on chainId.
+func (c *ContractDB) NewBatch(chainId string) *Batch {
+	return &Batch{
+		c:       c,
+		chainId: chainId,
+		call: func(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+			return c.contractCall(ctx, chainId, msg, blockNumber)
+		},
+	}
+}
+
+// Add queues a call of target with data.
+func (b *Batch) Add(target common.Address, data []byte) *BatchCall {
+	call := &BatchCall{Target: target, Data: data}
+	b.calls = append(b.calls, call)
+	return call
+}
+
+// AddMethod queues a call of method of the contract named contractName,
+// packed with its stored ABI. Run moves the call to the version of the
+// contract active at the block it runs at.
+func (b *Batch) AddMethod(contractName, method string, args ...interface{}) (*BatchCall, error) {
+	contract, err := b.c.GetContractByName(b.chainId, contractName)
+	if err != nil {
+		return nil, fmt.Errorf("contract %s on chain %s: %w", contractName, b.chainId, err)
+	}
+	input, err := contract.Abi.Pack(method, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s.%s: %w", contractName, method, err)
+	}
+
+	call := b.Add(common.HexToAddress(contract.Address), input)
+	call.abi, call.contractName, call.method, call.args = contract.Abi, contractName, method, args
+	return call, nil
+}
+
+// resolve points the calls added with AddMethod at the version of their
+// contract active at blockNumber. Calls without such a version fail and are
+// left out of the returned calls.
+func (b *Batch) resolve(blockNumber *big.Int) []*BatchCall {
+	calls := make([]*BatchCall, 0, len(b.calls))
+	for _, call := range b.calls {
+		if call.abi == nil {
+			calls = append(calls, call)
+			continue
+		}
+
+		contract, err := b.c.GetContractAt(b.chainId, call.contractName, blockNumber)
+		if err != nil {
+			call.Err = fmt.Errorf("contract %s on chain %s: %w", call.contractName, b.chainId, err)
+			continue
+		}
+		if target := common.HexToAddress(contract.Address); target != call.Target || contract.Abi != call.abi {
+			input, err := contract.Abi.Pack(call.method, call.args...)
+			if err != nil {
+				call.Err = fmt.Errorf("%s.%s: %w", call.contractName, call.method, err)
+				continue
+			}
+			call.Target, call.Data, call.abi = target, input, contract.Abi
+		}
+		calls = append(calls, call)
+	}
+	return calls
+}
+
+// Len returns the number of queued calls.
+func (b *Batch) Len() int {
+	return len(b.calls)
+}
+
+// Run runs the queued calls at blockNumber, or at the latest block if it is
+// nil, and returns the block they ran at. The outcome of each call is set on
+// its BatchCall. Calls are split into multicalls within the limits of
+// [Multicall]; a multicall that fails as a whole, and every call on chains
+// without Multicall3, run one by one at the same block.
+func (b *Batch) Run(ctx context.Context, blockNumber *big.Int) (*big.Int, error) {
+	if len(b.calls) == 0 {
+		return blockNumber, nil
+	}
+
+	if blockNumber == nil {
+		var latest hexutil.Big
+		if err := b.c.Call(b.chainId, &latest, "eth_blockNumber"); err != nil {
+			return nil, fmt.Errorf("block number of chain %s: %w", b.chainId, err)
+		}
+		blockNumber = latest.ToInt()
+	}
+
+	multicall := b.c.multicallAddress(b.chainId)
+	for _, calls := range b.split(b.resolve(blockNumber)) {
+		if multicall == nil || len(calls) == 1 {
+			b.runSingle(ctx, calls, blockNumber)
+			continue
+		}
+		if err := b.runMulticall(ctx, *multicall, calls, blockNumber); err != nil {
+			commonlog.Logger.Error("Batch",
+				zap.String("chainId", b.chainId),
+				zap.Int("calls", len(calls)),
+				zap.String("multicall failed", err.Error()),
+			)
+			b.runSingle(ctx, calls, blockNumber)
+		}
+	}
+
+	return blockNumber, nil
+}
+
+// split divides calls into batches within the limits of [Multicall].
+func (b *Batch) split(calls []*BatchCall) [][]*BatchCall {
+	limits := b.c.conf.Multicall
+
+	var batches [][]*BatchCall
+	var batch []*BatchCall
+	var gas uint64
+	var size int
+	for _, call := range calls {
+		callGas := call.Gas
+		if callGas == 0 {
+			callGas = limits.DefaultCallGas()
+		}
+		// every call carries its target, flag, offsets and padding as well
+		callSize := len(call.Data) + 160
+
+		if len(batch) > 0 && (len(batch) >= limits.Size() || gas+callGas > limits.Gas() || size+callSize > limits.Bytes()) {
+			batches = append(batches, batch)
+			batch, gas, size = nil, 0, 0
+		}
+		batch = append(batch, call)
+		gas += callGas
+		size += callSize
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+func (b *Batch) runMulticall(ctx context.Context, multicall common.Address, calls []*BatchCall, blockNumber *big.Int) error {
+	input := make([]multicallCall, len(calls))
+	for i, call := range calls {
+		input[i] = multicallCall{Target: call.Target, AllowFailure: true, CallData: call.Data}
+	}
+	data, err := multicall3.Pack("aggregate3", input)
+	if err != nil {
+		return err
+	}
+
+	msg := ethereum.CallMsg{To: &multicall, Data: data, Gas: b.c.conf.Multicall.Gas()}
+	output, err := b.call(ctx, msg, blockNumber)
+	if err != nil {
+		return err
+	}
+
+	unpacked, err := multicall3.Unpack("aggregate3", output)
+	if err != nil {
+		return err
+	}
+	results := *abi.ConvertType(unpacked[0], new([]multicallResult)).(*[]multicallResult)
+	if len(results) != len(calls) {
+		return fmt.Errorf("%d results for %d calls", len(results), len(calls))
+	}
+
+	for i, result := range results {
+		if result.Success {
+			calls[i].finish(result.ReturnData, nil)
+		} else {
+			calls[i].finish(nil, &multicallRevert{data: result.ReturnData})
+		}
+	}
+	return nil
+}
+
+func (b *Batch) runSingle(ctx context.Context, calls []*BatchCall, blockNumber *big.Int) {
+	for _, call := range calls {
+		target := call.Target
+		msg := ethereum.CallMsg{To: &target, Data: call.Data, Gas: call.Gas}
+		call.finish(b.call(ctx, msg, blockNumber))
+	}
+}
+
+// multicallRevert is the revert of a single call inside a multicall, shaped
+// like the revert error of eth_call so revertError decodes it.
+type multicallRevert struct {
+	data []byte
+}
+
+func (e *multicallRevert) Error() string          { return "execution reverted" }
+func (e *multicallRevert) ErrorCode() int         { return 3 }
+func (e *multicallRevert) ErrorData() interface{} { return hexutil.Encode(e.data) }
+
+// multicallAddress returns the Multicall3 contract of chainId, or nil if the
+// chain has none. Whether the contract is deployed is checked once per chain.
+func (c *ContractDB) multicallAddress(chainId string) *common.Address {
+	c.multicallLock.Lock()
+	address, ok := c.multicall[chainId]
+	c.multicallLock.Unlock()
+	if ok {
+		return address
+	}
+
+	// resolved without the lock, so a slow provider does not hold up the
+	// batches of other chains; concurrent callers may resolve it twice
+
+	if configured := c.conf.Multicall.AddressOf(chainId); configured != "" {
+		var code hexutil.Bytes
+		if err := c.Call(chainId, &code, "eth_getCode", configured, "latest"); err != nil {
+			// not known yet, asked again with the next batch
+			commonlog.Logger.Error("multicallAddress",
+				zap.String("chainId", chainId),
+				zap.String("eth_getCode", err.Error()),
+			)
+			return nil
+		}
+		if len(code) > 0 {
+			a := common.HexToAddress(configured)
+			address = &a
+		}
+	}
+
+	c.multicallLock.Lock()
+	c.multicall[chainId] = address
+	c.multicallLock.Unlock()
+	return address
+}
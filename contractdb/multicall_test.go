@@ -0,0 +1,306 @@
+package contractdb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/coinmeca/db-connector/conf"
+	"github.com/coinmeca/go-common/commonlog"
+	"github.com/coinmeca/go-common/commonprotocol"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"go.uber.org/zap"
+)
+
+func TestMain(m *testing.M) {
+	commonlog.Logger = zap.NewNop()
+	os.Exit(m.Run())
+}
+
+var (
+	testMulticall = common.HexToAddress(conf.Multicall3Address)
+	revertTarget  = common.HexToAddress("0x00000000000000000000000000000000000000ff")
+)
+
+// fakeChain answers the eth_calls of a batch: a call returns its own call
+// data, and reverts when it is sent to revertTarget.
+type fakeChain struct {
+	multicallFails bool
+	multicalls     int
+	singles        int
+}
+
+func (f *fakeChain) call(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	aggregate3 := multicall3.Methods["aggregate3"]
+	if *msg.To == testMulticall {
+		f.multicalls++
+		if f.multicallFails {
+			return nil, errors.New("out of gas")
+		}
+		unpacked, err := aggregate3.Inputs.Unpack(msg.Data[4:])
+		if err != nil {
+			return nil, err
+		}
+		calls := *abi.ConvertType(unpacked[0], new([]multicallCall)).(*[]multicallCall)
+		results := make([]multicallResult, len(calls))
+		for i, call := range calls {
+			results[i] = f.answer(call.Target, call.CallData)
+		}
+		return aggregate3.Outputs.Pack(results)
+	}
+
+	f.singles++
+	result := f.answer(*msg.To, msg.Data)
+	if !result.Success {
+		return nil, reverted(result.ReturnData)
+	}
+	return result.ReturnData, nil
+}
+
+func (f *fakeChain) answer(target common.Address, data []byte) multicallResult {
+	if target == revertTarget {
+		reason, _ := abi.Arguments{{Type: stringType}}.Pack("nope")
+		return multicallResult{ReturnData: append(append([]byte{}, errorSelector...), reason...)}
+	}
+	return multicallResult{Success: true, ReturnData: data}
+}
+
+var stringType, _ = abi.NewType("string", "", nil)
+
+func testBatch(config conf.MulticallConfig, multicall *common.Address, chain *fakeChain) *Batch {
+	c := &ContractDB{
+		conf:      &conf.Config{Multicall: config},
+		multicall: map[string]*common.Address{"1": multicall},
+	}
+	b := c.NewBatch("1")
+	if chain != nil {
+		b.call = chain.call
+	}
+	return b
+}
+
+func TestBatchSplit(t *testing.T) {
+	tests := []struct {
+		name   string
+		config conf.MulticallConfig
+		gas    []uint64
+		data   int
+		want   []int
+	}{
+		{
+			name: "one batch",
+			gas:  []uint64{0, 0, 0},
+			want: []int{3},
+		},
+		{
+			name:   "by size",
+			config: conf.MulticallConfig{BatchSize: 2},
+			gas:    []uint64{0, 0, 0, 0, 0},
+			want:   []int{2, 2, 1},
+		},
+		{
+			name:   "by default call gas",
+			config: conf.MulticallConfig{BatchGas: 500_000},
+			gas:    []uint64{0, 0, 0, 0, 0},
+			want:   []int{2, 2, 1},
+		},
+		{
+			name:   "by the gas of each call",
+			config: conf.MulticallConfig{BatchGas: 500_000},
+			gas:    []uint64{400_000, 200_000, 100_000},
+			want:   []int{1, 2},
+		},
+		{
+			name:   "by call data",
+			config: conf.MulticallConfig{BatchBytes: 600},
+			gas:    []uint64{0, 0, 0, 0, 0},
+			data:   100,
+			want:   []int{2, 2, 1},
+		},
+		{
+			name:   "call over the limits alone",
+			config: conf.MulticallConfig{BatchGas: 100_000},
+			gas:    []uint64{0, 0},
+			want:   []int{1, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := testBatch(tt.config, &testMulticall, nil)
+			for _, gas := range tt.gas {
+				b.Add(common.Address{}, make([]byte, tt.data)).Gas = gas
+			}
+
+			got := make([]int, 0)
+			for _, batch := range b.split(b.calls) {
+				got = append(got, len(batch))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("batches = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBatchRun(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     conf.MulticallConfig
+		multicall  *common.Address
+		fails      bool
+		calls      int
+		multicalls int
+		singles    int
+	}{
+		{
+			name:       "multicall",
+			multicall:  &testMulticall,
+			calls:      3,
+			multicalls: 1,
+		},
+		{
+			name:       "split, the last call alone",
+			config:     conf.MulticallConfig{BatchSize: 2},
+			multicall:  &testMulticall,
+			calls:      5,
+			multicalls: 2,
+			singles:    1,
+		},
+		{
+			name:       "multicall failing falls back to single calls",
+			multicall:  &testMulticall,
+			fails:      true,
+			calls:      3,
+			multicalls: 1,
+			singles:    3,
+		},
+		{
+			name:    "chain without multicall",
+			calls:   3,
+			singles: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain := &fakeChain{multicallFails: tt.fails}
+			b := testBatch(tt.config, tt.multicall, chain)
+
+			calls := make([]*BatchCall, tt.calls)
+			for i := range calls {
+				target := common.BigToAddress(big.NewInt(int64(i + 1)))
+				if i == 1 {
+					target = revertTarget
+				}
+				calls[i] = b.Add(target, []byte{byte(i), 1, 2, 3})
+			}
+
+			block, err := b.Run(context.Background(), big.NewInt(100))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if block.Int64() != 100 {
+				t.Errorf("ran at block %v, want 100", block)
+			}
+			if chain.multicalls != tt.multicalls || chain.singles != tt.singles {
+				t.Errorf("%d multicalls and %d single calls, want %d and %d", chain.multicalls, chain.singles, tt.multicalls, tt.singles)
+			}
+
+			for i, call := range calls {
+				if i == 1 {
+					if call.Err == nil || !isRevert(call.Err) {
+						t.Errorf("call %d: error %v, want a revert", i, call.Err)
+					}
+					continue
+				}
+				if call.Err != nil || !bytes.Equal(call.ReturnData, call.Data) {
+					t.Errorf("call %d: %x, %v, want %x", i, call.ReturnData, call.Err, call.Data)
+				}
+			}
+		})
+	}
+}
+
+var tokenABI, _ = abi.JSON(strings.NewReader(`[
+	{"type": "function", "name": "balanceOf", "stateMutability": "view",
+		"inputs": [{"name": "owner", "type": "address"}],
+		"outputs": [{"name": "", "type": "uint256"}]}
+]`))
+
+// testVersions returns a cache holding the contract Token on chain 1, deployed
+// at address 1 from block 10 and replaced by address 2 from block 100.
+func testVersions() *contractCache {
+	deployment := func(address string) *commonprotocol.Contract {
+		return &commonprotocol.Contract{ChainId: "1", Name: "Token", Address: address, Abi: &tokenABI}
+	}
+	v1, v2 := deployment("0x0000000000000000000000000000000000000001"), deployment("0x0000000000000000000000000000000000000002")
+
+	cache := newContractCache()
+	cache.replace([]*cachedContract{{
+		Contract: v2,
+		versions: []*cachedVersion{
+			{ContractVersion: ContractVersion{Version: 1, Address: v1.Address, ActiveFrom: 10, ActiveUntil: 100}, contract: v1},
+			{ContractVersion: ContractVersion{Version: 2, Address: v2.Address, ActiveFrom: 100}, contract: v2},
+		},
+	}})
+	return cache
+}
+
+func TestBatchAddMethodAtBlock(t *testing.T) {
+	tests := []struct {
+		name   string
+		block  int64
+		target common.Address
+		err    error
+	}{
+		{
+			name:   "version in use",
+			block:  150,
+			target: common.BigToAddress(big.NewInt(2)),
+		},
+		{
+			name:   "replaced version",
+			block:  50,
+			target: common.BigToAddress(big.NewInt(1)),
+		},
+		{
+			name:  "before the first deployment",
+			block: 5,
+			err:   ErrNoVersion,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain := &fakeChain{}
+			b := testBatch(conf.MulticallConfig{}, nil, chain)
+			b.c.contracts = testVersions()
+
+			call, err := b.AddMethod("Token", "balanceOf", common.Address{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := b.Run(context.Background(), big.NewInt(tt.block)); err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.err != nil {
+				if !errors.Is(call.Err, tt.err) || chain.singles != 0 {
+					t.Errorf("error %v after %d calls, want %v without a call", call.Err, chain.singles, tt.err)
+				}
+				return
+			}
+			if call.Target != tt.target || chain.singles != 1 {
+				t.Errorf("called %v %d times, want %v once", call.Target, chain.singles, tt.target)
+			}
+		})
+	}
+}
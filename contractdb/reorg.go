@@ -0,0 +1,318 @@
+package contractdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/coinmeca/go-common/commonlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// ErrReorgTooDeep is returned when none of the blocks kept with a checkpoint
+// is part of the chain any more.
+var ErrReorgTooDeep = errors.New("reorganization deeper than the checkpoint window")
+
+// BlockRef identifies a block of a chain.
+type BlockRef struct {
+	Number     uint64 `json:"number" bson:"number"`
+	Hash       string `json:"hash" bson:"hash"`
+	ParentHash string `json:"parentHash" bson:"parentHash"`
+	Time       uint64 `json:"time" bson:"time"`
+	// Indexed is when the indexer started to dispatch the events of the
+	// block, in unix nanoseconds; the writes made for the block or later
+	// blocks are at or after it. Zero if unknown.
+	Indexed int64 `json:"indexed,omitempty" bson:"indexed,omitempty"`
+}
+
+// Reorg is a reorganization found by FindReorg. Orphaned holds the blocks
+// kept with the checkpoint that left the chain, oldest first, and TxHashes
+// the transactions they included as far as the provider still knows them.
+type Reorg struct {
+	ChainId  string
+	Ancestor BlockRef
+	Orphaned []BlockRef
+	TxHashes []string
+}
+
+// BlockHashes returns the hashes of the orphaned blocks.
+func (r *Reorg) BlockHashes() []string {
+	hashes := make([]string, 0, len(r.Orphaned))
+	for _, block := range r.Orphaned {
+		hashes = append(hashes, block.Hash)
+	}
+	return hashes
+}
+
+// Since returns Indexed of the first orphaned block: the writes made at or
+// after it are undone by a rollback.
+func (r *Reorg) Since() int64 {
+	if len(r.Orphaned) == 0 {
+		return 0
+	}
+	return r.Orphaned[0].Indexed
+}
+
+// AddTxHashes adds hashes to TxHashes, skipping those already in.
+func (r *Reorg) AddTxHashes(hashes ...string) {
+	for _, hash := range hashes {
+		if !slices.Contains(r.TxHashes, hash) {
+			r.TxHashes = append(r.TxHashes, hash)
+		}
+	}
+}
+
+type checkpointDocument struct {
+	Checkpoint     int64      `bson:"checkpoint"`
+	CheckpointHash string     `bson:"checkpointHash"`
+	Finalized      int64      `bson:"finalized"`
+	Blocks         []BlockRef `bson:"blocks"`
+}
+
+type rpcBlock struct {
+	Number       hexutil.Uint64 `json:"number"`
+	Hash         common.Hash    `json:"hash"`
+	ParentHash   common.Hash    `json:"parentHash"`
+	Timestamp    hexutil.Uint64 `json:"timestamp"`
+	Transactions []common.Hash  `json:"transactions"`
+}
+
+func (b *rpcBlock) ref() *BlockRef {
+	return &BlockRef{
+		Number:     uint64(b.Number),
+		Hash:       b.Hash.Hex(),
+		ParentHash: b.ParentHash.Hex(),
+		Time:       uint64(b.Timestamp),
+	}
+}
+
+// GetBlockRef returns block number of chainId as the provider sees it now.
+func (c *ContractDB) GetBlockRef(chainId string, number uint64) (*BlockRef, error) {
+	var block *rpcBlock
+	if err := c.Call(chainId, &block, "eth_getBlockByNumber", hexutil.EncodeUint64(number), false); err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block %d of chain %s not found", number, chainId)
+	}
+	return block.ref(), nil
+}
+
+// blockBatch bounds the blocks asked for in one batch by GetBlockRefs, below
+// the batch limits of the providers.
+const blockBatch = 100
+
+// GetBlockRefs returns the canonical blocks from to to of chainId, in batches
+// of requests.
+func (c *ContractDB) GetBlockRefs(chainId string, from, to uint64) ([]BlockRef, error) {
+	if from > to {
+		return nil, nil
+	}
+	refs := make([]BlockRef, 0, to-from+1)
+	for start := from; start <= to; start += blockBatch {
+		end := min(start+blockBatch-1, to)
+
+		blocks := make([]*rpcBlock, end-start+1)
+		elems := make([]rpc.BatchElem, len(blocks))
+		for i := range elems {
+			elems[i] = rpc.BatchElem{
+				Method: "eth_getBlockByNumber",
+				Args:   []interface{}{hexutil.EncodeUint64(start + uint64(i)), false},
+				Result: &blocks[i],
+			}
+		}
+		if err := c.BatchCall(chainId, elems); err != nil {
+			return nil, err
+		}
+
+		for i, elem := range elems {
+			if elem.Error != nil {
+				return nil, fmt.Errorf("block %d of chain %s: %w", start+uint64(i), chainId, elem.Error)
+			}
+			if blocks[i] == nil {
+				return nil, fmt.Errorf("block %d of chain %s not found", start+uint64(i), chainId)
+			}
+			refs = append(refs, *blocks[i].ref())
+		}
+	}
+	return refs, nil
+}
+
+// GetCheckpointBlocks returns the recent blocks kept with the checkpoint of
+// chainId, oldest first.
+func (c *ContractDB) GetCheckpointBlocks(chainId *string) ([]BlockRef, error) {
+	doc, err := c.checkpoint(*chainId)
+	if err != nil {
+		return nil, err
+	}
+	return doc.Blocks, nil
+}
+
+// GetCheckpointNumber returns the head checkpoint of chainId, 0 if none is
+// saved yet. Unlike GetCheckpoint it returns the error of a failed read.
+func (c *ContractDB) GetCheckpointNumber(chainId *string) (uint64, error) {
+	doc, err := c.checkpoint(*chainId)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(doc.Checkpoint), nil
+}
+
+// checkpoint reads the checkpoint document of chainId, empty if the chain has
+// none yet.
+func (c *ContractDB) checkpoint(chainId string) (*checkpointDocument, error) {
+	doc := &checkpointDocument{}
+	err := c.ColChain.FindOne(context.Background(), bson.M{"chainId": chainId}).Decode(doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return &checkpointDocument{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// BsonForCheckpointBlocks moves the checkpoint of chainId up to the last of
+// blocks, which are in ascending order, and keeps them in the window of
+// recent blocks in place of those kept before with the same numbers.
+func (c *ContractDB) BsonForCheckpointBlocks(chainId *string, blocks []BlockRef) (bson.M, mongo.Pipeline) {
+	first, last := blocks[0], blocks[len(blocks)-1]
+	filter := bson.M{
+		"chainId": *chainId,
+	}
+
+	kept := bson.M{"$filter": bson.M{
+		"input": bson.M{"$ifNull": bson.A{"$blocks", bson.A{}}},
+		"cond":  bson.M{"$lt": bson.A{"$$this.number", int64(first.Number)}},
+	}}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"chainId": *chainId,
+			"checkpointHash": bson.M{"$cond": bson.A{
+				bson.M{"$gte": bson.A{int64(last.Number), bson.M{"$ifNull": bson.A{"$checkpoint", 0}}}},
+				last.Hash,
+				"$checkpointHash",
+			}},
+			"checkpoint": bson.M{"$max": bson.A{"$checkpoint", int64(last.Number)}},
+			"blocks": bson.M{"$slice": bson.A{
+				bson.M{"$concatArrays": bson.A{kept, blocks}},
+				-c.conf.Checkpoint.WindowSize(),
+			}},
+		}}},
+	}
+
+	return filter, update
+}
+
+// SaveCheckpointBlocks is SaveCheckpoint keeping the hashes of blocks, so a
+// later reorganization can be found by FindReorg.
+func (c *ContractDB) SaveCheckpointBlocks(chainId *string, blocks []BlockRef) error {
+	if len(blocks) == 0 {
+		return nil
+	}
+	filter, update := c.BsonForCheckpointBlocks(chainId, blocks)
+	option := options.Update().SetUpsert(true)
+
+	_, err := c.ColChain.UpdateOne(context.Background(), filter, update, option)
+	if err != nil {
+		commonlog.Logger.Error("SaveCheckpointBlocks",
+			zap.String("chainId", *chainId),
+			zap.String("error", err.Error()),
+		)
+		return err
+	}
+	return nil
+}
+
+// RewindCheckpoint moves the checkpoint of chainId back to ancestor and drops
+// the recent blocks after it. A finalized checkpoint past ancestor, which
+// means the finality of the chain is set too short, is moved back as well.
+func (c *ContractDB) RewindCheckpoint(chainId *string, ancestor BlockRef) error {
+	filter := bson.M{"chainId": *chainId}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"checkpoint":     int64(ancestor.Number),
+			"checkpointHash": ancestor.Hash,
+			"finalized": bson.M{"$cond": bson.A{
+				bson.M{"$gt": bson.A{"$finalized", int64(ancestor.Number)}},
+				int64(ancestor.Number),
+				"$finalized",
+			}},
+			"blocks": bson.M{"$filter": bson.M{
+				"input": bson.M{"$ifNull": bson.A{"$blocks", bson.A{}}},
+				"cond":  bson.M{"$lte": bson.A{"$$this.number", int64(ancestor.Number)}},
+			}},
+		}}},
+	}
+
+	_, err := c.ColChain.UpdateOne(context.Background(), filter, update)
+	return err
+}
+
+// FindReorg checks next, the first block not indexed yet, against the blocks
+// kept with the checkpoint of chainId. It returns nil if the parent of next
+// is the block kept, or if there is none to compare with. Otherwise the
+// kept blocks are compared with the chain, newest first, down to the last one
+// still part of it.
+func (c *ContractDB) FindReorg(chainId string, next BlockRef) (*Reorg, error) {
+	blocks, err := c.GetCheckpointBlocks(&chainId)
+	if err != nil {
+		return nil, err
+	}
+
+	i := slices.IndexFunc(blocks, func(block BlockRef) bool { return block.Number+1 == next.Number })
+	if i < 0 || blocks[i].Hash == next.ParentHash {
+		return nil, nil
+	}
+
+	reorg := &Reorg{ChainId: chainId}
+	found := false
+	for j := i; j >= 0 && !found; j-- {
+		canonical, err := c.GetBlockRef(chainId, blocks[j].Number)
+		if err != nil {
+			return nil, err
+		}
+		if canonical.Hash == blocks[j].Hash {
+			reorg.Ancestor, found = blocks[j], true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("chain %s at block %d: %w", chainId, next.Number, ErrReorgTooDeep)
+	}
+
+	for _, block := range blocks {
+		if block.Number <= reorg.Ancestor.Number {
+			continue
+		}
+		reorg.Orphaned = append(reorg.Orphaned, block)
+
+		// orphaned blocks are often still served by hash for a while
+		var orphaned *rpcBlock
+		if err := c.Call(chainId, &orphaned, "eth_getBlockByHash", block.Hash, false); err == nil && orphaned != nil {
+			for _, tx := range orphaned.Transactions {
+				reorg.AddTxHashes(tx.Hex())
+			}
+		}
+	}
+
+	if finalized := c.GetFinalizedCheckpoint(&chainId); finalized.Uint64() > reorg.Ancestor.Number {
+		commonlog.Logger.Error("FindReorg: finalized blocks orphaned, finality of the chain is too short",
+			zap.String("chainId", chainId),
+			zap.Uint64("finalized", finalized.Uint64()),
+		)
+	}
+
+	commonlog.Logger.Warn("FindReorg",
+		zap.String("chainId", chainId),
+		zap.Uint64("ancestor", reorg.Ancestor.Number),
+		zap.Int("orphaned", len(reorg.Orphaned)),
+	)
+	return reorg, nil
+}
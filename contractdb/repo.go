@@ -1,22 +1,94 @@
 ﻿package contractdb
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+
 	"github.com/coinmeca/go-common/commondatabase"
+	"github.com/coinmeca/go-common/commonlog"
 	commonrepository "github.com/coinmeca/go-common/commonrepository"
+	"go.uber.org/zap"
 )
 
+// GetEthRepo returns the client for the next key in the rotation of chainId.
 func (c *ContractDB) GetEthRepo(chainId string) *commonrepository.EthRepository {
-	ethRepo, ok := c.ethRepo[chainId]
-	if !ok {
-		current := c.key.GetCurrentKey("alchemy", chainId)
-		ethRepo = commonrepository.NewEthRepository(current.Url + current.Key)
-		c.ethRepo[chainId] = ethRepo
+	current := c.key.GetCurrentKey(c.GetRpcProvider(chainId), chainId)
+	if current == nil {
+		commonlog.Logger.Error("GetEthRepo",
+			zap.String("chainId", chainId),
+			zap.String("not found", "no active key"),
+		)
+		return nil
 	}
-	return ethRepo
+	return c.GetEthRepoByKey(chainId, current)
 }
 
+// GetEthRepoByKey returns the client of key, reusing the one opened before.
+// Every key has its own client. Auth headers of the provider are set anew on
+// every call, so short-lived tokens stay valid.
 func (c *ContractDB) GetEthRepoByKey(chainId string, key *commondatabase.APIKey) *commonrepository.EthRepository {
-	ethRepo := commonrepository.NewEthRepository(key.Url + key.Key)
-	c.ethRepo[chainId] = ethRepo
+	return c.ethRepoFor(c.GetRpcProvider(chainId), chainId, key)
+}
+
+// ethRepoFor is GetEthRepoByKey for a key of the provider cate.
+func (c *ContractDB) ethRepoFor(cate, chainId string, key *commondatabase.APIKey) *commonrepository.EthRepository {
+	provider, err := c.key.Provider(cate)
+	if err != nil {
+		commonlog.Logger.Error("GetEthRepoByKey",
+			zap.String("chainId", chainId),
+			zap.String("provider", err.Error()),
+		)
+		return nil
+	}
+
+	endpoint, err := provider.Endpoint(chainId, key)
+	if err != nil {
+		commonlog.Logger.Error("GetEthRepoByKey",
+			zap.String("chainId", chainId),
+			zap.String("endpoint", err.Error()),
+		)
+		return nil
+	}
+
+	header, err := provider.Header(key)
+	if err != nil {
+		commonlog.Logger.Error("GetEthRepoByKey",
+			zap.String("chainId", chainId),
+			zap.String("header", err.Error()),
+		)
+		return nil
+	}
+
+	c.ethRepoLock.Lock()
+	defer c.ethRepoLock.Unlock()
+
+	id := ethRepoKey(endpoint, key)
+	ethRepo, ok := c.ethRepo[id]
+	if !ok {
+		ethRepo = commonrepository.NewEthRepository(endpoint)
+		c.ethRepo[id] = ethRepo
+	}
+	// the client only ever carries the headers of key, so refreshing a token
+	// cannot leak into the requests of another key
+	for name := range header {
+		ethRepo.GetEthClient().Client().SetHeader(name, header.Get(name))
+	}
 	return ethRepo
 }
+
+// ethRepoKey identifies the client of key on endpoint. Providers authenticating
+// with headers share the endpoint between keys, so the key is part of it,
+// hashed so it is not kept around as a map key.
+func ethRepoKey(endpoint string, key *commondatabase.APIKey) string {
+	hash := sha256.Sum256([]byte(key.Key))
+	return endpoint + "|" + hex.EncodeToString(hash[:])
+}
+
+// GetRpcProvider returns the provider of the RPC keys of chainId, as set in
+// [Keys.Rpc].
+func (c *ContractDB) GetRpcProvider(chainId string) string {
+	if name, ok := c.conf.Keys.Rpc[chainId]; ok && name != "" {
+		return name
+	}
+	return "alchemy"
+}
@@ -0,0 +1,111 @@
+package contractdb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+var (
+	// errorSelector is the selector of Error(string), the revert reason of
+	// require and revert with a message.
+	errorSelector = []byte{0x08, 0xc3, 0x79, 0xa0}
+	// panicSelector is the selector of Panic(uint256), raised by failing
+	// asserts, overflows and the like.
+	panicSelector = []byte{0x4e, 0x48, 0x7b, 0x71}
+)
+
+// RevertError is returned when a call reverts. Depending on how the contract
+// reverted, Reason, Panic or the custom error Custom with Args is set; Data is
+// the raw revert data in any case.
+type RevertError struct {
+	Contract string
+	Method   string
+
+	Reason string
+	Panic  *big.Int
+	Custom string
+	Args   []interface{}
+
+	Data []byte
+	err  error
+}
+
+func (e *RevertError) Error() string {
+	var reason string
+	switch {
+	case e.Reason != "":
+		reason = e.Reason
+	case e.Panic != nil:
+		reason = fmt.Sprintf("panic 0x%x", e.Panic)
+	case e.Custom != "":
+		reason = fmt.Sprintf("%s%v", e.Custom, e.Args)
+	case len(e.Data) > 0:
+		reason = hexutil.Encode(e.Data)
+	default:
+		reason = "without reason"
+	}
+	return fmt.Sprintf("%s.%s: execution reverted: %s", e.Contract, e.Method, reason)
+}
+
+func (e *RevertError) Unwrap() error {
+	return e.err
+}
+
+// isRevert reports whether err is a revert of eth_call rather than a failure
+// of the provider.
+func isRevert(err error) bool {
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == 3 {
+		return true
+	}
+	return strings.Contains(err.Error(), "execution reverted")
+}
+
+// revertError returns err as a RevertError if it is a revert, with the revert
+// data decoded as far as the ABI of the contract allows.
+func revertError(contract *abi.ABI, contractName, method string, err error) error {
+	if !isRevert(err) {
+		return err
+	}
+
+	revert := &RevertError{Contract: contractName, Method: method, err: err}
+
+	var dataErr rpc.DataError
+	if errors.As(err, &dataErr) {
+		if data, ok := dataErr.ErrorData().(string); ok {
+			revert.Data, _ = hexutil.Decode(data)
+		}
+	}
+	if len(revert.Data) < 4 {
+		return revert
+	}
+
+	selector, args := revert.Data[:4], revert.Data[4:]
+	switch {
+	case bytes.Equal(selector, errorSelector):
+		revert.Reason, _ = abi.UnpackRevert(revert.Data)
+	case bytes.Equal(selector, panicSelector):
+		if len(args) == 32 {
+			revert.Panic = new(big.Int).SetBytes(args)
+		}
+	case contract != nil:
+		for name, e := range contract.Errors {
+			if !bytes.Equal(e.ID[:4], selector) {
+				continue
+			}
+			revert.Custom = name
+			if unpacked, err := e.Inputs.Unpack(args); err == nil {
+				revert.Args = unpacked
+			}
+			break
+		}
+	}
+	return revert
+}
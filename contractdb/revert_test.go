@@ -0,0 +1,146 @@
+package contractdb
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// rpcError is a JSON-RPC error response as returned by the rpc client.
+type rpcError struct {
+	code    int
+	message string
+	data    interface{}
+}
+
+func (e *rpcError) Error() string          { return e.message }
+func (e *rpcError) ErrorCode() int         { return e.code }
+func (e *rpcError) ErrorData() interface{} { return e.data }
+
+var testABI, _ = abi.JSON(strings.NewReader(`[
+	{"type": "error", "name": "InsufficientBalance", "inputs": [
+		{"name": "available", "type": "uint256"},
+		{"name": "required", "type": "uint256"}
+	]}
+]`))
+
+func reverted(data []byte) error {
+	return &rpcError{code: 3, message: "execution reverted", data: hexutil.Encode(data)}
+}
+
+func packRevert(t *testing.T, selector []byte, types []string, values ...interface{}) []byte {
+	t.Helper()
+	args := make(abi.Arguments, 0, len(types))
+	for _, name := range types {
+		typ, err := abi.NewType(name, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		args = append(args, abi.Argument{Type: typ})
+	}
+	packed, err := args.Pack(values...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(append([]byte{}, selector...), packed...)
+}
+
+func TestRevertError(t *testing.T) {
+	id := testABI.Errors["InsufficientBalance"].ID
+	custom := id[:4]
+
+	tests := []struct {
+		name   string
+		abi    *abi.ABI
+		err    func(t *testing.T) error
+		revert *RevertError
+		msg    string
+	}{
+		{
+			name: "not a revert",
+			err:  func(t *testing.T) error { return errors.New("connection refused") },
+			msg:  "connection refused",
+		},
+		{
+			name:   "revert without data",
+			err:    func(t *testing.T) error { return errors.New("execution reverted") },
+			revert: &RevertError{},
+			msg:    "Token.transfer: execution reverted: without reason",
+		},
+		{
+			name: "reason",
+			err: func(t *testing.T) error {
+				return reverted(packRevert(t, errorSelector, []string{"string"}, "not enough"))
+			},
+			revert: &RevertError{Reason: "not enough"},
+			msg:    "Token.transfer: execution reverted: not enough",
+		},
+		{
+			name: "panic",
+			err: func(t *testing.T) error {
+				return reverted(packRevert(t, panicSelector, []string{"uint256"}, big.NewInt(0x11)))
+			},
+			revert: &RevertError{Panic: big.NewInt(0x11)},
+			msg:    "Token.transfer: execution reverted: panic 0x11",
+		},
+		{
+			name: "custom error",
+			abi:  &testABI,
+			err: func(t *testing.T) error {
+				return reverted(packRevert(t, custom, []string{"uint256", "uint256"}, big.NewInt(1), big.NewInt(2)))
+			},
+			revert: &RevertError{Custom: "InsufficientBalance", Args: []interface{}{big.NewInt(1), big.NewInt(2)}},
+			msg:    "Token.transfer: execution reverted: InsufficientBalance[1 2]",
+		},
+		{
+			name: "custom error without abi",
+			err: func(t *testing.T) error {
+				return reverted(packRevert(t, custom, []string{"uint256", "uint256"}, big.NewInt(1), big.NewInt(2)))
+			},
+			revert: &RevertError{},
+			msg:    "Token.transfer: execution reverted: 0x",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cause := tt.err(t)
+			err := revertError(tt.abi, "Token", "transfer", cause)
+			if !strings.HasPrefix(err.Error(), tt.msg) {
+				t.Errorf("message = %q, want %q", err, tt.msg)
+			}
+
+			var revert *RevertError
+			if !errors.As(err, &revert) {
+				if tt.revert != nil {
+					t.Fatalf("%v is not a RevertError", err)
+				}
+				return
+			}
+			if tt.revert == nil {
+				t.Fatalf("%v is a RevertError", err)
+			}
+			if !errors.Is(err, cause) {
+				t.Error("RevertError does not wrap the error of the call")
+			}
+			if revert.Reason != tt.revert.Reason || revert.Custom != tt.revert.Custom {
+				t.Errorf("reason %q, custom %q, want %q, %q", revert.Reason, revert.Custom, tt.revert.Reason, tt.revert.Custom)
+			}
+			if (revert.Panic == nil) != (tt.revert.Panic == nil) || (revert.Panic != nil && revert.Panic.Cmp(tt.revert.Panic) != 0) {
+				t.Errorf("panic %v, want %v", revert.Panic, tt.revert.Panic)
+			}
+			if len(revert.Args) != len(tt.revert.Args) {
+				t.Fatalf("args %v, want %v", revert.Args, tt.revert.Args)
+			}
+			for i, arg := range revert.Args {
+				if arg.(*big.Int).Cmp(tt.revert.Args[i].(*big.Int)) != 0 {
+					t.Errorf("arg %d = %v, want %v", i, arg, tt.revert.Args[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package contractdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+
+	"github.com/coinmeca/go-common/commondatabase"
+	"github.com/coinmeca/go-common/commonlog"
+	"github.com/coinmeca/go-common/commonprotocol"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// ErrNoVersion is returned when no version of a contract was active at the
+// block asked for.
+var ErrNoVersion = errors.New("no contract version active at block")
+
+// ContractVersion is one deployment of a contract, active from block
+// ActiveFrom up to, but not including, ActiveUntil. ActiveUntil is zero for
+// the version in use.
+type ContractVersion struct {
+	Version     int                       `json:"version" bson:"version"`
+	Address     string                    `json:"address" bson:"address"`
+	Abi         *[]map[string]interface{} `json:"abi" bson:"abi"`
+	DeployTx    string                    `json:"deployTx,omitempty" bson:"deployTx,omitempty"`
+	DeployBlock uint64                    `json:"deployBlock,omitempty" bson:"deployBlock,omitempty"`
+	ActiveFrom  uint64                    `json:"activeFrom" bson:"activeFrom"`
+	ActiveUntil uint64                    `json:"activeUntil,omitempty" bson:"activeUntil,omitempty"`
+}
+
+func (v *ContractVersion) activeAt(block uint64) bool {
+	return v.ActiveFrom <= block && (v.ActiveUntil == 0 || block < v.ActiveUntil)
+}
+
+// contractDocument is a document of the contract collection. Address and Abi
+// of the embedded contract are those of the version in use; documents written
+// before versions were kept have no Versions and are valid at every block.
+type contractDocument struct {
+	commondatabase.Contract `bson:",inline"`
+
+	Versions []ContractVersion `bson:"versions,omitempty"`
+}
+
+// addresses returns the addresses of every version, lower-cased.
+func (doc *contractDocument) addresses() []string {
+	result := make([]string, 0, len(doc.Versions)+1)
+	if doc.Address != "" {
+		result = append(result, strings.ToLower(doc.Address))
+	}
+	for _, v := range doc.Versions {
+		if address := strings.ToLower(v.Address); !slices.Contains(result, address) {
+			result = append(result, address)
+		}
+	}
+	return result
+}
+
+// cachedContract is a contract with the parsed ABI of each of its versions.
+type cachedContract struct {
+	*commonprotocol.Contract
+	versions []*cachedVersion
+}
+
+type cachedVersion struct {
+	ContractVersion
+	contract *commonprotocol.Contract
+}
+
+// at returns the contract as deployed at block, the version in use for a nil
+// block.
+func (cc *cachedContract) at(block *big.Int) (*commonprotocol.Contract, error) {
+	if block == nil || len(cc.versions) == 0 {
+		return cc.Contract, nil
+	}
+	if !block.IsUint64() {
+		return nil, fmt.Errorf("%w %s", ErrNoVersion, block)
+	}
+	for _, v := range cc.versions {
+		if v.activeAt(block.Uint64()) {
+			return v.contract, nil
+		}
+	}
+	return nil, fmt.Errorf("%s on chain %s: %w %s", cc.Name, cc.ChainId, ErrNoVersion, block)
+}
+
+// byAddress returns the version of the contract deployed at address, the
+// version in use if none is.
+func (cc *cachedContract) byAddress(address string) *commonprotocol.Contract {
+	for _, v := range cc.versions {
+		if strings.EqualFold(v.Address, address) {
+			return v.contract
+		}
+	}
+	return cc.Contract
+}
+
+// GetContractAt returns the version of the contract named name on chainId
+// that was active at atBlock, so logs of a replaced deployment decode with its
+// own ABI. A nil atBlock returns the version in use.
+func (c *ContractDB) GetContractAt(chainId, name string, atBlock *big.Int) (*commonprotocol.Contract, error) {
+	cc, err := c.lookupContract(bson.M{"chainId": chainId, "name": name}, func(cache *contractCache) (*cachedContract, bool) {
+		return cache.byChain(chainId, name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return copyContract(cc.at(atBlock))
+}
+
+// AddContractVersion registers a new deployment of the contract named name on
+// chainId. The version in use is closed at the ActiveFrom block of the new
+// one, which becomes the version in use. A contract kept without versions so
+// far gets its current deployment as version 1, active from block 0.
+func (c *ContractDB) AddContractVersion(chainId, name string, version ContractVersion) error {
+	if version.Address == "" || version.Abi == nil {
+		return errors.New("contract version without address or abi")
+	}
+	version.Address = strings.ToLower(version.Address)
+
+	ctx := context.Background()
+	filter := bson.M{"name": name, "chainId": chainId}
+
+	doc := &contractDocument{}
+	if err := c.ColContract.FindOne(ctx, filter).Decode(doc); err != nil {
+		return fmt.Errorf("contract %s on chain %s: %w", name, chainId, err)
+	}
+
+	versions := doc.Versions
+	if len(versions) == 0 {
+		versions = []ContractVersion{{
+			Version: 1,
+			Address: strings.ToLower(doc.Address),
+			Abi:     doc.Abi,
+		}}
+	}
+	for i := range versions {
+		v := &versions[i]
+		if v.ActiveUntil != 0 {
+			continue
+		}
+		if version.ActiveFrom <= v.ActiveFrom {
+			return fmt.Errorf("version %d is active from block %d, after the new version", v.Version, v.ActiveFrom)
+		}
+		v.ActiveUntil = version.ActiveFrom
+	}
+	if version.Version == 0 {
+		version.Version = versions[len(versions)-1].Version + 1
+	}
+	version.ActiveUntil = 0
+	versions = append(versions, version)
+
+	// the update only applies if no other version was added meanwhile
+	filter = bson.M{"_id": doc.Id, "versions": bson.M{"$size": len(doc.Versions)}}
+	if len(doc.Versions) == 0 {
+		filter["versions"] = bson.M{"$exists": false}
+	}
+	update := bson.M{"$set": bson.M{
+		"address":  version.Address,
+		"abi":      version.Abi,
+		"versions": versions,
+	}}
+	result, err := c.ColContract.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("contract %s on chain %s changed meanwhile", name, chainId)
+	}
+
+	commonlog.Logger.Info("AddContractVersion",
+		zap.String("chainId", chainId),
+		zap.String("name", name),
+		zap.Int("version", version.Version),
+		zap.Uint64("activeFrom", version.ActiveFrom),
+	)
+
+	if c.conf.ContractCache.Sync == "off" {
+		return nil
+	}
+	return c.ReloadContracts(ctx)
+}
+
+// lookupContract returns the contract found in the cache, or else the one
+// matching filter in the collection.
+func (c *ContractDB) lookupContract(filter bson.M, cached func(cache *contractCache) (*cachedContract, bool), opts ...*options.FindOneOptions) (*cachedContract, error) {
+	if c.cached() {
+		if cc, ok := cached(c.contracts); ok {
+			return cc, nil
+		}
+	}
+
+	doc := &contractDocument{}
+	if err := c.ColContract.FindOne(context.Background(), filter, opts...).Decode(doc); err != nil {
+		return nil, err
+	}
+	cc, err := c.contracts.parse(doc)
+	if err != nil {
+		return nil, err
+	}
+	if c.cached() {
+		c.contracts.put(cc)
+	}
+	return cc, nil
+}
+
+// copyContract returns a copy of contract sharing its parsed ABI, so callers
+// cannot change the cache.
+func copyContract(contract *commonprotocol.Contract, err error) (*commonprotocol.Contract, error) {
+	if err != nil {
+		return nil, err
+	}
+	copied := *contract
+	return &copied, nil
+}
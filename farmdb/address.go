@@ -1,9 +1,9 @@
 ﻿package farmdb
 
 import (
-	"context"
 	"strings"
 
+	"github.com/coinmeca/db-connector/conf"
 	"github.com/coinmeca/go-common/commonmethod/farm"
 	"github.com/coinmeca/go-common/commonprotocol"
 	"go.mongodb.org/mongo-driver/bson"
@@ -18,14 +18,16 @@ func (f *FarmDB) GetAllFarmAddresses() ([]*commonprotocol.Contract, error) {
 		"main":    1,
 		"name":    1,
 	})
-	cursor, err := f.ColFarm.Find(context.Background(), bson.M{}, option)
+	col, ctx, cancel := f.collection(f.ColFarm, conf.OpInfoRead)
+	defer cancel()
+	cursor, err := col.Find(ctx, bson.M{}, option)
 
 	if err != nil {
 		return farms, err
 	}
-	defer cursor.Close(context.Background())
+	defer cursor.Close(ctx)
 
-	for cursor.Next(context.Background()) {
+	for cursor.Next(ctx) {
 		f := &farm.Farm{}
 		if err := cursor.Decode(&f); err == nil {
 			farm := &commonprotocol.Contract{
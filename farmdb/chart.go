@@ -3,21 +3,30 @@ package farmdb
 import (
 	"context"
 
+	"github.com/coinmeca/db-connector/conf"
+	"github.com/coinmeca/db-connector/journal"
 	"github.com/coinmeca/go-common/commonlog"
 	"github.com/coinmeca/go-common/commonmethod/farm"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.uber.org/zap"
 )
 
 func (f *FarmDB) SaveFarmChart(t *farm.Chart) error {
 	filter, update := f.BsonForChart(t)
+	pipeline, err := f.chartUpdate(t.ChainId, update)
+	if err != nil {
+		return err
+	}
 	option := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
 
-	err := f.ColChart.FindOneAndUpdate(
-		context.Background(),
+	col, ctx, cancel := f.collection(f.ColChart, conf.OpChartWrite)
+	defer cancel()
+	err = col.FindOneAndUpdate(
+		ctx,
 		filter,
-		update,
+		pipeline,
 		option,
 	).Decode(t)
 	if err != nil {
@@ -31,10 +40,34 @@ func (f *FarmDB) SaveFarmChart(t *farm.Chart) error {
 
 func (f *FarmDB) GetChartAtTime(chainId, address *string, time *int64) *farm.Chart {
 	var chart *farm.Chart
-	err := f.ColChart.FindOne(context.Background(), bson.D{{"time", time}}).Decode(chart)
+	col, ctx, cancel := f.collection(f.ColChart, conf.OpChartRead)
+	defer cancel()
+	err := col.FindOne(ctx, bson.D{{"time", time}}).Decode(chart)
 	if err == nil {
 		return chart
 	} else {
 		return nil
 	}
 }
+
+// RollbackCharts undoes the writes made to the charts of chainId at or after
+// since, in unix nanoseconds, for blocks orphaned by a reorganization.
+func (f *FarmDB) RollbackCharts(ctx context.Context, chainId string, since int64) (int64, error) {
+	col, opCtx, cancel := f.collection(f.ColChart, conf.OpChartWrite)
+	defer cancel()
+	defer context.AfterFunc(ctx, cancel)()
+	undone, err := journal.Rollback(opCtx, col, bson.M{"chainId": chainId}, since)
+	if err != nil {
+		commonlog.Logger.Error("RollbackCharts",
+			zap.String("chainId", chainId),
+			zap.String("error", err.Error()),
+		)
+	}
+	return undone, err
+}
+
+// chartUpdate turns update into a pipeline keeping the revision of the bucket,
+// so RollbackCharts can undo it.
+func (f *FarmDB) chartUpdate(chainId string, update bson.M) (mongo.Pipeline, error) {
+	return journal.Update(update, "time", journal.Stamp(chainId), f.config.Checkpoint.WindowSize())
+}
@@ -19,6 +19,7 @@ type FarmDB struct {
 	config *conf.Config
 
 	client     *mongo.Client
+	release    func(ctx context.Context) error
 	ColFarm    *mongo.Collection
 	ColChart   *mongo.Collection
 	ColHistory *mongo.Collection
@@ -48,40 +49,50 @@ type FarmDBInterface interface {
 	GetTotalInterest(nowTime *int64, last *farm.Last)
 
 	// setter
+	RollbackCharts(ctx context.Context, chainId string, since int64) (int64, error)
+	RollbackTxs(ctx context.Context, chainId string, txHashes []string) (int64, error)
 	SaveFarmChart(t *farm.Chart) error
 	SaveFarmInfo(info *farm.Farm) error
 	SaveFarmInfoFromModel(models *[]mongo.WriteModel, info *farm.Farm)
 	SaveFarmRecent(recent *farm.Recent) error
 
 	Start() error
+	Close(ctx context.Context) error
 }
 
-func NewDB(config *conf.Config) (commondatabase.IRepository, error) {
-	r := &FarmDB{
-		config: config,
-		start:  make(chan struct{}),
-	}
+var _ FarmDBInterface = (*FarmDB)(nil)
 
-	var err error
-	credential := options.Credential{
-		Username: r.config.Repositories["farmDB"]["username"].(string),
-		Password: r.config.Repositories["farmDB"]["pass"].(string),
+// NewDB connects a client of its own for [Repositories.farmDB], which Close
+// disconnects.
+func NewDB(config *conf.Config) (commondatabase.IRepository, error) {
+	client, err := config.Connect(context.Background(), "farmDB")
+	if err != nil {
+		return nil, err
 	}
 
-	clientOptions := options.Client().ApplyURI(config.Repositories["farmDB"]["datasource"].(string)).SetAuth(credential)
-	if r.client, err = mongo.Connect(context.Background(), clientOptions); err != nil {
+	r, err := NewDBWithClient(config, client, client.Disconnect)
+	if err != nil {
+		client.Disconnect(context.Background())
 		return nil, err
 	}
+	return r, nil
+}
 
-	if err = r.client.Ping(context.Background(), nil); err == nil {
-		db := r.client.Database(config.Repositories["farmDB"]["db"].(string))
-		r.ColFarm = db.Collection("farm")
-		r.ColChart = db.Collection("chart")
-		r.ColHistory = db.Collection("history")
-	} else {
-		return nil, err
+// NewDBWithClient builds the repository on a client shared with other
+// repositories. Close calls release instead of disconnecting the client.
+func NewDBWithClient(config *conf.Config, client *mongo.Client, release func(ctx context.Context) error) (commondatabase.IRepository, error) {
+	r := &FarmDB{
+		config:  config,
+		client:  client,
+		release: release,
+		start:   make(chan struct{}),
 	}
 
+	db := r.client.Database(config.Repositories["farmDB"].DB, config.Repositories["farmDB"].DatabaseOptions())
+	r.ColFarm = db.Collection("farm")
+	r.ColChart = db.Collection("chart")
+	r.ColHistory = db.Collection("history")
+
 	if err := farmIndex(r.ColFarm); err != nil {
 		return nil, err
 	}
@@ -112,6 +123,17 @@ func (f *FarmDB) Start() error {
 	}()
 }
 
+// Close releases the client of the repository.
+func (f *FarmDB) Close(ctx context.Context) error {
+	return f.release(ctx)
+}
+
+// collection returns col tuned for an operation class of
+// [Repositories.farmDB.operations] and the context to run the operation with.
+func (f *FarmDB) collection(col *mongo.Collection, class string) (*mongo.Collection, context.Context, context.CancelFunc) {
+	return f.config.Repositories["farmDB"].Collection(col, class)
+}
+
 func farmIndex(col *mongo.Collection) error {
 	index := mongo.IndexModel{
 		Keys: bson.D{
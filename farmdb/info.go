@@ -1,10 +1,10 @@
 ﻿package farmdb
 
 import (
-	"context"
 	"fmt"
 	"strings"
 
+	"github.com/coinmeca/db-connector/conf"
 	"github.com/coinmeca/go-common/commonlog"
 	"github.com/coinmeca/go-common/commonmethod/farm"
 	"go.mongodb.org/mongo-driver/bson"
@@ -14,7 +14,9 @@ import (
 )
 
 func (f *FarmDB) BulkWriteInfo(models []mongo.WriteModel) error {
-	result, err := f.ColFarm.BulkWrite(context.Background(), models)
+	col, ctx, cancel := f.collection(f.ColFarm, conf.OpInfoWrite)
+	defer cancel()
+	result, err := col.BulkWrite(ctx, models)
 	if err != nil {
 		commonlog.Logger.Error("FarmDB",
 			zap.String("BulkWriteInfo", err.Error()),
@@ -34,8 +36,10 @@ func (f *FarmDB) SaveFarmInfo(info *farm.Farm) error {
 	filter, update := f.BsonForInfo(info)
 	option := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
 
-	err := f.ColFarm.FindOneAndUpdate(
-		context.Background(),
+	col, ctx, cancel := f.collection(f.ColFarm, conf.OpInfoWrite)
+	defer cancel()
+	err := col.FindOneAndUpdate(
+		ctx,
 		filter,
 		update,
 		option,
@@ -53,7 +57,9 @@ func (f *FarmDB) GetFarm(chainId, address string) *farm.Farm {
 	result := &farm.Farm{}
 
 	filter := bson.M{"chainId": chainId, "address": strings.ToLower(address)}
-	if err := f.ColFarm.FindOne(context.Background(), filter, nil).Decode(&result); err != nil {
+	col, ctx, cancel := f.collection(f.ColFarm, conf.OpInfoRead)
+	defer cancel()
+	if err := col.FindOne(ctx, filter, nil).Decode(&result); err != nil {
 		commonlog.Logger.Error("GetFarms",
 			zap.String("not found ", err.Error()),
 		)
@@ -66,7 +72,9 @@ func (f *FarmDB) GetFarm(chainId, address string) *farm.Farm {
 func (f *FarmDB) GetFarms(chainId *string) ([]*farm.Farm, error) {
 	var farms []*farm.Farm
 	filter := bson.M{"chainId": chainId}
-	cursor, err := f.ColFarm.Find(context.Background(), filter)
+	col, ctx, cancel := f.collection(f.ColFarm, conf.OpInfoRead)
+	defer cancel()
+	cursor, err := col.Find(ctx, filter)
 
 	if err != nil {
 		commonlog.Logger.Error("GetFarms",
@@ -74,9 +82,9 @@ func (f *FarmDB) GetFarms(chainId *string) ([]*farm.Farm, error) {
 		)
 		return farms, err
 	}
-	defer cursor.Close(context.Background())
+	defer cursor.Close(ctx)
 
-	for cursor.Next(context.Background()) {
+	for cursor.Next(ctx) {
 		var f *farm.Farm
 		if err := cursor.Decode(&f); err == nil {
 			farms = append(farms, f)
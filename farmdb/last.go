@@ -1,8 +1,7 @@
 package farmdb
 
 import (
-	"context"
-
+	"github.com/coinmeca/db-connector/conf"
 	"github.com/coinmeca/go-common/commonlog"
 	"github.com/coinmeca/go-common/commonmethod/farm"
 	"github.com/coinmeca/go-common/commonutils"
@@ -16,10 +15,10 @@ func (f *FarmDB) GetStaking24h(nowTime *int64, last *farm.Last) {
 	ago24h := *nowTime - 86400
 	ago48h := ago24h - 86400
 
-	ctx := context.Background()
-
 	executePipeline := func(pipeline mongo.Pipeline) (primitive.Decimal128, error) {
-		cursor, err := f.ColHistory.Aggregate(ctx, pipeline)
+		col, ctx, cancel := f.collection(f.ColHistory, conf.OpAggregate)
+		defer cancel()
+		cursor, err := col.Aggregate(ctx, pipeline)
 		if err != nil {
 			return primitive.Decimal128{}, err
 		}
@@ -94,10 +93,10 @@ func (f *FarmDB) GetStaking24hBackup(nowTime *int64, last *farm.Last) {
 	ago24h := *nowTime - 86400
 	ago48h := ago24h - 86400
 
-	ctx := context.Background()
-
 	executePipeline := func(pipeline mongo.Pipeline) (bson.M, error) {
-		cursor, err := f.ColHistory.Aggregate(ctx, pipeline)
+		col, ctx, cancel := f.collection(f.ColHistory, conf.OpAggregate)
+		defer cancel()
+		cursor, err := col.Aggregate(ctx, pipeline)
 		if err != nil {
 			return nil, err
 		}
@@ -220,8 +219,6 @@ func (f *FarmDB) GetStaking24hBackup(nowTime *int64, last *farm.Last) {
 }
 
 func (f *FarmDB) GetInterest24h(nowTime *int64, last *farm.Last) {
-	ctx := context.Background()
-
 	latestPipeline := mongo.Pipeline{
 		{{
 			"$match", bson.M{
@@ -255,7 +252,9 @@ func (f *FarmDB) GetInterest24h(nowTime *int64, last *farm.Last) {
 	}
 
 	executePipeline := func(pipeline mongo.Pipeline) (primitive.Decimal128, error) {
-		cursor, err := f.ColChart.Aggregate(ctx, pipeline)
+		col, ctx, cancel := f.collection(f.ColChart, conf.OpAggregate)
+		defer cancel()
+		cursor, err := col.Aggregate(ctx, pipeline)
 		if err != nil {
 			return primitive.Decimal128{}, err
 		}
@@ -295,10 +294,10 @@ func (f *FarmDB) GetInterest24hBackup(nowTime *int64, last *farm.Last) {
 	ago24h := *nowTime - 86400
 	ago48h := ago24h - 86400
 
-	ctx := context.Background()
-
 	executePipeline := func(pipeline mongo.Pipeline) (bson.M, error) {
-		cursor, err := f.ColChart.Aggregate(ctx, pipeline)
+		col, ctx, cancel := f.collection(f.ColChart, conf.OpAggregate)
+		defer cancel()
+		cursor, err := col.Aggregate(ctx, pipeline)
 		if err != nil {
 			return nil, err
 		}
@@ -367,10 +366,10 @@ func (f *FarmDB) GetInterest24hBackup(nowTime *int64, last *farm.Last) {
 }
 
 func (f *FarmDB) GetStakedWithValue(nowTime *int64, last *farm.Last) {
-	ctx := context.Background()
-
 	executePipeline := func(pipeline mongo.Pipeline) (bson.M, error) {
-		cursor, err := f.ColChart.Aggregate(ctx, pipeline)
+		col, ctx, cancel := f.collection(f.ColChart, conf.OpAggregate)
+		defer cancel()
+		cursor, err := col.Aggregate(ctx, pipeline)
 		if err != nil {
 			return nil, err
 		}
@@ -516,10 +515,10 @@ func (f *FarmDB) GetStakedWithValue(nowTime *int64, last *farm.Last) {
 //}
 
 func (f *FarmDB) GetStakedWithValueBackup2(nowTime *int64, last *farm.Last) {
-	ctx := context.Background()
-
 	executePipeline := func(pipeline mongo.Pipeline) (bson.M, error) {
-		cursor, err := f.ColChart.Aggregate(ctx, pipeline)
+		col, ctx, cancel := f.collection(f.ColChart, conf.OpAggregate)
+		defer cancel()
+		cursor, err := col.Aggregate(ctx, pipeline)
 		if err != nil {
 			return nil, err
 		}
@@ -606,10 +605,10 @@ func (f *FarmDB) GetStakedWithValueBackup2(nowTime *int64, last *farm.Last) {
 }
 
 func (f *FarmDB) GetStakedWithValueBackup(nowTime *int64, last *farm.Last) {
-	ctx := context.Background()
-
 	executePipeline := func(pipeline mongo.Pipeline) (bson.M, error) {
-		cursor, err := f.ColChart.Aggregate(ctx, pipeline)
+		col, ctx, cancel := f.collection(f.ColChart, conf.OpAggregate)
+		defer cancel()
+		cursor, err := col.Aggregate(ctx, pipeline)
 		if err != nil {
 			return nil, err
 		}
@@ -688,10 +687,10 @@ func (f *FarmDB) GetStakedWithValueBackup(nowTime *int64, last *farm.Last) {
 }
 
 func (f *FarmDB) GetTotalInterest(nowTime *int64, last *farm.Last) {
-	ctx := context.Background()
-
 	executePipeline := func(pipeline mongo.Pipeline) (bson.M, error) {
-		cursor, err := f.ColChart.Aggregate(ctx, pipeline)
+		col, ctx, cancel := f.collection(f.ColChart, conf.OpAggregate)
+		defer cancel()
+		cursor, err := col.Aggregate(ctx, pipeline)
 		if err != nil {
 			return nil, err
 		}
@@ -2,9 +2,10 @@
 
 import (
 	"context"
-
+	"github.com/coinmeca/db-connector/conf"
 	"github.com/coinmeca/go-common/commonlog"
 	"github.com/coinmeca/go-common/commonmethod/farm"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.uber.org/zap"
 )
@@ -13,8 +14,10 @@ func (f *FarmDB) SaveFarmRecent(recent *farm.Recent) error {
 	filter, update := f.BsonForFarmRecent(recent)
 	option := options.Update().SetUpsert(true)
 
-	_, err := f.ColHistory.UpdateOne(
-		context.Background(),
+	col, ctx, cancel := f.collection(f.ColHistory, conf.OpHistoryWrite)
+	defer cancel()
+	_, err := col.UpdateOne(
+		ctx,
 		filter,
 		update,
 		option,
@@ -28,3 +31,25 @@ func (f *FarmDB) SaveFarmRecent(recent *farm.Recent) error {
 
 	return nil
 }
+
+// RollbackTxs removes the history of chainId recorded for the transactions of
+// txHashes, orphaned by a reorganization.
+func (f *FarmDB) RollbackTxs(ctx context.Context, chainId string, txHashes []string) (int64, error) {
+	filter := bson.M{
+		"chainId": chainId,
+		"txHash":  bson.M{"$in": txHashes},
+	}
+
+	col, opCtx, cancel := f.collection(f.ColHistory, conf.OpHistoryWrite)
+	defer cancel()
+	defer context.AfterFunc(ctx, cancel)()
+	result, err := col.DeleteMany(opCtx, filter)
+	if err != nil {
+		commonlog.Logger.Error("RollbackTxs",
+			zap.String("chainId", chainId),
+			zap.String("error", err.Error()),
+		)
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
@@ -5,6 +5,7 @@ go 1.22.0
 toolchain go1.22.3
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/coinmeca/go-common v0.0.9915
 	github.com/ethereum/go-ethereum v1.15.0
 	github.com/mitchellh/mapstructure v1.5.0
@@ -0,0 +1,148 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/coinmeca/db-connector/contractdb"
+	"github.com/coinmeca/db-connector/key"
+)
+
+// HealthChecker is implemented by repositories that can report their own
+// health beyond the reachability of their mongo client.
+type HealthChecker interface {
+	Health(ctx context.Context) error
+}
+
+// HealthReport is the result of Repositories.Health. Healthy is false when
+// any repository or target chain is unhealthy; checkpoint lag alone does not
+// make a chain unhealthy, so callers can apply their own threshold.
+type HealthReport struct {
+	Healthy      bool                         `json:"healthy"`
+	CheckedAt    time.Time                    `json:"checkedAt"`
+	Repositories map[string]*RepositoryHealth `json:"repositories"`
+	Chains       map[string]*ChainHealth      `json:"chains,omitempty"`
+}
+
+type RepositoryHealth struct {
+	Healthy bool          `json:"healthy"`
+	Latency time.Duration `json:"latency"`
+	Error   string        `json:"error,omitempty"`
+}
+
+type ChainHealth struct {
+	Healthy     bool   `json:"healthy"`
+	ActiveKey   bool   `json:"activeKey"`
+	Rpc         bool   `json:"rpc"`
+	LatestBlock uint64 `json:"latestBlock"`
+	Checkpoint  uint64 `json:"checkpoint"`
+	Finalized   uint64 `json:"finalized"`
+	Lag         int64  `json:"lag"`
+	Error       string `json:"error,omitempty"`
+
+	Endpoints []contractdb.EndpointStatus `json:"endpoints,omitempty"`
+}
+
+// Health pings the client of every repository and, when the key manager and
+// contract repository are registered, checks every target chain for an active
+// key, a reachable RPC endpoint and the distance between the chain head and
+// the stored checkpoint. Clients shared by several repositories are pinged
+// once.
+func (r *Repositories) Health(ctx context.Context) *HealthReport {
+	report := &HealthReport{
+		Healthy:      true,
+		CheckedAt:    time.Now(),
+		Repositories: make(map[string]*RepositoryHealth),
+	}
+
+	r.lock.RLock()
+	order := make([]string, len(r.order))
+	copy(order, r.order)
+	r.lock.RUnlock()
+
+	pinged := make(map[string]*RepositoryHealth)
+	for _, name := range order {
+		health := r.repositoryHealth(ctx, name, pinged)
+		report.Repositories[name] = health
+		report.Healthy = report.Healthy && health.Healthy
+	}
+
+	var k *key.KeyManager
+	var c *contractdb.ContractDB
+	if err := r.Get(&k, &c); err != nil {
+		return report
+	}
+
+	report.Chains = make(map[string]*ChainHealth)
+	for _, chainId := range c.GetTargetChains() {
+		health := chainHealth(ctx, k, c, chainId)
+		report.Chains[chainId] = health
+		report.Healthy = report.Healthy && health.Healthy
+	}
+
+	return report
+}
+
+func (r *Repositories) repositoryHealth(ctx context.Context, name string, pinged map[string]*RepositoryHealth) *RepositoryHealth {
+	health := &RepositoryHealth{Healthy: true}
+
+	if key, client, ok := r.clients.lookup(name); ok {
+		if cached, ok := pinged[key]; ok {
+			*health = *cached
+		} else {
+			start := time.Now()
+			if err := client.Ping(ctx, nil); err != nil {
+				health.Healthy = false
+				health.Error = err.Error()
+			}
+			health.Latency = time.Since(start)
+			pinged[key] = health
+		}
+	}
+
+	r.lock.RLock()
+	elem, ok := r.elems[r.names[name]]
+	r.lock.RUnlock()
+	if !ok || !health.Healthy {
+		return health
+	}
+
+	if checker, ok := elem.Interface().(HealthChecker); ok {
+		if err := checker.Health(ctx); err != nil {
+			return &RepositoryHealth{Latency: health.Latency, Error: err.Error()}
+		}
+	}
+
+	return health
+}
+
+func chainHealth(ctx context.Context, k *key.KeyManager, c *contractdb.ContractDB, chainId string) *ChainHealth {
+	health := &ChainHealth{Endpoints: c.GetEndpointStatus(chainId)}
+
+	if _, err := k.GetActiveKey(c.GetRpcProvider(chainId), chainId); err != nil {
+		health.Error = fmt.Sprintf("no active key: %v", err)
+		return health
+	}
+	health.ActiveKey = true
+
+	ethRepo := c.GetEthRepo(chainId)
+	if ethRepo == nil {
+		health.Error = "rpc unreachable: no client for the provider of the chain"
+		return health
+	}
+	latest, err := ethRepo.GetEthClient().BlockNumber(ctx)
+	if err != nil {
+		health.Error = fmt.Sprintf("rpc unreachable: %v", err)
+		return health
+	}
+	health.Rpc = true
+	health.LatestBlock = latest
+
+	health.Checkpoint = c.GetCheckpoint(&chainId).Uint64()
+	health.Finalized = c.GetFinalizedCheckpoint(&chainId).Uint64()
+	health.Lag = int64(health.LatestBlock) - int64(health.Checkpoint)
+	health.Healthy = true
+
+	return health
+}
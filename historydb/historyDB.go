@@ -2,6 +2,8 @@ package historydb
 
 import (
 	"context"
+	"errors"
+	"sync"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -19,35 +21,62 @@ type HistoryDB struct {
 	config *conf.Config
 
 	client       *mongo.Client
+	release      func(ctx context.Context) error
 	ColTxHistory *mongo.Collection
 
 	start           chan struct{}
+	stop            chan struct{}
+	stopOnce        sync.Once
+	pollersLock     sync.Mutex
+	closing         bool
+	pollers         sync.WaitGroup
 	lastProcessedId primitive.ObjectID
 }
 
-func NewDB(config *conf.Config) (commondatabase.IRepository, error) {
-	r := &HistoryDB{
-		config: config,
-		start:  make(chan struct{}),
-	}
+type HistoryDBInterface interface {
+	// getter
+	PollingTxs(ctx context.Context, notificationChan chan<- *commondatabase.GrpcTxData, interval time.Duration) error
+	PollingTxsBackup(callback func(manage *commondatabase.TxData), interval time.Duration)
 
-	var err error
-	credential := options.Credential{
-		Username: r.config.Repositories["historyDB"]["username"].(string),
-		Password: r.config.Repositories["historyDB"]["pass"].(string),
-	}
+	// setter
+	RollbackBlocks(ctx context.Context, chainId string, blockHashes []string) ([]string, error)
+	SaveTransactionRecord(txDetail *commondatabase.TxData) error
+
+	Start() error
+	Close(ctx context.Context) error
+}
 
-	clientOptions := options.Client().ApplyURI(config.Repositories["historyDB"]["datasource"].(string)).SetAuth(credential)
-	if r.client, err = mongo.Connect(context.Background(), clientOptions); err != nil {
+var _ HistoryDBInterface = (*HistoryDB)(nil)
+
+// NewDB connects a client of its own for [Repositories.historyDB], which Close
+// disconnects.
+func NewDB(config *conf.Config) (commondatabase.IRepository, error) {
+	client, err := config.Connect(context.Background(), "historyDB")
+	if err != nil {
 		return nil, err
 	}
 
-	if err = r.client.Ping(context.Background(), nil); err == nil {
-		db := r.client.Database(config.Repositories["historyDB"]["db"].(string))
-		r.ColTxHistory = db.Collection("tx_history")
-	} else {
+	r, err := NewDBWithClient(config, client, client.Disconnect)
+	if err != nil {
+		client.Disconnect(context.Background())
 		return nil, err
 	}
+	return r, nil
+}
+
+// NewDBWithClient builds the repository on a client shared with other
+// repositories. Close calls release instead of disconnecting the client.
+func NewDBWithClient(config *conf.Config, client *mongo.Client, release func(ctx context.Context) error) (commondatabase.IRepository, error) {
+	r := &HistoryDB{
+		config:  config,
+		client:  client,
+		release: release,
+		start:   make(chan struct{}),
+		stop:    make(chan struct{}),
+	}
+
+	db := r.client.Database(config.Repositories["historyDB"].DB, config.Repositories["historyDB"].DatabaseOptions())
+	r.ColTxHistory = db.Collection("tx_history")
 
 	if err := txIndex(r.ColTxHistory); err != nil {
 		return nil, err
@@ -71,6 +100,42 @@ func (h *HistoryDB) Start() error {
 	}()
 }
 
+// ErrClosed is returned by the pollers started after Close.
+var ErrClosed = errors.New("historyDB is closed")
+
+// Close stops running pollers, waits for them to return and releases the
+// client. Pollers started afterwards return at once.
+func (h *HistoryDB) Close(ctx context.Context) error {
+	h.pollersLock.Lock()
+	h.closing = true
+	h.pollersLock.Unlock()
+	h.stopOnce.Do(func() { close(h.stop) })
+
+	done := make(chan struct{})
+	go func() {
+		h.pollers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return h.release(ctx)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// startPoller registers a poller with Close, unless Close has begun.
+func (h *HistoryDB) startPoller() bool {
+	h.pollersLock.Lock()
+	defer h.pollersLock.Unlock()
+	if h.closing {
+		return false
+	}
+	h.pollers.Add(1)
+	return true
+}
+
 func txIndex(col *mongo.Collection) error {
 	index := mongo.IndexModel{
 		Keys: bson.D{
@@ -110,7 +175,43 @@ func (h *HistoryDB) SaveTransactionRecord(txDetail *commondatabase.TxData) error
 	return nil
 }
 
+// RollbackBlocks removes the transactions of chainId recorded in the blocks
+// of blockHashes, orphaned by a reorganization, and returns their hashes.
+func (h *HistoryDB) RollbackBlocks(ctx context.Context, chainId string, blockHashes []string) ([]string, error) {
+	filter := bson.M{
+		"chainId":   chainId,
+		"blockHash": bson.M{"$in": blockHashes},
+	}
+	opts := options.Find().SetProjection(bson.M{"hash": 1})
+	cursor, err := h.ColTxHistory.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var txs []struct {
+		Hash string `bson:"hash"`
+	}
+	if err := cursor.All(ctx, &txs); err != nil {
+		return nil, err
+	}
+
+	hashes := make([]string, 0, len(txs))
+	for _, tx := range txs {
+		hashes = append(hashes, tx.Hash)
+	}
+
+	if _, err := h.ColTxHistory.DeleteMany(ctx, filter); err != nil {
+		return nil, err
+	}
+	return hashes, nil
+}
+
 func (h *HistoryDB) PollingTxs(ctx context.Context, notificationChan chan<- *commondatabase.GrpcTxData, interval time.Duration) error {
+	if !h.startPoller() {
+		return ErrClosed
+	}
+	defer h.pollers.Done()
+
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
@@ -138,11 +239,21 @@ func (h *HistoryDB) PollingTxs(ctx context.Context, notificationChan chan<- *com
 					continue
 				}
 
-				notificationChan <- &txData
+				select {
+				case notificationChan <- &txData:
+				case <-h.stop:
+					cursor.Close(ctx)
+					return nil
+				case <-ctx.Done():
+					cursor.Close(ctx)
+					return ctx.Err()
+				}
 				h.lastProcessedId = newLastProcessedId
 			}
 
 			cursor.Close(ctx)
+		case <-h.stop:
+			return nil
 		case <-ctx.Done():
 			return ctx.Err()
 		}
@@ -150,6 +261,11 @@ func (h *HistoryDB) PollingTxs(ctx context.Context, notificationChan chan<- *com
 }
 
 func (h *HistoryDB) PollingTxsBackup(callback func(manage *commondatabase.TxData), interval time.Duration) {
+	if !h.startPoller() {
+		return
+	}
+	defer h.pollers.Done()
+
 	var lastProcessedId interface{} = nil
 
 	ticker := time.NewTicker(interval)
@@ -186,6 +302,8 @@ func (h *HistoryDB) PollingTxsBackup(callback func(manage *commondatabase.TxData
 			}
 
 			cursor.Close(context.Background())
+		case <-h.stop:
+			return
 		}
 	}
 }
@@ -0,0 +1,405 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/coinmeca/db-connector/journal"
+	"github.com/coinmeca/go-common/commonlog"
+	"github.com/coinmeca/go-common/commonprotocol"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+)
+
+// growAfter is the number of eth_getLogs requests in a row that have to
+// succeed before the block range doubles.
+const growAfter = 10
+
+// chainIndexer indexes one chain. next is the first block not indexed yet,
+// final the first one not delivered to the handlers of final blocks, start
+// the block indexing started at and blockRange the number of blocks asked for
+// at once.
+type chainIndexer struct {
+	ix         *Indexer
+	chainId    string
+	next       uint64
+	final      uint64
+	start      uint64
+	blockRange uint64
+	successes  int
+	contracts  map[string]*commonprotocol.Contract
+	// finalFailed tells the last final block could not be read, which is
+	// warned about once until it is read again.
+	finalFailed bool
+	// stamps holds when the dispatch of the blocks not saved yet started,
+	// which the writes for them are stamped with, see journal. It outlives a
+	// failed step so a retried block keeps the stamp of the first attempt.
+	stamps map[uint64]int64
+}
+
+func (ix *Indexer) run(chainId string, stop <-chan struct{}) {
+	defer ix.workers.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+		case <-ix.stop:
+		case <-ctx.Done():
+		}
+		cancel()
+	}()
+
+	c := &chainIndexer{
+		ix:         ix,
+		chainId:    chainId,
+		blockRange: ix.conf.Indexer.MaxRange(),
+	}
+	commonlog.Logger.Info("indexer started",
+		zap.String("chainId", chainId),
+	)
+
+	for {
+		caughtUp, err := c.step(ctx)
+		if err == nil && ix.hasFinalHandlers() {
+			// a failure here is retried with the next step, it does not
+			// hold up the head
+			finalCaughtUp, ferr := c.stepFinal(ctx)
+			if ferr != nil && ctx.Err() == nil {
+				commonlog.Logger.Error("indexer",
+					zap.String("chainId", chainId),
+					zap.Uint64("final from", c.final),
+					zap.String("error", ferr.Error()),
+				)
+			}
+			caughtUp = caughtUp && finalCaughtUp
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			commonlog.Logger.Error("indexer",
+				zap.String("chainId", chainId),
+				zap.Uint64("from", c.next),
+				zap.String("error", err.Error()),
+			)
+		}
+		if err == nil && !caughtUp {
+			continue
+		}
+
+		select {
+		case <-time.After(ix.conf.Indexer.IntervalDuration()):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// step indexes the next range of blocks and reports whether the chain head is
+// reached.
+func (c *chainIndexer) step(ctx context.Context) (bool, error) {
+	var head hexutil.Uint64
+	if err := c.ix.contract.Call(c.chainId, &head, "eth_blockNumber"); err != nil {
+		return true, err
+	}
+
+	if c.next == 0 {
+		// a failed read must not look like a chain without checkpoint, which
+		// would skip the blocks up to the start block or the head
+		checkpoint, err := c.ix.contract.GetCheckpointNumber(&c.chainId)
+		if err != nil {
+			return true, err
+		}
+		if checkpoint > 0 {
+			c.next = checkpoint + 1
+		} else if start := c.ix.startBlock(c.chainId); start > 0 {
+			c.next = start
+		} else {
+			// without a start block only new logs are indexed
+			c.next = uint64(head)
+		}
+		c.start = c.next
+	}
+	if c.next > uint64(head) {
+		return true, nil
+	}
+
+	if uint64(head)-c.next < uint64(c.ix.conf.Checkpoint.WindowSize()) {
+		if rolledBack, err := c.checkReorg(ctx); err != nil || rolledBack {
+			return false, err
+		}
+	}
+
+	addresses, err := c.ix.contract.GetContractAddresses(c.chainId)
+	if err != nil {
+		return true, err
+	}
+	if len(addresses) == 0 {
+		return true, c.save(c.next, uint64(head), uint64(head))
+	}
+
+	logs, to, err := c.getLogs(c.next, uint64(head), addresses)
+	if err != nil {
+		return true, err
+	}
+
+	// contracts are looked up once per range
+	c.contracts = make(map[string]*commonprotocol.Contract)
+	if c.stamps == nil {
+		c.stamps = make(map[uint64]int64)
+	}
+	defer journal.End(c.chainId)
+	for i, log := range logs {
+		if log.Removed {
+			continue
+		}
+		// once stopped, the block being dispatched is finished first
+		if ctx.Err() != nil && (i == 0 || log.BlockNumber != logs[i-1].BlockNumber) {
+			if log.BlockNumber > c.next {
+				return true, errors.Join(ctx.Err(), c.save(c.next, log.BlockNumber-1, uint64(head)))
+			}
+			return true, ctx.Err()
+		}
+		if _, ok := c.stamps[log.BlockNumber]; !ok {
+			c.stamps[log.BlockNumber] = journal.Now()
+		}
+		journal.Begin(c.chainId, c.stamps[log.BlockNumber])
+		if err := c.dispatch(c.ix.drain, log, false); err != nil {
+			// the blocks before the one that failed are done
+			if log.BlockNumber > c.next {
+				if serr := c.save(c.next, log.BlockNumber-1, uint64(head)); serr != nil {
+					err = errors.Join(err, serr)
+				}
+			}
+			return true, err
+		}
+	}
+
+	return to == uint64(head), c.save(c.next, to, uint64(head))
+}
+
+// getLogs returns the logs of addresses from from up to at most head and the
+// last block they cover. The range is halved until the provider accepts it
+// and doubles again after growAfter successes.
+func (c *chainIndexer) getLogs(from, head uint64, addresses []string) ([]types.Log, uint64, error) {
+	minRange := c.ix.conf.Indexer.MinRange()
+	for {
+		to := min(from+c.blockRange-1, head)
+		filter := map[string]interface{}{
+			"fromBlock": hexutil.EncodeUint64(from),
+			"toBlock":   hexutil.EncodeUint64(to),
+			"address":   addresses,
+		}
+
+		var logs []types.Log
+		err := c.ix.contract.Call(c.chainId, &logs, "eth_getLogs", filter)
+		if err == nil {
+			if c.successes++; c.successes >= growAfter {
+				c.blockRange = min(c.blockRange*2, c.ix.conf.Indexer.MaxRange())
+				c.successes = 0
+			}
+			return logs, to, nil
+		}
+		c.successes = 0
+		if c.blockRange <= minRange {
+			return nil, 0, fmt.Errorf("eth_getLogs %d-%d: %w", from, to, err)
+		}
+
+		c.blockRange = max(c.blockRange/2, minRange)
+		commonlog.Logger.Warn("indexer: block range shrunk",
+			zap.String("chainId", c.chainId),
+			zap.Uint64("range", c.blockRange),
+			zap.String("error", err.Error()),
+		)
+	}
+}
+
+// stepFinal delivers the next range of final blocks already indexed to the
+// handlers of OnFinalized and moves the finalized checkpoint, reporting
+// whether it caught up with the head checkpoint or the last final block. A
+// last final block that cannot be read is warned about instead of failing.
+func (c *chainIndexer) stepFinal(ctx context.Context) (bool, error) {
+	if c.next == 0 {
+		return true, nil
+	}
+	finalized, err := c.ix.contract.GetFinalizedBlock(c.chainId)
+	if err != nil {
+		// chains without the block tag fail every poll, so say it once
+		if !c.finalFailed {
+			c.finalFailed = true
+			commonlog.Logger.Warn("indexer: final block unknown",
+				zap.String("chainId", c.chainId),
+				zap.String("error", err.Error()),
+				zap.String("hint", "set [Checkpoint.Finality] if the chain has no such block tag"),
+			)
+		}
+		return true, nil
+	}
+	c.finalFailed = false
+	last := min(finalized, c.next-1)
+
+	if c.final == 0 {
+		if checkpoint := c.ix.contract.GetFinalizedCheckpoint(&c.chainId); checkpoint.Sign() > 0 {
+			c.final = checkpoint.Uint64() + 1
+		} else {
+			c.final = c.start
+		}
+	}
+	if c.final > last {
+		return true, nil
+	}
+	addresses, err := c.ix.contract.GetContractAddresses(c.chainId)
+	if err != nil {
+		return true, err
+	}
+	if len(addresses) == 0 {
+		return true, c.saveFinal(last)
+	}
+
+	logs, to, err := c.getLogs(c.final, last, addresses)
+	if err != nil {
+		return true, err
+	}
+
+	c.contracts = make(map[string]*commonprotocol.Contract)
+	for i, log := range logs {
+		if log.Removed {
+			continue
+		}
+		if ctx.Err() != nil && (i == 0 || log.BlockNumber != logs[i-1].BlockNumber) {
+			if log.BlockNumber > c.final {
+				return true, errors.Join(ctx.Err(), c.saveFinal(log.BlockNumber-1))
+			}
+			return true, ctx.Err()
+		}
+		if err := c.dispatch(c.ix.drain, log, true); err != nil {
+			if log.BlockNumber > c.final {
+				if serr := c.saveFinal(log.BlockNumber - 1); serr != nil {
+					err = errors.Join(err, serr)
+				}
+			}
+			return true, err
+		}
+	}
+
+	return to == last, c.saveFinal(to)
+}
+
+func (c *chainIndexer) dispatch(ctx context.Context, log types.Log, final bool) error {
+	contract, err := c.contract(log.Address.Hex())
+	if err != nil || contract == nil {
+		return err
+	}
+	event, err := decode(c.chainId, contract, log)
+	if err != nil || event == nil {
+		return err
+	}
+
+	for _, handler := range c.ix.handlersOf(contract.Name, event.Name, final) {
+		if err := handler(ctx, event); err != nil {
+			return fmt.Errorf("%s.%s in block %d: %w", contract.Name, event.Name, log.BlockNumber, err)
+		}
+	}
+	return nil
+}
+
+// contract returns the contract deployed at address, nil if it is not
+// registered any more.
+func (c *chainIndexer) contract(address string) (*commonprotocol.Contract, error) {
+	if contract, ok := c.contracts[address]; ok {
+		return contract, nil
+	}
+	contract, err := c.ix.contract.GetContractByAddress(c.chainId, address)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		contract, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.contracts[address] = contract
+	return contract, nil
+}
+
+// checkReorg compares the parent of the next block with the blocks kept with
+// the checkpoint and rolls back to their common ancestor if they differ.
+func (c *chainIndexer) checkReorg(ctx context.Context) (bool, error) {
+	next, err := c.ix.contract.GetBlockRef(c.chainId, c.next)
+	if err != nil {
+		return false, err
+	}
+	reorg, err := c.ix.contract.FindReorg(c.chainId, *next)
+	if err != nil || reorg == nil {
+		return false, err
+	}
+
+	if rollback := c.ix.rollback(); rollback != nil {
+		err = rollback(ctx, reorg)
+	} else {
+		err = c.ix.contract.RewindCheckpoint(&c.chainId, reorg.Ancestor)
+	}
+	if err != nil {
+		return false, fmt.Errorf("rollback to block %d: %w", reorg.Ancestor.Number, err)
+	}
+
+	commonlog.Logger.Warn("indexer rolled back",
+		zap.String("chainId", c.chainId),
+		zap.Uint64("ancestor", reorg.Ancestor.Number),
+		zap.Uint64("from", c.next),
+	)
+	c.next = reorg.Ancestor.Number + 1
+	c.final = min(c.final, c.next)
+	c.stamps = nil
+	return true, nil
+}
+
+// save moves the checkpoint to to, keeping the hashes of the blocks from from
+// to to that are within the checkpoint window of head.
+func (c *chainIndexer) save(from, to, head uint64) error {
+	window := uint64(c.ix.conf.Checkpoint.WindowSize())
+	if head-to >= window {
+		from = to
+	} else if to+1 > window {
+		from = max(from, to+1-window)
+	}
+
+	blocks, err := c.ix.contract.GetBlockRefs(c.chainId, from, to)
+	if err != nil {
+		return err
+	}
+
+	// a block without events is stamped like the next one with events, the
+	// writes for it or later blocks all happen after
+	indexed := journal.Now()
+	for i := len(blocks) - 1; i >= 0; i-- {
+		if stamp, ok := c.stamps[blocks[i].Number]; ok {
+			indexed = stamp
+		}
+		blocks[i].Indexed = indexed
+	}
+
+	if err := c.ix.contract.SaveCheckpointBlocks(&c.chainId, blocks); err != nil {
+		return err
+	}
+	for number := range c.stamps {
+		if number <= to {
+			delete(c.stamps, number)
+		}
+	}
+	c.next = to + 1
+	return nil
+}
+
+func (c *chainIndexer) saveFinal(block uint64) error {
+	if err := c.ix.contract.SaveFinalizedCheckpoint(&c.chainId, new(big.Int).SetUint64(block)); err != nil {
+		return err
+	}
+	c.final = block + 1
+	return nil
+}
@@ -0,0 +1,104 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/coinmeca/go-common/commonprotocol"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Event is a log of a registered contract, decoded with the ABI of the
+// contract version deployed at the address that emitted it.
+type Event struct {
+	ChainId  string
+	Contract *commonprotocol.Contract
+	Name     string
+	// Args holds the indexed and non-indexed arguments by name.
+	Args map[string]interface{}
+	Log  types.Log
+}
+
+// Handler processes an event. An error stops the indexer of the chain, which
+// delivers the event again after [Indexer.Interval].
+type Handler func(ctx context.Context, event *Event) error
+
+// Decode fills out, a pointer to a struct with a field per argument, with the
+// arguments of the event.
+func (e *Event) Decode(out interface{}) error {
+	event, ok := e.Contract.Abi.Events[e.Name]
+	if !ok {
+		return fmt.Errorf("event %s not in the abi of %s", e.Name, e.Contract.Name)
+	}
+	if len(e.Log.Data) > 0 {
+		if err := e.Contract.Abi.UnpackIntoInterface(out, e.Name, e.Log.Data); err != nil {
+			return err
+		}
+	}
+
+	var indexed abi.Arguments
+	for _, arg := range event.Inputs {
+		if arg.Indexed {
+			indexed = append(indexed, arg)
+		}
+	}
+	return abi.ParseTopics(out, indexed, e.Log.Topics[1:])
+}
+
+// OnEvent registers handler for event of the contract named contractName,
+// with the arguments decoded into T.
+func OnEvent[T any](ix IndexerInterface, contractName, event string, handler func(ctx context.Context, event *Event, args *T) error) {
+	ix.On(contractName, event, typed(handler))
+}
+
+// OnFinalizedEvent is OnEvent for logs of final blocks only.
+func OnFinalizedEvent[T any](ix IndexerInterface, contractName, event string, handler func(ctx context.Context, event *Event, args *T) error) {
+	ix.OnFinalized(contractName, event, typed(handler))
+}
+
+func typed[T any](handler func(ctx context.Context, event *Event, args *T) error) Handler {
+	return func(ctx context.Context, e *Event) error {
+		args := new(T)
+		if err := e.Decode(args); err != nil {
+			return fmt.Errorf("%s.%s: %w", e.Contract.Name, e.Name, err)
+		}
+		return handler(ctx, e, args)
+	}
+}
+
+// decode returns the event of log, or nil for logs of an event missing from
+// the ABI of contract.
+func decode(chainId string, contract *commonprotocol.Contract, log types.Log) (*Event, error) {
+	if len(log.Topics) == 0 {
+		return nil, nil
+	}
+	event, err := contract.Abi.EventByID(log.Topics[0])
+	if err != nil {
+		return nil, nil
+	}
+
+	args := make(map[string]interface{})
+	if len(log.Data) > 0 {
+		if err := contract.Abi.UnpackIntoMap(args, event.Name, log.Data); err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", contract.Name, event.Name, err)
+		}
+	}
+	var indexed abi.Arguments
+	for _, arg := range event.Inputs {
+		if arg.Indexed {
+			indexed = append(indexed, arg)
+		}
+	}
+	if err := abi.ParseTopicsIntoMap(args, indexed, log.Topics[1:]); err != nil {
+		return nil, fmt.Errorf("%s.%s: %w", contract.Name, event.Name, err)
+	}
+
+	return &Event{
+		ChainId:  chainId,
+		Contract: contract,
+		Name:     event.Name,
+		Args:     args,
+		Log:      log,
+	}, nil
+}
@@ -0,0 +1,237 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+
+	"github.com/coinmeca/db-connector/conf"
+	"github.com/coinmeca/db-connector/contractdb"
+	"github.com/coinmeca/go-common/commonlog"
+	"go.uber.org/zap"
+)
+
+// Wildcard matches every contract or every event in On.
+const Wildcard = "*"
+
+// Indexer pulls the logs of the registered contracts of every target chain,
+// decodes them with the stored ABIs and passes them to the handlers. The
+// checkpoint of a chain only moves past a block once every handler of its
+// logs succeeded, so after a failure or a restart logs are delivered again:
+// handlers have to tolerate seeing a log more than once. Near the head the
+// hashes of the indexed blocks are kept with the checkpoint, and a
+// reorganization rolls the chain back to the last block still part of it.
+type Indexer struct {
+	conf     *conf.Config
+	contract contractdb.ContractDBInterface
+
+	lock        sync.RWMutex
+	handlers    []registration
+	onReorg     func(ctx context.Context, reorg *contractdb.Reorg) error
+	startBlocks map[string]uint64
+	chains      map[string]chan struct{}
+
+	start     chan struct{}
+	startOnce sync.Once
+	stop      chan struct{}
+	stopOnce  sync.Once
+	workers   sync.WaitGroup
+	// drain is the context of the handlers. It outlives stop, so handlers
+	// running when Close is called can finish, and is canceled once the
+	// context of Close is done.
+	drain       context.Context
+	cancelDrain context.CancelFunc
+}
+
+type registration struct {
+	contract string
+	event    string
+	final    bool
+	handler  Handler
+}
+
+type IndexerInterface interface {
+	// setter
+	On(contractName, event string, handler Handler)
+	OnFinalized(contractName, event string, handler Handler)
+	OnReorg(rollback func(ctx context.Context, reorg *contractdb.Reorg) error)
+
+	OnConfigChange(event conf.Event)
+
+	Start() error
+	Close(ctx context.Context) error
+}
+
+var _ IndexerInterface = (*Indexer)(nil)
+
+func NewIndexer(config *conf.Config, contract contractdb.ContractDBInterface) *Indexer {
+	ix := &Indexer{
+		conf:        config,
+		contract:    contract,
+		startBlocks: make(map[string]uint64),
+		chains:      make(map[string]chan struct{}),
+		start:       make(chan struct{}),
+		stop:        make(chan struct{}),
+	}
+	ix.drain, ix.cancelDrain = context.WithCancel(context.Background())
+	for chainId, block := range config.Log.Block {
+		if block.StartBlock > 0 {
+			ix.startBlocks[chainId] = uint64(block.StartBlock)
+		}
+	}
+	return ix
+}
+
+// On registers handler for the logs of event emitted by the contract named
+// contractName. Either may be Wildcard. Handlers of a log run in the order
+// they were registered. The logs are delivered as soon as their block is
+// indexed, so a reorganization can orphan them later.
+func (ix *Indexer) On(contractName, event string, handler Handler) {
+	ix.register(registration{contract: contractName, event: event, handler: handler})
+}
+
+// OnFinalized is On for logs of final blocks only, as set by
+// [Checkpoint.Finality]. They are delivered behind the finalized checkpoint,
+// which follows the head checkpoint while such handlers are registered.
+// Blocks indexed before the finalized checkpoint was first saved are not
+// delivered again.
+func (ix *Indexer) OnFinalized(contractName, event string, handler Handler) {
+	ix.register(registration{contract: contractName, event: event, final: true, handler: handler})
+}
+
+func (ix *Indexer) register(r registration) {
+	ix.lock.Lock()
+	defer ix.lock.Unlock()
+	ix.handlers = append(ix.handlers, r)
+}
+
+// OnReorg sets the rollback run when a reorganization is found, before the
+// blocks after the common ancestor are indexed again. It has to move the
+// checkpoint back to the ancestor, which is all the indexer does without one.
+func (ix *Indexer) OnReorg(rollback func(ctx context.Context, reorg *contractdb.Reorg) error) {
+	ix.lock.Lock()
+	defer ix.lock.Unlock()
+	ix.onReorg = rollback
+}
+
+func (ix *Indexer) rollback() func(ctx context.Context, reorg *contractdb.Reorg) error {
+	ix.lock.RLock()
+	defer ix.lock.RUnlock()
+	return ix.onReorg
+}
+
+func (ix *Indexer) handlersOf(contractName, event string, final bool) []Handler {
+	ix.lock.RLock()
+	defer ix.lock.RUnlock()
+
+	result := make([]Handler, 0)
+	for _, r := range ix.handlers {
+		if r.final == final && (r.contract == Wildcard || r.contract == contractName) && (r.event == Wildcard || r.event == event) {
+			result = append(result, r.handler)
+		}
+	}
+	return result
+}
+
+// Start runs a worker for every target chain. It fails when called again.
+func (ix *Indexer) Start() error {
+	started := false
+	ix.startOnce.Do(func() {
+		started = true
+		close(ix.start)
+		ix.reconcile()
+	})
+	if !started {
+		return errors.New("indexer already started")
+	}
+	return nil
+}
+
+// Close stops the workers once the blocks they dispatch are done, letting the
+// handlers running finish as long as ctx allows. The context of the handlers
+// is canceled when ctx is done.
+func (ix *Indexer) Close(ctx context.Context) error {
+	ix.stopOnce.Do(func() { close(ix.stop) })
+
+	done := make(chan struct{})
+	go func() {
+		ix.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		ix.cancelDrain()
+		return nil
+	case <-ctx.Done():
+		ix.cancelDrain()
+		return ctx.Err()
+	}
+}
+
+// OnConfigChange follows the target chains and the start blocks of a reloaded
+// config. A new start block only applies to chains without a checkpoint.
+func (ix *Indexer) OnConfigChange(event conf.Event) {
+	switch e := event.(type) {
+	case conf.ChainsChanged:
+		ix.reconcile()
+	case conf.StartBlockChanged:
+		ix.lock.Lock()
+		ix.startBlocks[e.ChainId] = uint64(max(e.New, 0))
+		ix.lock.Unlock()
+	}
+}
+
+func (ix *Indexer) hasFinalHandlers() bool {
+	ix.lock.RLock()
+	defer ix.lock.RUnlock()
+	return slices.ContainsFunc(ix.handlers, func(r registration) bool { return r.final })
+}
+
+func (ix *Indexer) startBlock(chainId string) uint64 {
+	ix.lock.RLock()
+	defer ix.lock.RUnlock()
+	return ix.startBlocks[chainId]
+}
+
+// reconcile starts a worker for every target chain without one and stops the
+// workers of the chains that are no target any more.
+func (ix *Indexer) reconcile() {
+	select {
+	case <-ix.start:
+	default:
+		return
+	}
+
+	targets := ix.contract.GetTargetChains()
+
+	ix.lock.Lock()
+	defer ix.lock.Unlock()
+
+	select {
+	case <-ix.stop:
+		return
+	default:
+	}
+
+	wanted := make(map[string]bool, len(targets))
+	for _, chainId := range targets {
+		wanted[chainId] = true
+		if _, ok := ix.chains[chainId]; ok {
+			continue
+		}
+		stop := make(chan struct{})
+		ix.chains[chainId] = stop
+		ix.workers.Add(1)
+		go ix.run(chainId, stop)
+	}
+	for chainId, stop := range ix.chains {
+		if !wanted[chainId] {
+			close(stop)
+			delete(ix.chains, chainId)
+			commonlog.Logger.Info("indexer stopped",
+				zap.String("chainId", chainId),
+			)
+		}
+	}
+}
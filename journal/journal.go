@@ -0,0 +1,172 @@
+// Package journal keeps the revisions of aggregated documents, like chart
+// buckets, so the writes made after a point in time can be undone when the
+// blocks they came from are orphaned by a reorganization.
+//
+// Every write records the document as it was before, stamped in unix
+// nanoseconds with the time the indexer started dispatching the block it is
+// made for, see Begin. Only the first write of a block records a revision, so
+// a document keeps one revision per block. Rollback restores the documents
+// written since a time to the first revision recorded at or after it, and
+// deletes those created since.
+package journal
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Field is the field of a document holding its revisions.
+const Field = "revisions"
+
+var (
+	lock   sync.Mutex
+	stamps = make(map[string]int64)
+)
+
+// Now returns the time to stamp a write with.
+func Now() int64 {
+	return time.Now().UnixNano()
+}
+
+// Begin stamps the writes for chainId with stamp until End is called, the
+// time the dispatch of the block they are made for started.
+func Begin(chainId string, stamp int64) {
+	lock.Lock()
+	defer lock.Unlock()
+	stamps[chainId] = stamp
+}
+
+// End stops stamping the writes for chainId with the stamp of a block.
+func End(chainId string) {
+	lock.Lock()
+	defer lock.Unlock()
+	delete(stamps, chainId)
+}
+
+// Stamp returns the time to stamp a write for chainId with: that of the block
+// being dispatched, or Now outside of a dispatch.
+func Stamp(chainId string) int64 {
+	lock.Lock()
+	defer lock.Unlock()
+	if stamp, ok := stamps[chainId]; ok {
+		return stamp
+	}
+	return Now()
+}
+
+// Update returns update, made of $set, $setOnInsert, $inc, $max and $min, as a
+// pipeline recording the revision of the document before it is applied.
+// marker is a field every write sets: the document is new when it is missing.
+// No revision is recorded if the last one is stamped at already, and only the
+// last limit revisions are kept, enough to undo the writes of as many blocks.
+// Writes stamped with Now take a revision each, so they wear the limit down
+// faster.
+func Update(update bson.M, marker string, at int64, limit int) (mongo.Pipeline, error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("journal: limit %d must be positive", limit)
+	}
+	created := bson.M{"$eq": bson.A{bson.M{"$type": "$" + marker}, "missing"}}
+
+	revision := bson.M{
+		"at":      at,
+		"created": created,
+		// the document without its id and revisions
+		"state": bson.M{"$arrayToObject": bson.M{"$filter": bson.M{
+			"input": bson.M{"$objectToArray": "$$ROOT"},
+			"cond":  bson.M{"$not": bson.A{bson.M{"$in": bson.A{"$$this.k", bson.A{"_id", Field}}}}},
+		}}},
+	}
+	revisions := bson.M{"$let": bson.M{
+		"vars": bson.M{"kept": bson.M{"$ifNull": bson.A{"$" + Field, bson.A{}}}},
+		"in": bson.M{"$cond": bson.A{
+			bson.M{"$eq": bson.A{bson.M{"$arrayElemAt": bson.A{"$$kept.at", -1}}, at}},
+			"$$kept",
+			bson.M{"$slice": bson.A{bson.M{"$concatArrays": bson.A{"$$kept", bson.A{revision}}}, -limit}},
+		}},
+	}}
+
+	set := bson.M{}
+	for op, fields := range update {
+		values, ok := fields.(bson.M)
+		if !ok {
+			return nil, fmt.Errorf("journal: %s must be a document", op)
+		}
+		for field, value := range values {
+			value := bson.M{"$literal": value}
+			switch op {
+			case "$set":
+				set[field] = value
+			case "$setOnInsert":
+				set[field] = bson.M{"$cond": bson.A{created, value, "$" + field}}
+			case "$inc":
+				set[field] = bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$" + field, 0}}, value}}
+			case "$max":
+				set[field] = bson.M{"$max": bson.A{"$" + field, value}}
+			case "$min":
+				set[field] = bson.M{"$min": bson.A{"$" + field, value}}
+			default:
+				return nil, fmt.Errorf("journal: unsupported operator %s", op)
+			}
+		}
+	}
+
+	return mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{Field: revisions}}},
+		{{Key: "$set", Value: set}},
+	}, nil
+}
+
+// Rollback undoes the writes made at or after since to the documents of col
+// matching filter. It returns the number of documents restored or deleted.
+func Rollback(ctx context.Context, col *mongo.Collection, filter bson.M, since int64) (int64, error) {
+	// the revision of the first write since, holding the document before it
+	first := bson.M{"$arrayElemAt": bson.A{bson.M{"$filter": bson.M{
+		"input": bson.M{"$ifNull": bson.A{"$" + Field, bson.A{}}},
+		"cond":  bson.M{"$gte": bson.A{"$$this.at", since}},
+	}}, 0}}
+
+	created := bson.M{}
+	for k, v := range filter {
+		created[k] = v
+	}
+	created["$expr"] = bson.M{"$eq": bson.A{bson.M{"$let": bson.M{
+		"vars": bson.M{"first": first},
+		"in":   "$$first.created",
+	}}, true}}
+
+	deleted, err := col.DeleteMany(ctx, created)
+	if err != nil {
+		return 0, err
+	}
+
+	written := bson.M{}
+	for k, v := range filter {
+		written[k] = v
+	}
+	written[Field+".at"] = bson.M{"$gte": since}
+
+	restored, err := col.UpdateMany(ctx, written, mongo.Pipeline{
+		{{Key: "$replaceWith", Value: bson.M{"$let": bson.M{
+			"vars": bson.M{"first": first},
+			"in": bson.M{"$mergeObjects": bson.A{
+				"$$first.state",
+				bson.M{
+					"_id": "$_id",
+					Field: bson.M{"$filter": bson.M{
+						"input": "$" + Field,
+						"cond":  bson.M{"$lt": bson.A{"$$this.at", since}},
+					}},
+				},
+			}},
+		}}}},
+	})
+	if err != nil {
+		return deleted.DeletedCount, err
+	}
+	return deleted.DeletedCount + restored.ModifiedCount, nil
+}
@@ -3,6 +3,8 @@
 import (
 	"context"
 	"errors"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/coinmeca/db-connector/conf"
@@ -18,39 +20,102 @@ type KeyManager struct {
 	config *conf.Config
 
 	client     *mongo.Client
+	release    func(ctx context.Context) error
 	db         *mongo.Database
 	Collection map[string]*mongo.Collection
 
-	start   chan struct{}
-	Current map[string]*commondatabase.APIKey
+	start    chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+	workers  sync.WaitGroup
+
+	providers map[string]*Provider
+	keystore  *Keystore
+
+	// lock guards Collection and pools.
+	lock  sync.Mutex
+	pools map[string]*Pool
 }
 
-// NewKeyManager returns KeyManager as IRepository
-func NewKeyManager(config *conf.Config) (*KeyManager, error) {
-	r := &KeyManager{
-		config: config,
-		start:  make(chan struct{}),
-	}
+type KeyManagerInterface interface {
+	// getter
+	GetActiveKey(cate, chainId string) (*commondatabase.APIKey, error)
+	GetActiveKeys(cate, chainId string) ([]*commondatabase.APIKey, error)
+	GetCurrentKey(cate, chainId string) *commondatabase.APIKey
+	GetKeyStatus(cate, chainId string) ([]*KeyStatus, error)
+	GetKeyUsage(cate, chainId string) map[string]Usage
+	GetNewKey(cate, chainId string) (*commondatabase.APIKey, error)
+	GetNewKeys(cate, chainId string) ([]*commondatabase.APIKey, error)
+	Provider(cate string) (*Provider, error)
+
+	// setter
+	AddKey(cate, chainId string, key *commondatabase.APIKey) error
+	BackoffKey(cate, chainId, key string, wait time.Duration) error
+	DropKey(cate, chainId, key string)
+	EncryptKeys(ctx context.Context) (int, error)
+	ExpiredKey(cate, chainId, key string) error
+	InitKey(cate, chainId string) (*commondatabase.APIKey, error)
+	InvalidKey(cate, chainId, key string) error
+	ProbeKeys(ctx context.Context) (int, error)
+	RecordUsage(cate, chainId, key, method string)
+	RotateMasterKey(ctx context.Context, master []byte) (int, error)
+	SetKey(cate, chainId, key string) error
+	SyncPools()
+
+	Start() error
+	Close(ctx context.Context) error
+}
 
-	var err error
-	credential := options.Credential{
-		Username: r.config.Repositories["keyDB"]["username"].(string),
-		Password: r.config.Repositories["keyDB"]["pass"].(string),
-	}
+var _ KeyManagerInterface = (*KeyManager)(nil)
 
-	clientOptions := options.Client().ApplyURI(config.Repositories["keyDB"]["datasource"].(string)).SetAuth(credential)
-	if r.client, err = mongo.Connect(context.Background(), clientOptions); err != nil {
+// NewKeyManager returns KeyManager as IRepository. It connects a client of its
+// own for [Repositories.keyDB], which Close disconnects.
+func NewKeyManager(config *conf.Config) (*KeyManager, error) {
+	client, err := config.Connect(context.Background(), "keyDB")
+	if err != nil {
 		return nil, err
 	}
 
-	if err = r.client.Ping(context.Background(), nil); err == nil {
-		r.db = r.client.Database(config.Repositories["keyDB"]["db"].(string))
-	} else {
+	r, err := NewKeyManagerWithClient(config, client, client.Disconnect)
+	if err != nil {
+		client.Disconnect(context.Background())
 		return nil, err
 	}
+	return r, nil
+}
+
+// NewKeyManagerWithClient builds KeyManager on a client shared with other
+// repositories. Close calls release instead of disconnecting the client.
+func NewKeyManagerWithClient(config *conf.Config, client *mongo.Client, release func(ctx context.Context) error) (*KeyManager, error) {
+	r := &KeyManager{
+		config:  config,
+		client:  client,
+		release: release,
+		start:   make(chan struct{}),
+		stop:    make(chan struct{}),
+	}
 
+	r.db = r.client.Database(config.Repositories["keyDB"].DB, config.Repositories["keyDB"].DatabaseOptions())
 	r.Collection = make(map[string]*mongo.Collection)
-	r.Current = make(map[string]*commondatabase.APIKey)
+	r.pools = make(map[string]*Pool)
+
+	r.providers = make(map[string]*Provider, len(config.Keys.Providers))
+	for name, c := range config.Keys.Providers {
+		p := newProvider(name, c)
+		if err := p.validate(); err != nil {
+			return nil, fmt.Errorf("provider %s: %w", name, err)
+		}
+		r.providers[name] = p
+	}
+
+	keystore, err := NewKeystore(config.DataDirectory.Keystore, config.Keys.MasterKey)
+	if err != nil {
+		return nil, fmt.Errorf("keystore: %w", err)
+	}
+	r.keystore = keystore
+	if err := r.checkMasterKey(context.Background()); err != nil {
+		return nil, fmt.Errorf("keystore: %w", err)
+	}
 
 	commonlog.Logger.Debug("load repository",
 		zap.String("keyDB", r.config.Common.ServiceId),
@@ -68,26 +133,76 @@ func (h *KeyManager) Start() error {
 			}
 		}()
 		close(h.start)
+		if interval := h.config.Keys.Probe.IntervalDuration(); interval > 0 {
+			h.workers.Add(1)
+			go h.probeLoop(interval)
+		}
+		if h.config.Keys.Sync != "off" {
+			h.workers.Add(1)
+			go h.syncLoop()
+		}
 		return nil
 	}()
 }
 
+// Close stops the key prober and the pool sync waits for them to
+// return and releases the client.
+func (h *KeyManager) Close(ctx context.Context) error {
+	h.stopOnce.Do(func() { close(h.stop) })
+
+	done := make(chan struct{})
+	go func() {
+		h.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return h.release(ctx)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// InitKey fills the pool of cate and chainId with the keys active in keyDB
+// and, until Keys.PoolSize keys can be used, with newly activated ones. It returns the first
+// key of the rotation.
 func (k *KeyManager) InitKey(cate, chainId string) (*commondatabase.APIKey, error) {
-	key, err := k.GetActiveKey(cate, chainId)
+	pool := k.pool(cate, chainId)
+
+	active, err := k.activeKeys(cate, chainId)
 	if err != nil {
-		key, err = k.GetNewKey(cate, chainId)
-		if err != nil {
+		return nil, err
+	}
+	for _, key := range active {
+		pool.add(key)
+	}
+
+	if pool.available() < k.poolSize() {
+		keys, err := k.GetNewKeys(cate, chainId)
+		if err != nil && pool.available() == 0 {
 			return nil, err
 		}
+		for _, key := range keys {
+			if pool.available() >= k.poolSize() {
+				break
+			}
+			if pool.has(key.Key) {
+				continue
+			}
+			if err := k.SetKey(cate, chainId, key.Key); err != nil {
+				commonlog.Logger.Error("active key doesn't set:",
+					zap.String("cate", cate),
+					zap.String("chainId", chainId),
+					zap.String("key", key.Key),
+				)
+			}
+		}
 	}
-	err = k.SetKey(cate, chainId, key.Key)
-	if err != nil {
-		commonlog.Logger.Error("active key doesn't set:",
-			zap.String("cate", cate),
-			zap.String("chainId", chainId),
-			zap.String("key", key.Key),
-		)
-		return nil, err
+
+	key := pool.Next()
+	if key == nil {
+		return nil, fmt.Errorf("no key available for %s on chain %s", cate, chainId)
 	}
 	return key, nil
 }
@@ -102,12 +217,17 @@ func (k *KeyManager) ExpiredKey(cate, chainId, key string) error {
 		return errors.New("not found collection")
 	}
 
-	filter := bson.M{"chainId": chainId, "key": key}
+	insert, err := k.insertKey(key)
+	if err != nil {
+		return err
+	}
+	filter := k.keyFilter(chainId, key)
 	update := bson.M{
 		"$set": bson.M{
 			"expired": time.Now().Unix(),
 			"active":  false,
 		},
+		"$setOnInsert": insert,
 	}
 
 	options := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
@@ -119,9 +239,17 @@ func (k *KeyManager) ExpiredKey(cate, chainId, key string) error {
 		return err
 	}
 
+	k.pool(cate, chainId).remove(key)
+
 	return nil
 }
 
+// DropKey takes key out of the rotation of cate and chainId without changing
+// it in keyDB. It is used again once the pool is filled anew.
+func (k *KeyManager) DropKey(cate, chainId, key string) {
+	k.pool(cate, chainId).remove(key)
+}
+
 func (k *KeyManager) SetKey(cate, chainId, key string) error {
 	col := k.col(cate, chainId)
 	if col == nil {
@@ -132,20 +260,32 @@ func (k *KeyManager) SetKey(cate, chainId, key string) error {
 		return errors.New("not found collection")
 	}
 
-	current := &commondatabase.APIKey{}
-	filter := bson.M{"chainId": chainId, "key": key}
+	insert, err := k.insertKey(key)
+	if err != nil {
+		return err
+	}
+
+	current := &pooledKey{}
+	filter := k.keyFilter(chainId, key)
 	update := bson.M{
 		"$set": bson.M{
 			"start":  time.Now().Unix(),
 			"active": true,
 		},
+		"$setOnInsert": insert,
 	}
 
 	options := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
-	err := col.FindOneAndUpdate(context.Background(), filter, update, options).Decode(current)
+	err = col.FindOneAndUpdate(context.Background(), filter, update, options).Decode(current)
 	if err != nil {
 		commonlog.Logger.Error("SetKey",
-			zap.String("update failed", key),
+			zap.String("update failed", err.Error()),
+		)
+		return err
+	}
+	if err := k.open(current); err != nil {
+		commonlog.Logger.Error("SetKey",
+			zap.String("open failed", err.Error()),
 		)
 		return err
 	}
@@ -155,7 +295,7 @@ func (k *KeyManager) SetKey(cate, chainId, key string) error {
 		zap.String("key:", current.Key),
 	)
 
-	k.Current[cate] = current
+	k.pool(cate, chainId).add(current)
 
 	return nil
 }
@@ -175,7 +315,7 @@ func (k *KeyManager) GetActiveKey(cate, chainId string) (*commondatabase.APIKey,
 		"active":  true,
 	}
 
-	key := &commondatabase.APIKey{}
+	key := &pooledKey{}
 	options := options.FindOne().SetSort(bson.M{"expired": 1})
 	err := col.FindOne(context.Background(), filter, options).Decode(key)
 	if err != nil {
@@ -186,8 +326,11 @@ func (k *KeyManager) GetActiveKey(cate, chainId string) (*commondatabase.APIKey,
 		)
 		return nil, err
 	}
+	if err := k.open(key); err != nil {
+		return nil, err
+	}
 
-	return key, nil
+	return &key.APIKey, nil
 }
 
 func (k *KeyManager) GetNewKey(cate, chainId string) (*commondatabase.APIKey, error) {
@@ -215,9 +358,11 @@ func (k *KeyManager) GetNewKey(cate, chainId string) (*commondatabase.APIKey, er
 				"expired": nil,
 			},
 		},
+		"backoff": bson.M{"$not": bson.M{"$gt": time.Now().Unix()}},
+		"invalid": bson.M{"$ne": true},
 	}
 
-	key := &commondatabase.APIKey{}
+	key := &pooledKey{}
 	options := options.FindOne().SetSort(bson.M{"expired": 1})
 	err := col.FindOne(context.Background(), filter, options).Decode(key)
 	if err != nil {
@@ -228,8 +373,11 @@ func (k *KeyManager) GetNewKey(cate, chainId string) (*commondatabase.APIKey, er
 		)
 		return nil, err
 	}
+	if err := k.open(key); err != nil {
+		return nil, err
+	}
 
-	return key, nil
+	return &key.APIKey, nil
 }
 
 func (k *KeyManager) GetNewKeys(cate, chainId string) ([]*commondatabase.APIKey, error) {
@@ -259,6 +407,8 @@ func (k *KeyManager) GetNewKeys(cate, chainId string) ([]*commondatabase.APIKey,
 				"expired": nil,
 			},
 		},
+		"backoff": bson.M{"$not": bson.M{"$gt": time.Now().Unix()}},
+		"invalid": bson.M{"$ne": true},
 	}
 	options := options.Find().SetSort(bson.M{"expired": 1})
 	cursor, err := col.Find(ctx, filter, options)
@@ -268,12 +418,15 @@ func (k *KeyManager) GetNewKeys(cate, chainId string) ([]*commondatabase.APIKey,
 	defer cursor.Close(ctx)
 
 	for cursor.Next(ctx) {
-		key := &commondatabase.APIKey{}
-		if err := cursor.Decode(&key); err != nil {
+		key := &pooledKey{}
+		if err := cursor.Decode(key); err != nil {
+			return nil, err
+		}
+		if err := k.open(key); err != nil {
 			return nil, err
 		}
 
-		keys = append(keys, key)
+		keys = append(keys, &key.APIKey)
 	}
 
 	if err := cursor.Err(); err != nil {
@@ -283,36 +436,126 @@ func (k *KeyManager) GetNewKeys(cate, chainId string) ([]*commondatabase.APIKey,
 	return keys, nil
 }
 
+// GetCurrentKey returns the key to use for the next request of cate on
+// chainId, rotating through the keys of its pool. The pool is filled on first
+// use and whenever it ran empty.
 func (k *KeyManager) GetCurrentKey(cate, chainId string) *commondatabase.APIKey {
-	current, ok := k.Current[cate]
+	if current := k.pool(cate, chainId).Next(); current != nil {
+		return current
+	}
+
+	init, err := k.InitKey(cate, chainId)
+	if err != nil {
+		return nil
+	}
+	return init
+}
+
+// GetActiveKeys returns the keys of cate and chainId that are active in keyDB.
+func (k *KeyManager) GetActiveKeys(cate, chainId string) ([]*commondatabase.APIKey, error) {
+	active, err := k.activeKeys(cate, chainId)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]*commondatabase.APIKey, 0, len(active))
+	for _, key := range active {
+		keys = append(keys, &key.APIKey)
+	}
+	return keys, nil
+}
+
+func (k *KeyManager) activeKeys(cate, chainId string) ([]*pooledKey, error) {
+	col := k.col(cate, chainId)
+	if col == nil {
+		commonlog.Logger.Error("GetActiveKeys: not found collection",
+			zap.String("cate", cate),
+			zap.String("chainId", chainId),
+		)
+		return nil, errors.New("not found collection")
+	}
+
+	ctx := context.Background()
+	filter := bson.M{
+		"chainId": chainId,
+		"active":  true,
+	}
+	options := options.Find().SetSort(bson.M{"expired": 1})
+	cursor, err := col.Find(ctx, filter, options)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var keys []*pooledKey
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if err := k.open(key); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// pool returns the key pool of cate and chainId, creating it on first use.
+func (k *KeyManager) pool(cate, chainId string) *Pool {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	id := cate + "." + chainId
+	pool, ok := k.pools[id]
 	if !ok {
-		init, err := k.InitKey(cate, chainId)
-		if err != nil {
-			return nil
+		rotation := k.config.Keys.Rotation
+		if rotation == "" {
+			rotation = RotationWeighted
 		}
-		current = init
+		pool = newPool(rotation, k.config.Keys.Quotas[cate])
+		k.pools[id] = pool
 	}
+	return pool
+}
 
-	return current
+func (k *KeyManager) poolSize() int {
+	return max(k.config.Keys.PoolSize, 1)
+}
+
+// Provider returns the provider named cate, looking at [Keys.Providers]
+// before the registered ones.
+func (k *KeyManager) Provider(cate string) (*Provider, error) {
+	if p, ok := k.providers[cate]; ok {
+		return p, nil
+	}
+	if p, ok := registeredProvider(cate); ok {
+		return p, nil
+	}
+	return nil, fmt.Errorf("unknown provider %s", cate)
 }
 
 func (k *KeyManager) col(cate, chainId string) *mongo.Collection {
-	if cate == "cmc" {
-		cate = "cmc"
-	} else if cate == "alchemy" {
-		cate = "alchemy." + chainId
-	} else {
+	p, err := k.Provider(cate)
+	if err == nil && !p.Supports(chainId) {
+		err = fmt.Errorf("provider %s does not support chain %s", cate, chainId)
+	}
+	if err != nil {
 		commonlog.Logger.Error("KeyDB: not found collection",
 			zap.String("cate:", cate),
 			zap.String("chainId", chainId),
+			zap.String("error", err.Error()),
 		)
 		return nil
 	}
 
-	col, ok := k.Collection[cate]
+	name := p.collection(chainId)
+
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	col, ok := k.Collection[name]
 	if !ok {
-		k.Collection[cate] = k.db.Collection(cate)
-		col = k.Collection[cate]
+		col = k.db.Collection(name)
+		k.Collection[name] = col
 	}
 	return col
 }
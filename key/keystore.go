@@ -0,0 +1,564 @@
+package key
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coinmeca/go-common/commondatabase"
+	"github.com/coinmeca/go-common/commonlog"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// MasterKeyFile is the file of the keystore directory holding the current
+// master key. Other *.key files of the directory are previous master keys,
+// kept to open the keys sealed before a rotation.
+const MasterKeyFile = "master.key"
+
+// sealedKey is an API key under envelope encryption: the key is encrypted
+// with a random data key, and the data key with the master key MasterId.
+// Rotating the master key only encrypts the data keys anew.
+type sealedKey struct {
+	MasterId string `bson:"masterId"`
+	DataKey  []byte `bson:"dataKey"`
+	Key      []byte `bson:"key"`
+}
+
+// Keystore holds the master keys that seal the API keys stored in keyDB.
+type Keystore struct {
+	lock    sync.RWMutex
+	dir     string
+	current string
+	masters map[string][]byte
+	// pinned is set when the current master key is given rather than read
+	// from MasterKeyFile, which then holds stored.
+	pinned bool
+	stored string
+}
+
+// NewKeystore loads the master keys of dir. masterKey, if set, is used as the
+// current master key instead of the one in MasterKeyFile. It returns nil when
+// there is no current master key, in which case keys are stored in plaintext.
+func NewKeystore(dir, masterKey string) (*Keystore, error) {
+	s := &Keystore{dir: dir, masters: make(map[string][]byte)}
+
+	if masterKey != "" {
+		master, err := ParseMasterKey(masterKey)
+		if err != nil {
+			return nil, fmt.Errorf("master key: %w", err)
+		}
+		s.current = masterId(master)
+		s.masters[s.current] = master
+		s.pinned = true
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	if s.current == "" {
+		return nil, nil
+	}
+	return s, nil
+}
+
+// load reads the master keys of the keystore directory, making the one of
+// MasterKeyFile current unless the current master key is pinned. The caller
+// must hold the write lock once the keystore is shared.
+func (s *Keystore) load() error {
+	if s.dir == "" {
+		return nil
+	}
+	files, err := filepath.Glob(filepath.Join(s.dir, "*.key"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		master, err := ParseMasterKey(string(content))
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		id := masterId(master)
+		s.masters[id] = master
+		if filepath.Base(file) == MasterKeyFile {
+			s.stored = id
+			if !s.pinned {
+				s.current = id
+			}
+		}
+	}
+	return nil
+}
+
+// reload reads the keystore directory again, to pick up a master key rotated
+// by another instance.
+func (s *Keystore) reload() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	stored := s.stored
+	if err := s.load(); err != nil {
+		return err
+	}
+	if s.pinned && s.stored != stored && s.stored != s.current {
+		commonlog.Logger.Error("Keystore",
+			zap.String("rotated", s.stored),
+			zap.String("error", "the configured master key is no longer the current one, update it"),
+		)
+	}
+	return nil
+}
+
+// GenerateMasterKey returns a new random master key.
+func GenerateMasterKey() ([]byte, error) {
+	master := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, master); err != nil {
+		return nil, err
+	}
+	return master, nil
+}
+
+// ParseMasterKey reads a 32 byte master key written in hex, with or without
+// 0x, or in base64.
+func ParseMasterKey(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+
+	master, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		master, err = base64.StdEncoding.DecodeString(s)
+	}
+	if err != nil {
+		return nil, errors.New("master key is neither hex nor base64")
+	}
+	if len(master) != 32 {
+		return nil, fmt.Errorf("master key has %d bytes instead of 32", len(master))
+	}
+	return master, nil
+}
+
+// masterId identifies a master key without revealing it.
+func masterId(master []byte) string {
+	sum := sha256.Sum256(master)
+	return hex.EncodeToString(sum[:8])
+}
+
+// keyHash finds a sealed key in keyDB without opening every document.
+func keyHash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *Keystore) seal(key string) (*sealedKey, error) {
+	s.lock.RLock()
+	id, master := s.current, s.masters[s.current]
+	s.lock.RUnlock()
+
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, err
+	}
+
+	sealedData, err := encrypt(dataKey, []byte(key))
+	if err != nil {
+		return nil, err
+	}
+	sealedDataKey, err := encrypt(master, dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sealedKey{MasterId: id, DataKey: sealedDataKey, Key: sealedData}, nil
+}
+
+func (s *Keystore) open(sealed *sealedKey) (string, error) {
+	dataKey, err := s.dataKey(sealed)
+	if err != nil {
+		return "", err
+	}
+	key, err := decrypt(dataKey, sealed.Key)
+	if err != nil {
+		return "", err
+	}
+	return string(key), nil
+}
+
+// rewrap seals the data key of sealed with the current master key.
+func (s *Keystore) rewrap(sealed *sealedKey) (*sealedKey, error) {
+	dataKey, err := s.dataKey(sealed)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.RLock()
+	id, master := s.current, s.masters[s.current]
+	s.lock.RUnlock()
+
+	sealedDataKey, err := encrypt(master, dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &sealedKey{MasterId: id, DataKey: sealedDataKey, Key: sealed.Key}, nil
+}
+
+// dataKey opens the data key of sealed. A master key not loaded yet may have
+// been added by a rotation in another instance, so the keystore directory is
+// read again before giving up.
+func (s *Keystore) dataKey(sealed *sealedKey) ([]byte, error) {
+	master, ok := s.master(sealed.MasterId)
+	if !ok {
+		if err := s.reload(); err != nil {
+			return nil, fmt.Errorf("master key %s: %w", sealed.MasterId, err)
+		}
+		master, ok = s.master(sealed.MasterId)
+	}
+	if !ok {
+		return nil, fmt.Errorf("master key %s is not in the keystore", sealed.MasterId)
+	}
+	return decrypt(master, sealed.DataKey)
+}
+
+func (s *Keystore) master(id string) ([]byte, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	master, ok := s.masters[id]
+	return master, ok
+}
+
+// Current returns the id of the current master key.
+func (s *Keystore) Current() string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.current
+}
+
+// rotate makes master the current master key. The previous master key is kept
+// as master-<id>.key of the keystore directory, so keys not sealed anew yet
+// can still be opened, and master is written to MasterKeyFile.
+func (s *Keystore) rotate(master []byte) error {
+	if s.dir == "" {
+		return errors.New("rotating the master key needs a keystore directory")
+	}
+	id := masterId(master)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if id == s.current {
+		return errors.New("master key is already the current one")
+	}
+
+	// The current master key may come from the environment rather than
+	// MasterKeyFile, so both are kept under their own id. A MasterKeyFile
+	// that does not parse is left alone: it may be the only copy of a key.
+	current := filepath.Join(s.dir, MasterKeyFile)
+	var previous []byte
+	if content, err := os.ReadFile(current); err == nil {
+		if previous, err = ParseMasterKey(string(content)); err != nil {
+			return fmt.Errorf("%s: %w", current, err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	next := filepath.Join(s.dir, MasterKeyFile+".new")
+	if err := writeMasterKey(next, master); err != nil {
+		return err
+	}
+	if previous != nil {
+		if err := os.Rename(current, s.file(masterId(previous))); err != nil {
+			return err
+		}
+	}
+	if _, err := os.Stat(s.file(s.current)); err != nil {
+		if err := writeMasterKey(s.file(s.current), s.masters[s.current]); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(next, current); err != nil {
+		return err
+	}
+
+	s.masters[id] = master
+	s.current = id
+	s.stored = id
+	return nil
+}
+
+// check returns an error if the keys sealed with masterIds cannot be used
+// safely: one of the master keys is missing, or the current master key is
+// pinned while MasterKeyFile holds a master key the keys were sealed with
+// since, i.e. the pinned key predates a rotation and sealing with it would
+// undo the rotation.
+func (s *Keystore) check(masterIds []string) error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	for _, id := range masterIds {
+		if _, ok := s.masters[id]; !ok {
+			return fmt.Errorf("keys are sealed with master key %s, which is not in the keystore", id)
+		}
+		if s.pinned && id != s.current && id == s.stored {
+			return fmt.Errorf("keys are sealed with master key %s of %s, not with the configured master key %s; set it to the current master key or unset it",
+				id, filepath.Join(s.dir, MasterKeyFile), s.current)
+		}
+	}
+	return nil
+}
+
+// file returns the file keeping the previous master key id.
+func (s *Keystore) file(id string) string {
+	return filepath.Join(s.dir, "master-"+id+".key")
+}
+
+func writeMasterKey(file string, master []byte) error {
+	return os.WriteFile(file, []byte(hex.EncodeToString(master)+"\n"), 0600)
+}
+
+func encrypt(key, plain []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plain, nil), nil
+}
+
+func decrypt(key, sealed []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("sealed value too short")
+	}
+	nonce, data := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, data, nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// open fills the key of a document sealed by the keystore.
+func (k *KeyManager) open(key *pooledKey) error {
+	if key.Sealed == nil {
+		return nil
+	}
+	if k.keystore == nil {
+		return fmt.Errorf("key %s is sealed but no master key is configured", key.Hash)
+	}
+	plain, err := k.keystore.open(key.Sealed)
+	if err != nil {
+		return fmt.Errorf("key %s: %w", key.Hash, err)
+	}
+	key.Key = plain
+	return nil
+}
+
+// insertKey returns the fields storing key in a new document: sealed when a
+// master key is configured, in plaintext otherwise.
+func (k *KeyManager) insertKey(key string) (bson.M, error) {
+	if k.keystore == nil {
+		return bson.M{"key": key}, nil
+	}
+	sealed, err := k.keystore.seal(key)
+	if err != nil {
+		return nil, err
+	}
+	return bson.M{"keyHash": keyHash(key), "sealed": sealed}, nil
+}
+
+// keyFilter matches the document of key whether it is sealed or not.
+func (k *KeyManager) keyFilter(chainId, key string) bson.M {
+	return bson.M{
+		"chainId": chainId,
+		"$or": []bson.M{
+			{"key": key},
+			{"keyHash": keyHash(key)},
+		},
+	}
+}
+
+// AddKey stores a new inactive key of cate and chainId, sealed when a master
+// key is configured. A key already stored is left as it is.
+func (k *KeyManager) AddKey(cate, chainId string, key *commondatabase.APIKey) error {
+	col := k.col(cate, chainId)
+	if col == nil {
+		return errors.New("not found collection")
+	}
+
+	insert, err := k.insertKey(key.Key)
+	if err != nil {
+		return err
+	}
+	insert["url"] = key.Url
+	insert["active"] = false
+	insert["retry"] = key.Retry
+	insert["createdAt"] = time.Now()
+
+	update := bson.M{"$setOnInsert": insert}
+	if _, err := col.UpdateOne(context.Background(), k.keyFilter(chainId, key.Key), update, options.Update().SetUpsert(true)); err != nil {
+		commonlog.Logger.Error("AddKey",
+			zap.String("cate", cate),
+			zap.String("chainId", chainId),
+			zap.String("insert failed", err.Error()),
+		)
+		return err
+	}
+	return nil
+}
+
+// EncryptKeys seals every key still stored in plaintext in keyDB and returns
+// the number of keys sealed.
+func (k *KeyManager) EncryptKeys(ctx context.Context) (int, error) {
+	if k.keystore == nil {
+		return 0, errors.New("no master key is configured")
+	}
+
+	filter := bson.M{"key": bson.M{"$nin": bson.A{nil, ""}}}
+	return k.updateKeys(ctx, filter, func(doc *pooledKey) (bson.M, error) {
+		sealed, err := k.keystore.seal(doc.Key)
+		if err != nil {
+			return nil, err
+		}
+		return bson.M{
+			"$set":   bson.M{"keyHash": keyHash(doc.Key), "sealed": sealed},
+			"$unset": bson.M{"key": ""},
+		}, nil
+	})
+}
+
+// RotateMasterKey makes master the current master key and seals the data key
+// of every stored key with it, returning the number of keys sealed anew. The
+// previous master key stays in the keystore directory until every key is
+// sealed anew; with a nil master only the keys still sealed with a previous
+// master key are, e.g. to finish an interrupted rotation.
+func (k *KeyManager) RotateMasterKey(ctx context.Context, master []byte) (int, error) {
+	if k.keystore == nil {
+		return 0, errors.New("no master key is configured")
+	}
+	if master != nil {
+		if err := k.keystore.rotate(master); err != nil {
+			return 0, err
+		}
+	}
+
+	filter := bson.M{"sealed.masterId": bson.M{"$exists": true, "$ne": k.keystore.Current()}}
+	return k.updateKeys(ctx, filter, func(doc *pooledKey) (bson.M, error) {
+		sealed, err := k.keystore.rewrap(doc.Sealed)
+		if err != nil {
+			return nil, err
+		}
+		return bson.M{"$set": bson.M{"sealed": sealed}}, nil
+	})
+}
+
+// checkMasterKey fails when the stored keys cannot be used with the keystore,
+// see Keystore.check.
+func (k *KeyManager) checkMasterKey(ctx context.Context) error {
+	if k.keystore == nil {
+		return nil
+	}
+	names, err := k.keyCollections(ctx)
+	if err != nil {
+		return err
+	}
+
+	var ids []string
+	for _, name := range names {
+		values, err := k.db.Collection(name).Distinct(ctx, "sealed.masterId", bson.M{"sealed.masterId": bson.M{"$exists": true}})
+		if err != nil {
+			return err
+		}
+		for _, value := range values {
+			if id, ok := value.(string); ok && !slices.Contains(ids, id) {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return k.keystore.check(ids)
+}
+
+// updateKeys applies the update built for each document matching filter in
+// every key collection of keyDB.
+func (k *KeyManager) updateKeys(ctx context.Context, filter bson.M, update func(doc *pooledKey) (bson.M, error)) (int, error) {
+	names, err := k.keyCollections(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, name := range names {
+		col := k.db.Collection(name)
+		cursor, err := col.Find(ctx, filter)
+		if err != nil {
+			return n, err
+		}
+
+		var docs []*pooledKey
+		err = cursor.All(ctx, &docs)
+		cursor.Close(ctx)
+		if err != nil {
+			return n, err
+		}
+
+		for _, doc := range docs {
+			u, err := update(doc)
+			if err != nil {
+				return n, fmt.Errorf("%s %s: %w", name, doc.ID.Hex(), err)
+			}
+			if _, err := col.UpdateByID(ctx, doc.ID, u); err != nil {
+				return n, fmt.Errorf("%s %s: %w", name, doc.ID.Hex(), err)
+			}
+			n++
+		}
+	}
+	return n, nil
+}
+
+// keyCollections returns the collections of keyDB that belong to a known
+// provider.
+func (k *KeyManager) keyCollections(ctx context.Context) ([]string, error) {
+	names, err := k.db.ListCollectionNames(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	known := Providers()
+	for name := range k.providers {
+		known = append(known, name)
+	}
+
+	var cols []string
+	for _, name := range names {
+		if slices.ContainsFunc(known, func(p string) bool { return name == p || strings.HasPrefix(name, p+".") }) {
+			cols = append(cols, name)
+		}
+	}
+	return cols, nil
+}
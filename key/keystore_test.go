@@ -0,0 +1,198 @@
+package key
+
+import (
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testMasterKey(t *testing.T) []byte {
+	t.Helper()
+	master, err := GenerateMasterKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return master
+}
+
+func testKeystore(t *testing.T, dir string, master []byte) *Keystore {
+	t.Helper()
+	s, err := NewKeystore(dir, hex.EncodeToString(master))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestKeystoreRoundTrip(t *testing.T) {
+	const apiKey = "0123456789abcdef"
+
+	tests := []struct {
+		name string
+		// setup seals apiKey and returns the keystore to open it with.
+		setup func(t *testing.T) (*Keystore, *sealedKey)
+		err   string
+	}{
+		{
+			name: "current master key",
+			setup: func(t *testing.T) (*Keystore, *sealedKey) {
+				s := testKeystore(t, "", testMasterKey(t))
+				sealed, err := s.seal(apiKey)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return s, sealed
+			},
+		},
+		{
+			name: "previous master key after a rotation",
+			setup: func(t *testing.T) (*Keystore, *sealedKey) {
+				s := testKeystore(t, t.TempDir(), testMasterKey(t))
+				sealed, err := s.seal(apiKey)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := s.rotate(testMasterKey(t)); err != nil {
+					t.Fatal(err)
+				}
+				return s, sealed
+			},
+		},
+		{
+			name: "rewrapped with the rotated master key alone",
+			setup: func(t *testing.T) (*Keystore, *sealedKey) {
+				s := testKeystore(t, t.TempDir(), testMasterKey(t))
+				sealed, err := s.seal(apiKey)
+				if err != nil {
+					t.Fatal(err)
+				}
+				next := testMasterKey(t)
+				if err := s.rotate(next); err != nil {
+					t.Fatal(err)
+				}
+				rewrapped, err := s.rewrap(sealed)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if rewrapped.MasterId != masterId(next) {
+					t.Errorf("rewrapped with master key %s, want %s", rewrapped.MasterId, masterId(next))
+				}
+				return testKeystore(t, "", next), rewrapped
+			},
+		},
+		{
+			name: "master key rotated by another instance",
+			setup: func(t *testing.T) (*Keystore, *sealedKey) {
+				dir := t.TempDir()
+				if err := writeMasterKey(filepath.Join(dir, MasterKeyFile), testMasterKey(t)); err != nil {
+					t.Fatal(err)
+				}
+				s, err := NewKeystore(dir, "")
+				if err != nil {
+					t.Fatal(err)
+				}
+				other, err := NewKeystore(dir, "")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := other.rotate(testMasterKey(t)); err != nil {
+					t.Fatal(err)
+				}
+				sealed, err := other.seal(apiKey)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return s, sealed
+			},
+		},
+		{
+			name: "wrong master key",
+			setup: func(t *testing.T) (*Keystore, *sealedKey) {
+				sealed, err := testKeystore(t, "", testMasterKey(t)).seal(apiKey)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return testKeystore(t, "", testMasterKey(t)), sealed
+			},
+			err: "is not in the keystore",
+		},
+		{
+			name: "wrong master key under the id of the sealing one",
+			setup: func(t *testing.T) (*Keystore, *sealedKey) {
+				sealed, err := testKeystore(t, "", testMasterKey(t)).seal(apiKey)
+				if err != nil {
+					t.Fatal(err)
+				}
+				s := testKeystore(t, "", testMasterKey(t))
+				s.masters[sealed.MasterId] = testMasterKey(t)
+				return s, sealed
+			},
+			err: "message authentication failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, sealed := tt.setup(t)
+			key, err := s.open(sealed)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if key != apiKey {
+				t.Errorf("opened %q, want %q", key, apiKey)
+			}
+		})
+	}
+}
+
+func TestKeystoreSealHidesKey(t *testing.T) {
+	s := testKeystore(t, "", testMasterKey(t))
+
+	a, err := s.seal("same key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := s.seal("same key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(a.Key), "same key") {
+		t.Error("sealed key holds the plaintext")
+	}
+	if string(a.Key) == string(b.Key) || string(a.DataKey) == string(b.DataKey) {
+		t.Error("sealing a key twice gives the same ciphertext")
+	}
+}
+
+func TestKeystoreRotateKeepsUnreadableMasterKey(t *testing.T) {
+	dir := t.TempDir()
+	s := testKeystore(t, dir, testMasterKey(t))
+
+	file := filepath.Join(dir, MasterKeyFile)
+	if err := os.WriteFile(file, []byte("not a master key\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.rotate(testMasterKey(t)); err == nil {
+		t.Fatal("rotated over a master key file that does not parse")
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "not a master key\n" {
+		t.Errorf("%s overwritten with %q", MasterKeyFile, content)
+	}
+	if _, err := os.Stat(file + ".new"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("next master key left behind: %v", err)
+	}
+}
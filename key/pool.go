@@ -0,0 +1,258 @@
+package key
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/coinmeca/db-connector/conf"
+	"github.com/coinmeca/go-common/commondatabase"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Rotation strategies of a key pool, set by conf.Config.Keys.Rotation.
+const (
+	RotationWeighted   = "weighted"
+	RotationRoundRobin = "roundRobin"
+)
+
+// pooledKey is a key document together with its share of the pool.
+type pooledKey struct {
+	commondatabase.APIKey `bson:",inline"`
+
+	// Weight is the share of requests the key gets relative to the other keys
+	// of its pool. Keys without a weight count as 1.
+	Weight int `bson:"weight,omitempty"`
+	// Backoff is the unix time until which the key rests after a rate limit.
+	Backoff int64 `bson:"backoff,omitempty"`
+	// Hash and Sealed replace the plaintext key once it is sealed by the
+	// keystore. Key is filled from Sealed when the document is read.
+	Hash   string     `bson:"keyHash,omitempty"`
+	Sealed *sealedKey `bson:"sealed,omitempty"`
+
+	ChainId string `bson:"chainId,omitempty"`
+	// Invalid is set once the provider rejected the key for good.
+	Invalid bool         `bson:"invalid,omitempty"`
+	Probe   *probeResult `bson:"probe,omitempty"`
+
+	current int
+	usage   Usage
+}
+
+// Pool holds the active keys of one category and chain and hands them out by
+// smooth weighted round-robin: a key of weight 3 is picked three times as often
+// as a key of weight 1, interleaved rather than in bursts. With equal weights
+// it is a plain round-robin.
+//
+// Keys resting after a rate limit are skipped. Keys that used up the
+// threshold share of their quota are only picked while no other key is below
+// it, and keys at their limit not at all.
+type Pool struct {
+	lock     sync.Mutex
+	rotation string
+	quota    conf.QuotaConfig
+	keys     []*pooledKey
+}
+
+func newPool(rotation string, quota conf.QuotaConfig) *Pool {
+	return &Pool{rotation: rotation, quota: quota}
+}
+
+// Next returns the key to use for the next request, or nil if no key of the
+// pool can be used.
+func (p *Pool) Next() *commondatabase.APIKey {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	now := time.Now()
+	best := p.pick(now, p.quota.Share())
+	if best == nil {
+		best = p.pick(now, 1)
+	}
+	if best == nil {
+		return nil
+	}
+
+	key := best.APIKey
+	return &key
+}
+
+// pick runs one round of the rotation over the keys below share of their
+// quota.
+func (p *Pool) pick(now time.Time, share float64) *pooledKey {
+	total := 0
+	var best *pooledKey
+	for _, k := range p.keys {
+		if k.usage.backingOff(now) || k.usage.over(now, p.quota, share) {
+			continue
+		}
+		w := p.weight(k)
+		k.current += w
+		total += w
+		if best == nil || k.current > best.current {
+			best = k
+		}
+	}
+	if best != nil {
+		best.current -= total
+	}
+	return best
+}
+
+// available returns the number of keys that can be used now.
+func (p *Pool) available() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	now := time.Now()
+	n := 0
+	for _, k := range p.keys {
+		if !k.usage.backingOff(now) && !k.usage.over(now, p.quota, 1) {
+			n++
+		}
+	}
+	return n
+}
+
+// Usage returns the usage of every key in rotation, by key.
+func (p *Pool) Usage() map[string]Usage {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	now := time.Now()
+	usage := make(map[string]Usage, len(p.keys))
+	for _, k := range p.keys {
+		k.usage.roll(now)
+		usage[k.Key] = k.usage
+	}
+	return usage
+}
+
+// Keys returns the keys in rotation.
+func (p *Pool) Keys() []*commondatabase.APIKey {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	keys := make([]*commondatabase.APIKey, 0, len(p.keys))
+	for _, k := range p.keys {
+		key := k.APIKey
+		keys = append(keys, &key)
+	}
+	return keys
+}
+
+// Len returns the number of keys in rotation.
+func (p *Pool) Len() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return len(p.keys)
+}
+
+func (p *Pool) weight(k *pooledKey) int {
+	if p.rotation == RotationRoundRobin || k.Weight <= 0 {
+		return 1
+	}
+	return k.Weight
+}
+
+// add puts k in rotation, or refreshes it if it is already there.
+func (p *Pool) add(k *pooledKey) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	i := slices.IndexFunc(p.keys, func(existing *pooledKey) bool { return existing.Key == k.Key })
+	if i >= 0 {
+		k.current, k.usage = p.keys[i].current, p.keys[i].usage
+	}
+	if until := time.Unix(k.Backoff, 0); k.Backoff > 0 && until.After(k.usage.BackoffUntil) {
+		k.usage.BackoffUntil = until
+	}
+
+	if i >= 0 {
+		p.keys[i] = k
+	} else {
+		p.keys = append(p.keys, k)
+	}
+}
+
+// record counts a call costing units against key.
+func (p *Pool) record(key string, units int64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for _, k := range p.keys {
+		if k.Key == key {
+			k.usage.add(time.Now(), units)
+			return
+		}
+	}
+}
+
+// backoff rests key until the given time.
+func (p *Pool) backoff(key string, until time.Time) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for _, k := range p.keys {
+		if k.Key == key {
+			k.usage.BackoffUntil = until
+			k.Backoff = until.Unix()
+			return
+		}
+	}
+}
+
+// remove takes key out of rotation and reports whether it was there.
+func (p *Pool) remove(key string) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for i, k := range p.keys {
+		if k.Key == key {
+			p.keys = append(p.keys[:i], p.keys[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// removeID takes the key of the document id out of rotation and reports
+// whether it was there.
+func (p *Pool) removeID(id primitive.ObjectID) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for i, k := range p.keys {
+		if k.ID == id {
+			p.keys = append(p.keys[:i], p.keys[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// sync puts keys in rotation and takes every other key out of it.
+func (p *Pool) sync(keys []*pooledKey) {
+	for _, k := range keys {
+		p.add(k)
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.keys = slices.DeleteFunc(p.keys, func(existing *pooledKey) bool {
+		return !slices.ContainsFunc(keys, func(k *pooledKey) bool { return k.Key == existing.Key })
+	})
+}
+
+func (p *Pool) has(key string) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for _, k := range p.keys {
+		if k.Key == key {
+			return true
+		}
+	}
+	return false
+}
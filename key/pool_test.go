@@ -0,0 +1,214 @@
+package key
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/coinmeca/db-connector/conf"
+	"github.com/coinmeca/go-common/commondatabase"
+)
+
+func testPool(rotation string, weights map[string]int, order ...string) *Pool {
+	p := newPool(rotation, conf.QuotaConfig{})
+	for _, key := range order {
+		p.add(&pooledKey{APIKey: commondatabase.APIKey{Key: key}, Weight: weights[key]})
+	}
+	return p
+}
+
+func picks(p *Pool, n int) []string {
+	keys := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		if key := p.Next(); key != nil {
+			keys = append(keys, key.Key)
+		} else {
+			keys = append(keys, "")
+		}
+	}
+	return keys
+}
+
+func TestPoolNext(t *testing.T) {
+	tests := []struct {
+		name     string
+		rotation string
+		weights  map[string]int
+		order    []string
+		want     []string
+	}{
+		{
+			name:     "weighted interleaves",
+			rotation: RotationWeighted,
+			weights:  map[string]int{"a": 5, "b": 1, "c": 1},
+			order:    []string{"a", "b", "c"},
+			want:     []string{"a", "a", "b", "a", "c", "a", "a"},
+		},
+		{
+			name:     "weighted two to one",
+			rotation: RotationWeighted,
+			weights:  map[string]int{"a": 2, "b": 1},
+			order:    []string{"a", "b"},
+			want:     []string{"a", "b", "a", "a", "b", "a"},
+		},
+		{
+			name:     "missing weights count as one",
+			rotation: RotationWeighted,
+			weights:  map[string]int{"b": -1},
+			order:    []string{"a", "b", "c"},
+			want:     []string{"a", "b", "c", "a", "b", "c"},
+		},
+		{
+			name:     "round-robin ignores weights",
+			rotation: RotationRoundRobin,
+			weights:  map[string]int{"a": 5, "b": 1},
+			order:    []string{"a", "b"},
+			want:     []string{"a", "b", "a", "b"},
+		},
+		{
+			name:  "empty pool",
+			order: nil,
+			want:  []string{""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := testPool(tt.rotation, tt.weights, tt.order...)
+			if got := picks(p, len(tt.want)); !slices.Equal(got, tt.want) {
+				t.Errorf("picks = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPoolDistribution(t *testing.T) {
+	weights := map[string]int{"a": 3, "b": 2, "c": 1}
+	p := testPool(RotationWeighted, weights, "a", "b", "c")
+
+	count := make(map[string]int)
+	for _, key := range picks(p, 600) {
+		count[key]++
+	}
+	for key, weight := range weights {
+		if want := 100 * weight; count[key] != want {
+			t.Errorf("%s picked %d times, want %d", key, count[key], want)
+		}
+	}
+}
+
+func TestPoolRemove(t *testing.T) {
+	tests := []struct {
+		name    string
+		remove  []string
+		removed []bool
+		left    int
+		want    []string
+	}{
+		{
+			name:    "one key",
+			remove:  []string{"b"},
+			removed: []bool{true},
+			left:    2,
+			want:    []string{"a", "a", "c", "a", "a", "a"},
+		},
+		{
+			name:    "unknown key",
+			remove:  []string{"d"},
+			removed: []bool{false},
+			left:    3,
+			want:    []string{"a", "a", "b", "a", "c", "a"},
+		},
+		{
+			name:    "twice",
+			remove:  []string{"a", "a"},
+			removed: []bool{true, false},
+			left:    2,
+			want:    []string{"b", "c", "b", "c"},
+		},
+		{
+			name:    "every key",
+			remove:  []string{"a", "b", "c"},
+			removed: []bool{true, true, true},
+			left:    0,
+			want:    []string{""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := testPool(RotationWeighted, map[string]int{"a": 4, "b": 1, "c": 1}, "a", "b", "c")
+			for i, key := range tt.remove {
+				if removed := p.remove(key); removed != tt.removed[i] {
+					t.Errorf("remove(%s) = %v, want %v", key, removed, tt.removed[i])
+				}
+			}
+			if got := picks(p, len(tt.want)); !slices.Equal(got, tt.want) {
+				t.Errorf("picks = %v, want %v", got, tt.want)
+			}
+			if p.Len() != tt.left {
+				t.Errorf("Len = %d, want %d", p.Len(), tt.left)
+			}
+		})
+	}
+}
+
+func TestPoolBackoff(t *testing.T) {
+	p := testPool(RotationWeighted, map[string]int{"a": 2, "b": 1}, "a", "b")
+
+	p.backoff("a", time.Now().Add(time.Minute))
+	if got := picks(p, 3); !slices.Equal(got, []string{"b", "b", "b"}) {
+		t.Errorf("picks while a backs off = %v", got)
+	}
+
+	p.backoff("a", time.Now().Add(-time.Second))
+	if got := picks(p, 3); !slices.Contains(got, "a") {
+		t.Errorf("picks after the backoff of a = %v", got)
+	}
+}
+
+func TestPoolQuota(t *testing.T) {
+	quota := conf.QuotaConfig{CallsPerMinute: 4, Threshold: 0.5}
+
+	tests := []struct {
+		name  string
+		calls map[string]int64
+		want  []string
+	}{
+		{
+			name: "below the threshold",
+			want: []string{"a", "b", "a", "b"},
+		},
+		{
+			name:  "over the threshold",
+			calls: map[string]int64{"a": 2},
+			want:  []string{"b", "b"},
+		},
+		{
+			name:  "every key over the threshold",
+			calls: map[string]int64{"a": 2, "b": 3},
+			want:  []string{"a", "b", "a"},
+		},
+		{
+			name:  "at the limit",
+			calls: map[string]int64{"a": 4, "b": 4},
+			want:  []string{""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPool(RotationWeighted, quota)
+			for _, key := range []string{"a", "b"} {
+				p.add(&pooledKey{APIKey: commondatabase.APIKey{Key: key}})
+				for i := int64(0); i < tt.calls[key]; i++ {
+					p.record(key, 1)
+				}
+			}
+			// picks are not recorded, so the usage stays as set up
+			if got := picks(p, len(tt.want)); !slices.Equal(got, tt.want) {
+				t.Errorf("picks = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,351 @@
+package key
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/coinmeca/go-common/commondatabase"
+	"github.com/coinmeca/go-common/commonlog"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+)
+
+// ErrNotProbed is returned by the probe of a provider whose keys are not
+// probed.
+var ErrNotProbed = errors.New("provider keys are not probed")
+
+// ProbeFunc checks with a cheap request that key works for chainId.
+type ProbeFunc func(ctx context.Context, p *Provider, chainId string, key *commondatabase.APIKey) error
+
+// ProbeRPC calls eth_chainId and checks that the endpoint serves chainId. It
+// is the probe of providers without one.
+func ProbeRPC(ctx context.Context, p *Provider, chainId string, key *commondatabase.APIKey) error {
+	endpoint, err := p.Endpoint(chainId, key)
+	if err != nil {
+		return err
+	}
+	header, err := p.Header(key)
+	if err != nil {
+		return err
+	}
+
+	client, err := rpc.DialOptions(ctx, endpoint, rpc.WithHeaders(header))
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	var id hexutil.Big
+	if err := client.CallContext(ctx, &id, "eth_chainId"); err != nil {
+		return err
+	}
+	if want, ok := new(big.Int).SetString(chainId, 10); ok && want.Cmp(id.ToInt()) != 0 {
+		return fmt.Errorf("endpoint serves chain %s instead of %s", id.ToInt(), chainId)
+	}
+	return nil
+}
+
+// ProbeHTTP returns a probe fetching path below the endpoint of the provider,
+// e.g. /v1/key/info of CoinMarketCap. Responses other than 2xx are returned as
+// rpc.HTTPError, so they are classified like the errors of RPC calls.
+func ProbeHTTP(path string) ProbeFunc {
+	return func(ctx context.Context, p *Provider, chainId string, key *commondatabase.APIKey) error {
+		endpoint, err := p.Endpoint(chainId, key)
+		if err != nil {
+			return err
+		}
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return err
+		}
+		u.Path = strings.TrimRight(u.Path, "/") + path
+
+		header, err := p.Header(key)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return err
+		}
+		req.Header = header
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+			return rpc.HTTPError{StatusCode: resp.StatusCode, Status: resp.Status, Body: body}
+		}
+		return nil
+	}
+}
+
+// ProbeNone skips the keys of the provider.
+func ProbeNone(context.Context, *Provider, string, *commondatabase.APIKey) error {
+	return ErrNotProbed
+}
+
+// probeResult is the record of the probes of a key, stored with it.
+type probeResult struct {
+	At        time.Time `bson:"at"`
+	Latency   int64     `bson:"latency"`
+	Probes    int64     `bson:"probes"`
+	Successes int64     `bson:"successes"`
+	// Rate is the success rate weighted toward the latest probes.
+	Rate  float64 `bson:"rate"`
+	Error string  `bson:"error,omitempty"`
+}
+
+// KeyStatus is the state of a key in keyDB and the result of its probes. The
+// key itself is identified by its hash only.
+type KeyStatus struct {
+	Cate    string `json:"cate"`
+	ChainId string `json:"chainId"`
+	Hash    string `json:"hash"`
+
+	Active  bool  `json:"active"`
+	Invalid bool  `json:"invalid"`
+	Expired int64 `json:"expired,omitempty"`
+	Backoff int64 `json:"backoff,omitempty"`
+
+	Probes      int64         `json:"probes"`
+	Successes   int64         `json:"successes"`
+	SuccessRate float64       `json:"successRate"`
+	Latency     time.Duration `json:"latency"`
+	ProbedAt    time.Time     `json:"probedAt,omitempty"`
+	Error       string        `json:"error,omitempty"`
+}
+
+// GetKeyStatus returns the state of every key of cate and chainId in keyDB.
+func (k *KeyManager) GetKeyStatus(cate, chainId string) ([]*KeyStatus, error) {
+	col := k.col(cate, chainId)
+	if col == nil {
+		return nil, errors.New("not found collection")
+	}
+
+	ctx := context.Background()
+	cursor, err := col.Find(ctx, bson.M{"chainId": chainId})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var docs []*pooledKey
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+
+	status := make([]*KeyStatus, 0, len(docs))
+	for _, doc := range docs {
+		s := &KeyStatus{
+			Cate:    cate,
+			ChainId: chainId,
+			Hash:    doc.Hash,
+			Active:  doc.Active,
+			Invalid: doc.Invalid,
+			Expired: int64(doc.Expired),
+			Backoff: doc.Backoff,
+		}
+		if s.Hash == "" {
+			s.Hash = keyHash(doc.Key)
+		}
+		if p := doc.Probe; p != nil {
+			s.Probes, s.Successes, s.SuccessRate = p.Probes, p.Successes, p.Rate
+			s.Latency = time.Duration(p.Latency) * time.Millisecond
+			s.ProbedAt, s.Error = p.At, p.Error
+		}
+		status = append(status, s)
+	}
+	return status, nil
+}
+
+// InvalidKey takes key out of rotation for good, as after the provider
+// rejected it. Unlike ExpiredKey the key is not retried later.
+func (k *KeyManager) InvalidKey(cate, chainId, key string) error {
+	col := k.col(cate, chainId)
+	if col == nil {
+		return errors.New("not found collection")
+	}
+
+	update := bson.M{"$set": bson.M{"invalid": true, "active": false}}
+	if _, err := col.UpdateOne(context.Background(), k.keyFilter(chainId, key), update); err != nil {
+		commonlog.Logger.Error("InvalidKey",
+			zap.String("update failed", err.Error()),
+		)
+		return err
+	}
+
+	k.pool(cate, chainId).remove(key)
+
+	commonlog.Logger.Warn("InvalidKey",
+		zap.String("cate", cate),
+		zap.String("chainId", chainId),
+		zap.String("key", keyHash(key)),
+	)
+	return nil
+}
+
+// ProbeKeys probes once every key of keyDB that is neither in rotation nor
+// invalid and returns the number of keys probed. Keys the provider rejects
+// are marked invalid; expired keys that answer again at the configured success
+// rate are made standby keys again, and put in rotation if their pool is
+// short of keys.
+func (k *KeyManager) ProbeKeys(ctx context.Context) (int, error) {
+	names, err := k.keyCollections(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, name := range names {
+		cate, _, _ := strings.Cut(name, ".")
+		p, err := k.Provider(cate)
+		if err != nil {
+			continue
+		}
+
+		col := k.db.Collection(name)
+		filter := bson.M{"active": bson.M{"$ne": true}, "invalid": bson.M{"$ne": true}}
+		cursor, err := col.Find(ctx, filter)
+		if err != nil {
+			return n, err
+		}
+		var docs []*pooledKey
+		err = cursor.All(ctx, &docs)
+		cursor.Close(ctx)
+		if err != nil {
+			return n, err
+		}
+
+		for _, doc := range docs {
+			if err := ctx.Err(); err != nil {
+				return n, err
+			}
+			if err := k.open(doc); err != nil {
+				commonlog.Logger.Error("ProbeKeys",
+					zap.String("collection", name),
+					zap.String("open failed", err.Error()),
+				)
+				continue
+			}
+			probed, err := k.probeKey(ctx, cate, p, col, doc)
+			if err != nil {
+				commonlog.Logger.Error("ProbeKeys",
+					zap.String("collection", name),
+					zap.String("update failed", err.Error()),
+				)
+			}
+			if probed {
+				n++
+			}
+		}
+	}
+	return n, nil
+}
+
+// probeKey probes doc and records the result, reporting whether the provider
+// probes its keys at all.
+func (k *KeyManager) probeKey(ctx context.Context, cate string, p *Provider, col *mongo.Collection, doc *pooledKey) (bool, error) {
+	probe := p.Probe
+	if probe == nil {
+		probe = ProbeRPC
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, k.config.Keys.Probe.TimeoutDuration())
+	start := time.Now()
+	err := probe(probeCtx, p, doc.ChainId, &doc.APIKey)
+	latency := time.Since(start)
+	cancel()
+	if errors.Is(err, ErrNotProbed) {
+		return false, nil
+	}
+
+	result := probeResult{At: start, Latency: latency.Milliseconds()}
+	if doc.Probe != nil {
+		result.Probes, result.Successes, result.Rate = doc.Probe.Probes, doc.Probe.Successes, doc.Probe.Rate
+	}
+	success := 0.0
+	if err == nil {
+		success = 1
+		result.Successes++
+	} else {
+		result.Error = err.Error()
+	}
+	if result.Probes == 0 {
+		result.Rate = success
+	} else {
+		result.Rate = 0.8*result.Rate + 0.2*success
+	}
+	result.Probes++
+
+	set := bson.M{"probe": result}
+	update := bson.M{"$set": set}
+	recovered := false
+
+	if class, _ := p.ClassifyError(err); err != nil && class == ErrorAuth {
+		set["invalid"] = true
+		commonlog.Logger.Warn("ProbeKeys",
+			zap.String("cate", cate),
+			zap.String("chainId", doc.ChainId),
+			zap.String("invalid key", keyHash(doc.Key)),
+			zap.String("error", err.Error()),
+		)
+	} else if err == nil && doc.Expired != 0 && result.Rate >= k.config.Keys.Probe.Healthy() {
+		update["$unset"] = bson.M{"expired": "", "backoff": ""}
+		recovered = true
+	}
+
+	if _, err := col.UpdateByID(ctx, doc.ID, update); err != nil {
+		return true, err
+	}
+
+	if recovered {
+		commonlog.Logger.Info("ProbeKeys",
+			zap.String("cate", cate),
+			zap.String("chainId", doc.ChainId),
+			zap.String("recovered key", keyHash(doc.Key)),
+		)
+		if pool := k.pool(cate, doc.ChainId); pool.available() < k.poolSize() {
+			return true, k.SetKey(cate, doc.ChainId, doc.Key)
+		}
+	}
+	return true, nil
+}
+
+// probeLoop runs ProbeKeys every interval until the key manager is closed.
+func (k *KeyManager) probeLoop(interval time.Duration) {
+	defer k.workers.Done()
+
+	ctx, cancel := k.workerContext()
+	defer cancel()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			n, err := k.ProbeKeys(ctx)
+			if err != nil && ctx.Err() == nil {
+				commonlog.Logger.Error("ProbeKeys", zap.Error(err))
+			}
+			commonlog.Logger.Debug("ProbeKeys", zap.Int("probed", n))
+		case <-k.stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package key
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coinmeca/db-connector/conf"
+	"github.com/coinmeca/go-common/commondatabase"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// AuthStyle is how a provider expects its key.
+type AuthStyle string
+
+const (
+	// AuthPath puts the key in place of {key} in the URL, or appends it.
+	AuthPath AuthStyle = "path"
+	// AuthQuery adds the key as the query parameter Param.
+	AuthQuery AuthStyle = "query"
+	// AuthHeader sends the key in the header Param, after Prefix.
+	AuthHeader AuthStyle = "header"
+	// AuthJWT sends a fresh HS256 token signed with the key as bearer token,
+	// as expected by nodes started with a JWT secret.
+	AuthJWT AuthStyle = "jwt"
+	// AuthNone sends no key.
+	AuthNone AuthStyle = "none"
+)
+
+// ErrorClass is the meaning of a provider error for the key that got it.
+type ErrorClass int
+
+const (
+	ErrorOther ErrorClass = iota
+	// ErrorRateLimit means the key has to rest before it is used again.
+	ErrorRateLimit
+	// ErrorAuth means the provider rejected the key.
+	ErrorAuth
+)
+
+// Provider describes an RPC or API provider whose keys are kept in keyDB.
+type Provider struct {
+	Name string
+
+	// URL is the endpoint template. {chain} is replaced by the name of the
+	// chain in Chains and {chainId} by the chain id. An empty URL uses the url
+	// stored with each key.
+	URL  string
+	Auth AuthStyle
+	// Param is the query parameter of AuthQuery or the header of AuthHeader.
+	Param  string
+	Prefix string
+
+	// Chains maps the supported chain ids to their name in URL. A nil map
+	// supports every chain.
+	Chains map[string]string
+	// PerChain keeps the keys of every chain in a collection of its own,
+	// named <name>.<chainId>; otherwise all keys share the collection <name>.
+	PerChain bool
+
+	// Classify recognizes the errors specific to the provider. Errors it
+	// reports as ErrorOther are classified by ClassifyError.
+	Classify func(err error) (ErrorClass, time.Duration)
+
+	// Probe checks a key for the health prober; nil uses ProbeRPC.
+	Probe ProbeFunc
+}
+
+var (
+	providersLock sync.RWMutex
+	providers     = map[string]*Provider{
+		"alchemy": {
+			Name:     "alchemy",
+			Auth:     AuthPath,
+			PerChain: true,
+		},
+		"infura": {
+			Name: "infura",
+			URL:  "https://{chain}.infura.io/v3/{key}",
+			Auth: AuthPath,
+			Chains: map[string]string{
+				"1":        "mainnet",
+				"10":       "optimism-mainnet",
+				"137":      "polygon-mainnet",
+				"8453":     "base-mainnet",
+				"42161":    "arbitrum-mainnet",
+				"11155111": "sepolia",
+			},
+			PerChain: true,
+		},
+		"quicknode": {
+			Name:     "quicknode",
+			Auth:     AuthPath,
+			PerChain: true,
+		},
+		"cmc": {
+			Name:  "cmc",
+			URL:   "https://pro-api.coinmarketcap.com",
+			Auth:  AuthHeader,
+			Param: "X-CMC_PRO_API_KEY",
+			Probe: ProbeHTTP("/v1/key/info"),
+		},
+	}
+)
+
+// RegisterProvider adds p to the providers every KeyManager knows, replacing
+// a provider of the same name.
+func RegisterProvider(p *Provider) error {
+	if p == nil || p.Name == "" {
+		return errors.New("provider without name")
+	}
+	if err := p.validate(); err != nil {
+		return fmt.Errorf("provider %s: %w", p.Name, err)
+	}
+
+	providersLock.Lock()
+	defer providersLock.Unlock()
+	providers[p.Name] = p
+	return nil
+}
+
+// Providers returns the names of the registered providers.
+func Providers() []string {
+	providersLock.RLock()
+	defer providersLock.RUnlock()
+
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func registeredProvider(name string) (*Provider, bool) {
+	providersLock.RLock()
+	defer providersLock.RUnlock()
+	p, ok := providers[name]
+	return p, ok
+}
+
+// newProvider builds a provider from a [Keys.Providers.<name>] section.
+func newProvider(name string, c conf.ProviderConfig) *Provider {
+	auth := AuthStyle(strings.ToLower(c.Auth))
+	if auth == "" {
+		auth = AuthPath
+	}
+	chains := c.Chains
+	if len(chains) == 0 {
+		chains = nil
+	}
+	var probe ProbeFunc
+	switch p := strings.ToLower(c.Probe); {
+	case p == "none":
+		probe = ProbeNone
+	case strings.HasPrefix(p, "/"):
+		probe = ProbeHTTP(c.Probe)
+	}
+	return &Provider{
+		Name:     name,
+		URL:      c.URL,
+		Auth:     auth,
+		Param:    c.Param,
+		Prefix:   c.Prefix,
+		Chains:   chains,
+		PerChain: c.PerChain,
+		Probe:    probe,
+	}
+}
+
+func (p *Provider) validate() error {
+	switch p.Auth {
+	case AuthPath, AuthQuery, AuthJWT, AuthNone:
+	case AuthHeader:
+		if p.Param == "" {
+			return errors.New("header auth without header name")
+		}
+	default:
+		return fmt.Errorf("unknown auth style %q", p.Auth)
+	}
+	if p.Auth == AuthQuery && p.Param == "" {
+		return errors.New("query auth without parameter name")
+	}
+	return nil
+}
+
+// Supports reports whether the provider serves chainId.
+func (p *Provider) Supports(chainId string) bool {
+	if p.Chains == nil {
+		return true
+	}
+	_, ok := p.Chains[chainId]
+	return ok
+}
+
+// collection returns the name of the keyDB collection holding the keys of
+// chainId.
+func (p *Provider) collection(chainId string) string {
+	if p.PerChain {
+		return p.Name + "." + chainId
+	}
+	return p.Name
+}
+
+// Endpoint returns the URL to reach the provider on chainId with key.
+func (p *Provider) Endpoint(chainId string, key *commondatabase.APIKey) (string, error) {
+	if !p.Supports(chainId) {
+		return "", fmt.Errorf("provider %s does not support chain %s", p.Name, chainId)
+	}
+
+	endpoint := p.URL
+	if endpoint == "" {
+		endpoint = key.Url
+	}
+	if endpoint == "" {
+		return "", fmt.Errorf("provider %s has no url for key of chain %s", p.Name, chainId)
+	}
+	endpoint = strings.NewReplacer("{chain}", p.Chains[chainId], "{chainId}", chainId).Replace(endpoint)
+
+	switch p.Auth {
+	case AuthPath:
+		if strings.Contains(endpoint, "{key}") {
+			return strings.ReplaceAll(endpoint, "{key}", key.Key), nil
+		}
+		return endpoint + key.Key, nil
+	case AuthQuery:
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return "", err
+		}
+		query := u.Query()
+		query.Set(p.Param, key.Key)
+		u.RawQuery = query.Encode()
+		return u.String(), nil
+	}
+	return endpoint, nil
+}
+
+// Header returns the headers to send with every request made with key. JWT
+// tokens are short-lived, so the header is built anew for every request.
+func (p *Provider) Header(key *commondatabase.APIKey) (http.Header, error) {
+	header := make(http.Header)
+
+	switch p.Auth {
+	case AuthHeader:
+		header.Set(p.Param, p.Prefix+key.Key)
+	case AuthJWT:
+		token, err := jwtToken(key.Key, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		header.Set("Authorization", "Bearer "+token)
+	}
+
+	return header, nil
+}
+
+// ClassifyError returns the class of err of p and, for rate limits, how long
+// the key has to rest; zero if the provider did not say.
+func (p *Provider) ClassifyError(err error) (ErrorClass, time.Duration) {
+	if p.Classify != nil {
+		if class, wait := p.Classify(err); class != ErrorOther {
+			return class, wait
+		}
+	}
+	return ClassifyError(err)
+}
+
+// authMessages are fragments of the errors providers answer a rejected key
+// with.
+var authMessages = []string{
+	"invalid api key",
+	"unauthorized",
+	"must be authenticated",
+	"invalid project id",
+	"api key is missing",
+}
+
+// ClassifyError classifies the errors common to the providers: rate limits
+// as recognized by RateLimited and rejected keys.
+func ClassifyError(err error) (ErrorClass, time.Duration) {
+	if err == nil {
+		return ErrorOther, 0
+	}
+	if limited, wait := RateLimited(err); limited {
+		return ErrorRateLimit, wait
+	}
+
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) && (httpErr.StatusCode == http.StatusUnauthorized || httpErr.StatusCode == http.StatusForbidden) {
+		return ErrorAuth, 0
+	}
+
+	message := strings.ToLower(err.Error())
+	for _, fragment := range authMessages {
+		if strings.Contains(message, fragment) {
+			return ErrorAuth, 0
+		}
+	}
+	return ErrorOther, 0
+}
+
+// jwtToken returns an HS256 token with the issued-at claim, signed with the
+// hex encoded secret, or the raw secret if it is not hex.
+func jwtToken(secret string, now time.Time) (string, error) {
+	key, err := hex.DecodeString(strings.TrimPrefix(secret, "0x"))
+	if err != nil {
+		key = []byte(secret)
+	}
+	if len(key) == 0 {
+		return "", errors.New("empty jwt secret")
+	}
+
+	encode := base64.RawURLEncoding.EncodeToString
+	unsigned := encode([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + encode([]byte(fmt.Sprintf(`{"iat":%d}`, now.Unix())))
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + encode(mac.Sum(nil)), nil
+}
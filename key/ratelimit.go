@@ -0,0 +1,83 @@
+package key
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// rateLimitMessages are fragments of the rate-limit errors of the providers
+// in use, for the ones that do not answer with HTTP 429.
+var rateLimitMessages = []string{
+	"rate limit",
+	"too many requests",
+	"exceeded its compute units",
+	"exceeded its throughput",
+	"limit exceeded",
+	"daily request count exceeded",
+}
+
+// RateLimited reports whether err is a rate-limit response of an RPC provider
+// and how long the provider asked to wait; zero if it did not say.
+func RateLimited(err error) (bool, time.Duration) {
+	if err == nil {
+		return false, 0
+	}
+
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusTooManyRequests {
+		return true, backoffOf(httpErr.Body)
+	}
+
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) {
+		switch rpcErr.ErrorCode() {
+		case http.StatusTooManyRequests, -32005:
+			var wait time.Duration
+			var dataErr rpc.DataError
+			if errors.As(err, &dataErr) {
+				if data, err := json.Marshal(dataErr.ErrorData()); err == nil {
+					wait = backoffOf(data)
+				}
+			}
+			return true, wait
+		}
+	}
+
+	message := strings.ToLower(err.Error())
+	for _, fragment := range rateLimitMessages {
+		if strings.Contains(message, fragment) {
+			return true, 0
+		}
+	}
+	return false, 0
+}
+
+// backoffOf reads backoff_seconds from an error body or error data, found at
+// the top level or below "rate" or "error".
+func backoffOf(body []byte) time.Duration {
+	var data struct {
+		BackoffSeconds float64 `json:"backoff_seconds"`
+		Rate           struct {
+			BackoffSeconds float64 `json:"backoff_seconds"`
+		} `json:"rate"`
+		Error struct {
+			Data struct {
+				BackoffSeconds float64 `json:"backoff_seconds"`
+				Rate           struct {
+					BackoffSeconds float64 `json:"backoff_seconds"`
+				} `json:"rate"`
+			} `json:"data"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return 0
+	}
+
+	seconds := max(data.BackoffSeconds, data.Rate.BackoffSeconds, data.Error.Data.BackoffSeconds, data.Error.Data.Rate.BackoffSeconds)
+	return time.Duration(seconds * float64(time.Second))
+}
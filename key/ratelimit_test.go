@@ -0,0 +1,88 @@
+package key
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// rpcError is a JSON-RPC error response as returned by the rpc client.
+type rpcError struct {
+	code    int
+	message string
+	data    interface{}
+}
+
+func (e *rpcError) Error() string          { return e.message }
+func (e *rpcError) ErrorCode() int         { return e.code }
+func (e *rpcError) ErrorData() interface{} { return e.data }
+
+func TestRateLimited(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		limited bool
+		wait    time.Duration
+	}{
+		{
+			name: "no error",
+		},
+		{
+			name: "other error",
+			err:  errors.New("connection refused"),
+		},
+		{
+			name:    "http 429",
+			err:     rpc.HTTPError{StatusCode: 429, Status: "429 Too Many Requests"},
+			limited: true,
+		},
+		{
+			name:    "http 429 with backoff",
+			err:     rpc.HTTPError{StatusCode: 429, Body: []byte(`{"backoff_seconds": 1.5}`)},
+			limited: true,
+			wait:    1500 * time.Millisecond,
+		},
+		{
+			name:    "http 429 with backoff below error data",
+			err:     rpc.HTTPError{StatusCode: 429, Body: []byte(`{"error": {"data": {"rate": {"backoff_seconds": 2}}}}`)},
+			limited: true,
+			wait:    2 * time.Second,
+		},
+		{
+			name: "other http status",
+			err:  rpc.HTTPError{StatusCode: 503, Status: "503 Service Unavailable"},
+		},
+		{
+			name:    "json-rpc 429",
+			err:     &rpcError{code: 429, message: "slow down"},
+			limited: true,
+		},
+		{
+			name:    "json-rpc limit exceeded with backoff",
+			err:     &rpcError{code: -32005, message: "slow down", data: map[string]interface{}{"rate": map[string]interface{}{"backoff_seconds": 3}}},
+			limited: true,
+			wait:    3 * time.Second,
+		},
+		{
+			name: "json-rpc revert",
+			err:  &rpcError{code: 3, message: "execution reverted"},
+		},
+		{
+			name:    "provider message",
+			err:     fmt.Errorf("call: %w", errors.New("Your app has exceeded its compute units per second capacity")),
+			limited: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limited, wait := RateLimited(tt.err)
+			if limited != tt.limited || wait != tt.wait {
+				t.Errorf("RateLimited = %v, %v, want %v, %v", limited, wait, tt.limited, tt.wait)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package key
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/coinmeca/go-common/commonlog"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// keyChange is the part of a change event of keyDB the pools need.
+type keyChange struct {
+	OperationType string `bson:"operationType"`
+	Ns            struct {
+		Coll string `bson:"coll"`
+	} `bson:"ns"`
+	DocumentKey struct {
+		ID primitive.ObjectID `bson:"_id"`
+	} `bson:"documentKey"`
+	FullDocument *pooledKey `bson:"fullDocument"`
+}
+
+// workerContext returns a context canceled once the key manager is closed.
+func (k *KeyManager) workerContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-k.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+func (k *KeyManager) syncInterval() time.Duration {
+	if k.config.Keys.SyncInterval <= 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(k.config.Keys.SyncInterval)
+}
+
+// syncLoop keeps the pools in line with the keys other instances activate,
+// expire or back off in keyDB, following its change stream or, when change
+// streams are not available, polling it.
+func (k *KeyManager) syncLoop() {
+	defer k.workers.Done()
+
+	ctx, cancel := k.workerContext()
+	defer cancel()
+
+	if k.config.Keys.Sync != "poll" {
+		err := k.watchKeys(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		commonlog.Logger.Warn("syncLoop: change stream not available, polling keyDB",
+			zap.String("error", err.Error()),
+		)
+	}
+
+	ticker := time.NewTicker(k.syncInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			k.SyncPools()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// watchKeys applies the changes of keyDB to the pools until ctx is done. A
+// stream that breaks is opened again after the last change seen; the error is
+// returned once a stream cannot be opened at all.
+func (k *KeyManager) watchKeys(ctx context.Context) error {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"operationType": bson.M{"$in": bson.A{"insert", "update", "replace", "delete"}}}}},
+	}
+
+	var token bson.Raw
+	for {
+		opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+		if token != nil {
+			opts.SetResumeAfter(token)
+		}
+		stream, err := k.db.Watch(ctx, pipeline, opts)
+		if err != nil {
+			return err
+		}
+
+		// changes made before the stream was opened
+		k.SyncPools()
+
+		for stream.Next(ctx) {
+			var change keyChange
+			if err := stream.Decode(&change); err != nil {
+				commonlog.Logger.Error("watchKeys",
+					zap.String("decode failed", err.Error()),
+				)
+			} else {
+				k.applyChange(&change)
+			}
+			token = stream.ResumeToken()
+		}
+		err = stream.Err()
+		stream.Close(context.Background())
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		commonlog.Logger.Error("watchKeys",
+			zap.String("stream failed", errString(err)),
+		)
+
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// applyChange puts the key of a changed document in rotation or takes it out,
+// in the pool of its category and chain if this instance has one.
+func (k *KeyManager) applyChange(change *keyChange) {
+	cate, _, _ := strings.Cut(change.Ns.Coll, ".")
+
+	doc := change.FullDocument
+	if doc == nil {
+		// deleted, or deleted before the update was looked up
+		for _, pool := range k.poolsOf(cate) {
+			pool.removeID(change.DocumentKey.ID)
+		}
+		return
+	}
+
+	pool := k.existingPool(cate, doc.ChainId)
+	if pool == nil {
+		return
+	}
+	if err := k.open(doc); err != nil {
+		commonlog.Logger.Error("applyChange",
+			zap.String("collection", change.Ns.Coll),
+			zap.String("open failed", err.Error()),
+		)
+		return
+	}
+
+	if doc.Active && !doc.Invalid {
+		pool.add(doc)
+	} else {
+		pool.remove(doc.Key)
+	}
+}
+
+// SyncPools reloads every pool from the keys active in keyDB. Keys dropped
+// with DropKey but still active in keyDB are put back in rotation.
+func (k *KeyManager) SyncPools() {
+	k.lock.Lock()
+	ids := make([]string, 0, len(k.pools))
+	for id := range k.pools {
+		ids = append(ids, id)
+	}
+	k.lock.Unlock()
+
+	for _, id := range ids {
+		cate, chainId, _ := strings.Cut(id, ".")
+		active, err := k.activeKeys(cate, chainId)
+		if err != nil {
+			commonlog.Logger.Error("SyncPools",
+				zap.String("cate", cate),
+				zap.String("chainId", chainId),
+				zap.String("error", err.Error()),
+			)
+			continue
+		}
+		k.existingPool(cate, chainId).sync(active)
+	}
+}
+
+// existingPool returns the pool of cate and chainId, or nil if it was not
+// used yet.
+func (k *KeyManager) existingPool(cate, chainId string) *Pool {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	return k.pools[cate+"."+chainId]
+}
+
+// poolsOf returns the pools of every chain of cate.
+func (k *KeyManager) poolsOf(cate string) []*Pool {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	var pools []*Pool
+	for id, pool := range k.pools {
+		if strings.HasPrefix(id, cate+".") {
+			pools = append(pools, pool)
+		}
+	}
+	return pools
+}
+
+func errString(err error) string {
+	if err == nil {
+		return "stream closed"
+	}
+	return err.Error()
+}
@@ -0,0 +1,109 @@
+package key
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/coinmeca/db-connector/conf"
+	"github.com/coinmeca/go-common/commonlog"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.uber.org/zap"
+)
+
+// Usage counts the calls and compute units spent with a key in the current
+// minute and day, as seen by this process.
+type Usage struct {
+	Minute      time.Time
+	MinuteCalls int64
+	MinuteUnits int64
+
+	Day      time.Time
+	DayCalls int64
+	DayUnits int64
+
+	// BackoffUntil is set while the key rests after a rate-limit error.
+	BackoffUntil time.Time
+}
+
+// roll starts new windows once the minute or day of now has begun.
+func (u *Usage) roll(now time.Time) {
+	if minute := now.Truncate(time.Minute); !u.Minute.Equal(minute) {
+		u.Minute, u.MinuteCalls, u.MinuteUnits = minute, 0, 0
+	}
+	if day := now.UTC().Truncate(24 * time.Hour); !u.Day.Equal(day) {
+		u.Day, u.DayCalls, u.DayUnits = day, 0, 0
+	}
+}
+
+func (u *Usage) add(now time.Time, units int64) {
+	u.roll(now)
+	u.MinuteCalls++
+	u.MinuteUnits += units
+	u.DayCalls++
+	u.DayUnits += units
+}
+
+// over reports whether any limit of q is used up to share, 1 meaning the
+// limit itself.
+func (u *Usage) over(now time.Time, q conf.QuotaConfig, share float64) bool {
+	u.roll(now)
+	for _, l := range []struct{ used, limit int64 }{
+		{u.MinuteCalls, q.CallsPerMinute},
+		{u.DayCalls, q.CallsPerDay},
+		{u.MinuteUnits, q.UnitsPerMinute},
+		{u.DayUnits, q.UnitsPerDay},
+	} {
+		if l.limit > 0 && float64(l.used) >= share*float64(l.limit) {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *Usage) backingOff(now time.Time) bool {
+	return now.Before(u.BackoffUntil)
+}
+
+// RecordUsage counts a call of the RPC method made with key against its quota.
+func (k *KeyManager) RecordUsage(cate, chainId, key, method string) {
+	k.pool(cate, chainId).record(key, k.config.Keys.Quotas[cate].Cost(method))
+}
+
+// BackoffKey rests key after a rate limit for wait, or for the backoff of the
+// quota of cate when wait is not known. Unlike ExpiredKey the key stays
+// active, and the rest is stored in keyDB so other instances skip it as well.
+func (k *KeyManager) BackoffKey(cate, chainId, key string, wait time.Duration) error {
+	if wait <= 0 {
+		wait = k.config.Keys.Quotas[cate].BackoffDuration()
+	}
+	until := time.Now().Add(wait)
+
+	k.pool(cate, chainId).backoff(key, until)
+
+	col := k.col(cate, chainId)
+	if col == nil {
+		return errors.New("not found collection")
+	}
+
+	filter := k.keyFilter(chainId, key)
+	update := bson.M{"$set": bson.M{"backoff": until.Unix()}}
+	if _, err := col.UpdateOne(context.Background(), filter, update); err != nil {
+		commonlog.Logger.Error("BackoffKey",
+			zap.String("update failed", err.Error()),
+		)
+		return err
+	}
+
+	commonlog.Logger.Info("BackoffKey",
+		zap.String("cate", cate),
+		zap.String("chainId", chainId),
+		zap.Duration("wait", wait),
+	)
+	return nil
+}
+
+// GetKeyUsage returns the usage of the keys in the pool of cate and chainId.
+func (k *KeyManager) GetKeyUsage(cate, chainId string) map[string]Usage {
+	return k.pool(cate, chainId).Usage()
+}
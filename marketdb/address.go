@@ -1,8 +1,7 @@
 ﻿package marketdb
 
 import (
-	"context"
-
+	"github.com/coinmeca/db-connector/conf"
 	"github.com/coinmeca/go-common/commonlog"
 	"github.com/coinmeca/go-common/commonprotocol"
 	"go.mongodb.org/mongo-driver/bson"
@@ -24,7 +23,9 @@ func (m *MarketDB) GetMarketTicker(chainId, address *string) map[string]string {
 	token := bson.M{}
 	result := make(map[string]string)
 
-	err := m.ColMarket.FindOne(context.Background(), filter, options.FindOne().SetProjection(projection)).Decode(&token)
+	col, ctx, cancel := m.collection(m.ColMarket, conf.OpInfoRead)
+	defer cancel()
+	err := col.FindOne(ctx, filter, options.FindOne().SetProjection(projection)).Decode(&token)
 	if err != nil {
 		commonlog.Logger.Debug("MarketDB",
 			zap.String("GetMarketTicker", err.Error()),
@@ -44,14 +45,16 @@ func (m *MarketDB) GetAllMarketAddresses() ([]*commonprotocol.Contract, error) {
 		"chainId": 1,
 		"address": 1,
 	})
-	cursor, err := m.ColMarket.Find(context.Background(), bson.M{}, option)
+	col, ctx, cancel := m.collection(m.ColMarket, conf.OpInfoRead)
+	defer cancel()
+	cursor, err := col.Find(ctx, bson.M{}, option)
 
 	if err != nil {
 		return markets, err
 	}
-	defer cursor.Close(context.Background())
+	defer cursor.Close(ctx)
 
-	for cursor.Next(context.Background()) {
+	for cursor.Next(ctx) {
 		mk := &commonprotocol.Contract{}
 		if err := cursor.Decode(&mk); err == nil {
 			mk.Cate = "abstract"
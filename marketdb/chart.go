@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/coinmeca/db-connector/conf"
+	"github.com/coinmeca/db-connector/journal"
 	"github.com/coinmeca/go-common/commonlog"
 	"github.com/coinmeca/go-common/commonmethod/market"
 	"github.com/coinmeca/go-common/commonutils"
@@ -21,11 +23,17 @@ func (m *MarketDB) SaveChart(chart *market.Chart, interval int64) error {
 	}
 
 	filter, update := m.BsonForChart(chart, &interval)
+	pipeline, err := m.chartUpdate(chart.ChainId, update)
+	if err != nil {
+		return err
+	}
 	option := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
-	err := m.ColChart.FindOneAndUpdate(
-		context.Background(),
+	col, ctx, cancel := m.collection(m.ColChart, conf.OpChartWrite)
+	defer cancel()
+	err = col.FindOneAndUpdate(
+		ctx,
 		filter,
-		update,
+		pipeline,
 		option,
 	).Decode(chart)
 
@@ -43,14 +51,20 @@ func (m *MarketDB) SaveChartByIntervals(chart *market.Chart) error {
 
 	var models []mongo.WriteModel
 	for _, update := range updates {
+		pipeline, err := m.chartUpdate(chart.ChainId, update["update"])
+		if err != nil {
+			return err
+		}
 		models = append(models, mongo.NewUpdateOneModel().
 			SetFilter(update["filter"]).
-			SetUpdate(update["update"]).
+			SetUpdate(pipeline).
 			SetUpsert(true))
 	}
 	fmt.Println(commonutils.Prettify(models))
 
-	_, err := m.ColChart.BulkWrite(context.Background(), models)
+	col, ctx, cancel := m.collection(m.ColChart, conf.OpChartWrite)
+	defer cancel()
+	_, err := col.BulkWrite(ctx, models)
 	if err != nil {
 		commonlog.Logger.Error("Market SaveChartByIntervals bulk write failed",
 			zap.String("error", err.Error()),
@@ -68,12 +82,18 @@ func (m *MarketDB) SaveChartVolume(chart *market.Chart, interval int64) error {
 	}
 
 	filter, update := m.BsonForChartVolume(chart, &interval)
+	pipeline, err := m.chartUpdate(chart.ChainId, update)
+	if err != nil {
+		return err
+	}
 	option := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
 
-	err := m.ColChart.FindOneAndUpdate(
-		context.Background(),
+	col, ctx, cancel := m.collection(m.ColChart, conf.OpChartWrite)
+	defer cancel()
+	err = col.FindOneAndUpdate(
+		ctx,
 		filter,
-		update,
+		pipeline,
 		option,
 	).Decode(chart)
 	if err != nil {
@@ -90,13 +110,19 @@ func (m *MarketDB) SaveChartVolumesByIntervals(chart *market.Chart) error {
 
 	var models []mongo.WriteModel
 	for _, update := range updates {
+		pipeline, err := m.chartUpdate(chart.ChainId, update["update"])
+		if err != nil {
+			return err
+		}
 		models = append(models, mongo.NewUpdateOneModel().
 			SetFilter(update["filter"]).
-			SetUpdate(update["update"]).
+			SetUpdate(pipeline).
 			SetUpsert(true))
 	}
 
-	_, err := m.ColChart.BulkWrite(context.Background(), models)
+	col, ctx, cancel := m.collection(m.ColChart, conf.OpChartWrite)
+	defer cancel()
+	_, err := col.BulkWrite(ctx, models)
 	if err != nil {
 		commonlog.Logger.Error("Market SaveChartByIntervals bulk write failed",
 			zap.String("error", err.Error()),
@@ -115,14 +141,16 @@ func (m *MarketDB) GetChart(chainId, address *string, interval *int64) ([]*marke
 	}
 
 	var chart []*market.Chart
-	cursor, err := m.ColChart.Find(context.Background(), filter)
+	col, ctx, cancel := m.collection(m.ColChart, conf.OpChartRead)
+	defer cancel()
+	cursor, err := col.Find(ctx, filter)
 
 	if err != nil {
 		return chart, err
 	}
-	defer cursor.Close(context.Background())
+	defer cursor.Close(ctx)
 
-	for cursor.Next(context.Background()) {
+	for cursor.Next(ctx) {
 		var c *market.Chart
 		if err := cursor.Decode(&chart); err == nil {
 			chart = append(chart, c)
@@ -141,8 +169,10 @@ func (m *MarketDB) GetChartLast(chainId, address *string, interval *int64) *mark
 		"interval": interval,
 	}
 
-	err := m.ColChart.FindOne(
-		context.Background(),
+	col, ctx, cancel := m.collection(m.ColChart, conf.OpChartRead)
+	defer cancel()
+	err := col.FindOne(
+		ctx,
 		filter,
 		options.FindOne().SetSort(bson.D{{"time", -1}}),
 	).Decode(chart)
@@ -156,3 +186,29 @@ func (m *MarketDB) GetChartLast(chainId, address *string, interval *int64) *mark
 
 	return chart
 }
+
+// RollbackCharts undoes the writes made to the charts of chainId at or after
+// since, in unix nanoseconds, for blocks orphaned by a reorganization.
+func (m *MarketDB) RollbackCharts(ctx context.Context, chainId string, since int64) (int64, error) {
+	col, opCtx, cancel := m.collection(m.ColChart, conf.OpChartWrite)
+	defer cancel()
+	defer context.AfterFunc(ctx, cancel)()
+	undone, err := journal.Rollback(opCtx, col, bson.M{"chainId": chainId}, since)
+	if err != nil {
+		commonlog.Logger.Error("RollbackCharts",
+			zap.String("chainId", chainId),
+			zap.String("error", err.Error()),
+		)
+	}
+	return undone, err
+}
+
+// chartUpdate turns update into a pipeline keeping the revision of the bucket,
+// so RollbackCharts can undo it.
+func (m *MarketDB) chartUpdate(chainId string, update interface{}) (mongo.Pipeline, error) {
+	doc, ok := update.(bson.M)
+	if !ok {
+		return nil, fmt.Errorf("chart update must be a document, got %T", update)
+	}
+	return journal.Update(doc, "close", journal.Stamp(chainId), m.config.Checkpoint.WindowSize())
+}
@@ -1,10 +1,10 @@
 ﻿package marketdb
 
 import (
-	"context"
 	"fmt"
 	"strings"
 
+	"github.com/coinmeca/db-connector/conf"
 	"github.com/coinmeca/go-common/commonlog"
 	"github.com/coinmeca/go-common/commonmethod/market"
 	"github.com/coinmeca/go-common/commonutils"
@@ -16,7 +16,9 @@ import (
 )
 
 func (m *MarketDB) BulkWriteInfo(models []mongo.WriteModel) error {
-	result, err := m.ColMarket.BulkWrite(context.Background(), models)
+	col, ctx, cancel := m.collection(m.ColMarket, conf.OpInfoWrite)
+	defer cancel()
+	result, err := col.BulkWrite(ctx, models)
 	if err != nil {
 		commonlog.Logger.Error("MarketDB",
 			zap.String("BulkWriteInfo", err.Error()),
@@ -36,8 +38,10 @@ func (m *MarketDB) SaveMarketInfo(info *market.Market) error {
 	filter, update := m.BsonForInfo(info)
 	option := options.Update().SetUpsert(true)
 
-	_, err := m.ColMarket.UpdateOne(
-		context.Background(),
+	col, ctx, cancel := m.collection(m.ColMarket, conf.OpInfoWrite)
+	defer cancel()
+	_, err := col.UpdateOne(
+		ctx,
 		filter,
 		update,
 		option,
@@ -88,7 +92,9 @@ func (e *MarketDB) SaveOrderbook(o market.OutputOrderbookResult) error {
 	}
 	opts := options.Update().SetUpsert(true)
 
-	_, err := e.ColMarket.UpdateOne(context.Background(), filter, update, opts)
+	col, ctx, cancel := e.collection(e.ColMarket, conf.OpInfoWrite)
+	defer cancel()
+	_, err := col.UpdateOne(ctx, filter, update, opts)
 	if err != nil {
 		return err
 	}
@@ -97,7 +103,9 @@ func (e *MarketDB) SaveOrderbook(o market.OutputOrderbookResult) error {
 
 func (m *MarketDB) GetMarket(chainId, address *string) (*market.Market, error) {
 	mk := &market.Market{}
-	if err := m.ColMarket.FindOne(context.Background(), bson.M{"chainId": chainId, "address": strings.ToLower(*address)}, nil).Decode(mk); err != nil {
+	col, ctx, cancel := m.collection(m.ColMarket, conf.OpInfoRead)
+	defer cancel()
+	if err := col.FindOne(ctx, bson.M{"chainId": chainId, "address": strings.ToLower(*address)}, nil).Decode(mk); err != nil {
 		commonlog.Logger.Debug("MarketDB",
 			zap.String("GetMarket", err.Error()),
 		)
@@ -109,7 +117,9 @@ func (m *MarketDB) GetMarket(chainId, address *string) (*market.Market, error) {
 
 func (m *MarketDB) GetMarketRoute(chainId *string, base *string, quote *string) (*market.Market, error) {
 	mk := &market.Market{}
-	if err := m.ColMarket.FindOne(context.Background(), bson.M{"chainId": chainId, "base": strings.ToLower(*base), "quote": strings.ToLower(*quote)}, nil).Decode(mk); err != nil {
+	col, ctx, cancel := m.collection(m.ColMarket, conf.OpInfoRead)
+	defer cancel()
+	if err := col.FindOne(ctx, bson.M{"chainId": chainId, "base": strings.ToLower(*base), "quote": strings.ToLower(*quote)}, nil).Decode(mk); err != nil {
 		return nil, err
 	} else {
 		return mk, nil
@@ -118,13 +128,15 @@ func (m *MarketDB) GetMarketRoute(chainId *string, base *string, quote *string)
 
 func (m *MarketDB) GetMarkets(chainId *string) ([]*market.Market, error) {
 	var markets []*market.Market
-	cursor, err := m.ColMarket.Find(context.Background(), bson.M{"chainId": chainId})
+	col, ctx, cancel := m.collection(m.ColMarket, conf.OpInfoRead)
+	defer cancel()
+	cursor, err := col.Find(ctx, bson.M{"chainId": chainId})
 	if err != nil {
 		return nil, err
 	}
-	defer cursor.Close(context.Background())
+	defer cursor.Close(ctx)
 
-	for cursor.Next(context.Background()) {
+	for cursor.Next(ctx) {
 		mk := &market.Market{}
 		if err := cursor.Decode(mk); err != nil {
 			return nil, err
@@ -136,14 +148,16 @@ func (m *MarketDB) GetMarkets(chainId *string) ([]*market.Market, error) {
 
 func (m *MarketDB) GetAllMarkets() ([]*market.Market, error) {
 	var markets []*market.Market
-	cursor, err := m.ColMarket.Find(context.Background(), bson.M{})
+	col, ctx, cancel := m.collection(m.ColMarket, conf.OpInfoRead)
+	defer cancel()
+	cursor, err := col.Find(ctx, bson.M{})
 
 	if err != nil {
 		return markets, err
 	}
-	defer cursor.Close(context.Background())
+	defer cursor.Close(ctx)
 
-	for cursor.Next(context.Background()) {
+	for cursor.Next(ctx) {
 		mk := &market.Market{}
 		if err := cursor.Decode(mk); err == nil {
 			markets = append(markets, mk)
@@ -1,11 +1,11 @@
 ﻿package marketdb
 
 import (
-	"context"
 	"log"
 	"strings"
 	"time"
 
+	"github.com/coinmeca/db-connector/conf"
 	"github.com/coinmeca/go-common/commonlog"
 	"github.com/coinmeca/go-common/commonmethod/market"
 	"go.mongodb.org/mongo-driver/bson"
@@ -33,13 +33,15 @@ func (m *MarketDB) GetLastAll(time *int64, last *market.Last) {
 		}}},
 	}
 
-	cursor, err := m.ColChart.Aggregate(context.Background(), pipeline)
+	col, ctx, cancel := m.collection(m.ColChart, conf.OpAggregate)
+	defer cancel()
+	cursor, err := col.Aggregate(ctx, pipeline)
 	if err != nil {
 		commonlog.Logger.Error("GetLastAll",
 			zap.String("Load Error", err.Error()),
 		)
 	}
-	defer cursor.Close(context.Background())
+	defer cursor.Close(ctx)
 
 	var _24h struct {
 		BaseVolume  primitive.Decimal128 `bson:"base"`
@@ -51,7 +53,7 @@ func (m *MarketDB) GetLastAll(time *int64, last *market.Last) {
 		Time primitive.Decimal128 `bson:"time"`
 	}
 
-	if cursor.Next(context.Background()) {
+	if cursor.Next(ctx) {
 		if err := cursor.Decode(&_24h); err != nil {
 			commonlog.Logger.Error("GetLastAll",
 				zap.String("No Result decode data : ", ""),
@@ -79,15 +81,15 @@ func (m *MarketDB) GetLastAll(time *int64, last *market.Last) {
 		{{"$limit", 1}},
 	}
 
-	cursor, err = m.ColChart.Aggregate(context.Background(), pipeline)
+	cursor, err = col.Aggregate(ctx, pipeline)
 	if err != nil {
 		commonlog.Logger.Error("GetLastAll",
 			zap.String("Load Error 24hago ", err.Error()),
 		)
 	}
-	defer cursor.Close(context.Background())
+	defer cursor.Close(ctx)
 
-	if cursor.Next(context.Background()) {
+	if cursor.Next(ctx) {
 		// if err := cursor.Decode(&_24h); err != nil {
 		// commonlog.Logger.Info("GetLastAll",
 		// zap.String("No Result 24h ago", err.Error()),
@@ -113,17 +115,19 @@ func (e *MarketDB) GetVolume24h(chainId, address *string) (*primitive.Decimal128
 		}}},
 		{{"$sort", bson.M{"time": 1}}},
 	}
-	cursor, err := e.ColHistory.Aggregate(context.Background(), pipeline)
+	col, ctx, cancel := e.collection(e.ColHistory, conf.OpAggregate)
+	defer cancel()
+	cursor, err := col.Aggregate(ctx, pipeline)
 	if err != nil {
 		commonlog.Logger.Error("GetVolume24h",
 			zap.String("Load Error", err.Error()),
 		)
 		return nil, nil, err
 	}
-	defer cursor.Close(context.Background())
+	defer cursor.Close(ctx)
 
 	var results []bson.M
-	if err = cursor.All(context.Background(), &results); err != nil {
+	if err = cursor.All(ctx, &results); err != nil {
 		commonlog.Logger.Error("GetVolume24h",
 			zap.String("Cannot Find Result", err.Error()),
 		)
@@ -156,17 +160,19 @@ func (e *MarketDB) GetHighAndLow24h(chainId, address *string) (*primitive.Decima
 			{"low", bson.D{{"$min", "$low"}}},
 		}}},
 	}
-	cursor, err := e.ColChart.Aggregate(context.Background(), pipeline)
+	col, ctx, cancel := e.collection(e.ColChart, conf.OpAggregate)
+	defer cancel()
+	cursor, err := col.Aggregate(ctx, pipeline)
 	if err != nil {
 		commonlog.Logger.Error("GetHighAndLow24h",
 			zap.String("Load Error", err.Error()),
 		)
 		return nil, nil, err
 	}
-	defer cursor.Close(context.Background())
+	defer cursor.Close(ctx)
 
 	var results []bson.M
-	if err = cursor.All(context.Background(), &results); err != nil {
+	if err = cursor.All(ctx, &results); err != nil {
 		commonlog.Logger.Error("GetHighAndLow24h",
 			zap.String("Cannot Find Result", err.Error()),
 		)
@@ -201,14 +207,16 @@ func (e *MarketDB) GetPrice24hAgo(chainId, address *string) (*primitive.Decimal1
 		{{"$limit", 1}},
 	}
 
-	cursor, err := e.ColChart.Aggregate(context.Background(), pipeline)
+	col, ctx, cancel := e.collection(e.ColChart, conf.OpAggregate)
+	defer cancel()
+	cursor, err := col.Aggregate(ctx, pipeline)
 	if err != nil {
 		return nil, err
 	}
-	defer cursor.Close(context.Background())
+	defer cursor.Close(ctx)
 
 	var results []bson.M
-	if err = cursor.All(context.Background(), &results); err != nil {
+	if err = cursor.All(ctx, &results); err != nil {
 		log.Fatal(err)
 		return nil, err
 	}
@@ -1,8 +1,7 @@
 ﻿package marketdb
 
 import (
-	"context"
-
+	"github.com/coinmeca/db-connector/conf"
 	"github.com/coinmeca/go-common/commonlog"
 	"github.com/coinmeca/go-common/commonmethod/market"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -14,8 +13,10 @@ func (m *MarketDB) SaveMarketLiquidity(chainId, address *string, liquidity *[]*m
 	option := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
 
 	market := &market.Market{}
-	err := m.ColMarket.FindOneAndUpdate(
-		context.Background(),
+	col, ctx, cancel := m.collection(m.ColMarket, conf.OpInfoWrite)
+	defer cancel()
+	err := col.FindOneAndUpdate(
+		ctx,
 		filter,
 		update,
 		option,
@@ -20,6 +20,7 @@ type MarketDB struct {
 	config *conf.Config
 
 	client     *mongo.Client
+	release    func(ctx context.Context) error
 	ColMarket  *mongo.Collection
 	ColChart   *mongo.Collection
 	ColHistory *mongo.Collection
@@ -43,7 +44,7 @@ type MarketDBInterface interface {
 	BsonForChart(chart *market.Chart, interval *int64) (bson.M, bson.M)
 	BsonForChartPrice(chart *market.Chart, interval *int64) (bson.M, bson.M)
 	BsonForChartVolume(chart *market.Chart, interval *int64) (bson.M, bson.M)
-	BsonForChartByIntervals(chart *market.Chart) *[]bson.M
+	BsonForChartByIntervals(chart *market.Chart) []bson.M
 	BsonForMarketLiquidity(chainId *string, address *string, liquidity *[]*market.MarketLiquidity) (bson.M, bson.A)
 	BsonForMarketRecent(recent *market.Recent) (bson.M, bson.M)
 	BulkWriteInfo(models []mongo.WriteModel) error
@@ -63,6 +64,8 @@ type MarketDBInterface interface {
 	GetVolume24h(chainId *string, address *string) (*primitive.Decimal128, *primitive.Decimal128, error)
 
 	// setter
+	RollbackCharts(ctx context.Context, chainId string, since int64) (int64, error)
+	RollbackTxs(ctx context.Context, chainId string, txHashes []string) (int64, error)
 	SaveChart(chart *market.Chart, interval int64) error
 	SaveChartByIntervals(chart *market.Chart) error
 	SaveChartVolume(chart *market.Chart, interval int64) error
@@ -74,34 +77,42 @@ type MarketDBInterface interface {
 	SaveOrderbook(o market.OutputOrderbookResult) error
 
 	Start() error
+	Close(ctx context.Context) error
 }
 
-func NewDB(config *conf.Config) (commondatabase.IRepository, error) {
-	r := &MarketDB{
-		config: config,
-		start:  make(chan struct{}),
-	}
+var _ MarketDBInterface = (*MarketDB)(nil)
 
-	var err error
-	credential := options.Credential{
-		Username: r.config.Repositories["marketDB"]["username"].(string),
-		Password: r.config.Repositories["marketDB"]["pass"].(string),
+// NewDB connects a client of its own for [Repositories.marketDB], which Close
+// disconnects.
+func NewDB(config *conf.Config) (commondatabase.IRepository, error) {
+	client, err := config.Connect(context.Background(), "marketDB")
+	if err != nil {
+		return nil, err
 	}
 
-	clientOptions := options.Client().ApplyURI(config.Repositories["marketDB"]["datasource"].(string)).SetAuth(credential)
-	if r.client, err = mongo.Connect(context.Background(), clientOptions); err != nil {
+	r, err := NewDBWithClient(config, client, client.Disconnect)
+	if err != nil {
+		client.Disconnect(context.Background())
 		return nil, err
 	}
+	return r, nil
+}
 
-	if err = r.client.Ping(context.Background(), nil); err == nil {
-		db := r.client.Database(config.Repositories["marketDB"]["db"].(string))
-		r.ColMarket = db.Collection("market")
-		r.ColChart = db.Collection("chart")
-		r.ColHistory = db.Collection("history")
-	} else {
-		return nil, err
+// NewDBWithClient builds the repository on a client shared with other
+// repositories. Close calls release instead of disconnecting the client.
+func NewDBWithClient(config *conf.Config, client *mongo.Client, release func(ctx context.Context) error) (commondatabase.IRepository, error) {
+	r := &MarketDB{
+		config:  config,
+		client:  client,
+		release: release,
+		start:   make(chan struct{}),
 	}
 
+	db := r.client.Database(config.Repositories["marketDB"].DB, config.Repositories["marketDB"].DatabaseOptions())
+	r.ColMarket = db.Collection("market")
+	r.ColChart = db.Collection("chart")
+	r.ColHistory = db.Collection("history")
+
 	if err := marketIndex(r.ColMarket); err != nil {
 		return nil, err
 	}
@@ -132,6 +143,17 @@ func (e *MarketDB) Start() error {
 	}()
 }
 
+// Close releases the client of the repository.
+func (e *MarketDB) Close(ctx context.Context) error {
+	return e.release(ctx)
+}
+
+// collection returns col tuned for an operation class of
+// [Repositories.marketDB.operations] and the context to run the operation with.
+func (m *MarketDB) collection(col *mongo.Collection, class string) (*mongo.Collection, context.Context, context.CancelFunc) {
+	return m.config.Repositories["marketDB"].Collection(col, class)
+}
+
 func marketIndex(col *mongo.Collection) error {
 	index := mongo.IndexModel{
 		Keys: bson.D{
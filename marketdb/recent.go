@@ -2,9 +2,10 @@
 
 import (
 	"context"
-
+	"github.com/coinmeca/db-connector/conf"
 	"github.com/coinmeca/go-common/commonlog"
 	"github.com/coinmeca/go-common/commonmethod/market"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.uber.org/zap"
 )
@@ -13,8 +14,10 @@ func (m *MarketDB) SaveMarketRecent(recent *market.Recent) error {
 	filter, update := m.BsonForMarketRecent(recent)
 
 	option := options.Update().SetUpsert(true)
-	_, err := m.ColHistory.UpdateOne(
-		context.Background(),
+	col, ctx, cancel := m.collection(m.ColHistory, conf.OpHistoryWrite)
+	defer cancel()
+	_, err := col.UpdateOne(
+		ctx,
 		filter,
 		update,
 		option,
@@ -27,3 +30,25 @@ func (m *MarketDB) SaveMarketRecent(recent *market.Recent) error {
 	}
 	return nil
 }
+
+// RollbackTxs removes the history of chainId recorded for the transactions of
+// txHashes, orphaned by a reorganization.
+func (m *MarketDB) RollbackTxs(ctx context.Context, chainId string, txHashes []string) (int64, error) {
+	filter := bson.M{
+		"chainId": chainId,
+		"txHash":  bson.M{"$in": txHashes},
+	}
+
+	col, opCtx, cancel := m.collection(m.ColHistory, conf.OpHistoryWrite)
+	defer cancel()
+	defer context.AfterFunc(ctx, cancel)()
+	result, err := col.DeleteMany(opCtx, filter)
+	if err != nil {
+		commonlog.Logger.Error("RollbackTxs",
+			zap.String("chainId", chainId),
+			zap.String("error", err.Error()),
+		)
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
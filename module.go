@@ -0,0 +1,225 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/coinmeca/db-connector/accountdb"
+	"github.com/coinmeca/db-connector/batch"
+	"github.com/coinmeca/db-connector/conf"
+	"github.com/coinmeca/db-connector/contractdb"
+	"github.com/coinmeca/db-connector/farmdb"
+	"github.com/coinmeca/db-connector/historydb"
+	"github.com/coinmeca/db-connector/indexer"
+	"github.com/coinmeca/db-connector/key"
+	"github.com/coinmeca/db-connector/marketdb"
+	"github.com/coinmeca/db-connector/treasurydb"
+	"github.com/coinmeca/db-connector/vaultdb"
+
+	"github.com/coinmeca/go-common/commondatabase"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Module describes a repository built by Repositories. The modules named in
+// Requires are built and started before it and closed after it, so the
+// constructor can look them up through Get.
+type Module struct {
+	Name        string
+	Requires    []string
+	Constructor RepositoryConstructor
+}
+
+var builtinModules = []Module{
+	{Name: "keyDB", Constructor: newKeyManager},
+	{Name: "contractDB", Requires: []string{"keyDB"}, Constructor: newContractDB},
+	{Name: "batchDB", Constructor: mongoModule("batchDB", batch.NewDBWithClient)},
+	{Name: "historyDB", Constructor: mongoModule("historyDB", historydb.NewDBWithClient)},
+	{Name: "vaultDB", Constructor: mongoModule("vaultDB", vaultdb.NewDBWithClient)},
+	{Name: "marketDB", Constructor: mongoModule("marketDB", marketdb.NewDBWithClient)},
+	{Name: "farmDB", Constructor: mongoModule("farmDB", farmdb.NewDBWithClient)},
+	{Name: "treasuryDB", Constructor: mongoModule("treasuryDB", treasurydb.NewDBWithClient)},
+	{Name: "accountDB", Constructor: mongoModule("accountDB", accountdb.NewDBWithClient)},
+}
+
+func newKeyManager(config *conf.Config, root *Repositories) (commondatabase.IRepository, error) {
+	client, release, err := root.clients.acquire("keyDB")
+	if err != nil {
+		return nil, err
+	}
+
+	k, err := key.NewKeyManagerWithClient(config, client, release)
+	if err != nil {
+		release(context.Background())
+		return nil, err
+	}
+	return k, nil
+}
+
+func newContractDB(config *conf.Config, root *Repositories) (commondatabase.IRepository, error) {
+	var k *key.KeyManager
+	if err := root.Get(&k); err != nil {
+		return nil, err
+	}
+
+	client, release, err := root.clients.acquire("contractDB")
+	if err != nil {
+		return nil, err
+	}
+
+	rep, err := contractdb.NewDBWithClient(config, client, release, k)
+	if err != nil {
+		release(context.Background())
+		return nil, err
+	}
+	return rep, nil
+}
+
+// IndexerModule returns the module of an event log indexer over the contracts
+// of contractDB, rolling the repositories back through Rollback on a
+// reorganization. setup registers the handlers before the indexer starts. It
+// is not built in, services add it through WithModules.
+func IndexerModule(setup func(ix *indexer.Indexer)) Module {
+	return Module{
+		Name:     "indexer",
+		Requires: []string{"contractDB"},
+		Constructor: func(config *conf.Config, root *Repositories) (commondatabase.IRepository, error) {
+			c, err := Get[contractdb.ContractDBInterface](root)
+			if err != nil {
+				return nil, err
+			}
+			ix := indexer.NewIndexer(config, c)
+			ix.OnReorg(root.Rollback)
+			if setup != nil {
+				setup(ix)
+			}
+			return ix, nil
+		},
+	}
+}
+
+// mongoModule adapts a repository constructor taking the shared client of the
+// named conf.Repositories entry and the function releasing it on Close.
+func mongoModule(name string, constructor func(*conf.Config, *mongo.Client, func(context.Context) error) (commondatabase.IRepository, error)) RepositoryConstructor {
+	return func(config *conf.Config, root *Repositories) (commondatabase.IRepository, error) {
+		client, release, err := root.clients.acquire(name)
+		if err != nil {
+			return nil, err
+		}
+
+		rep, err := constructor(config, client, release)
+		if err != nil {
+			release(context.Background())
+			return nil, err
+		}
+		return rep, nil
+	}
+}
+
+// enabledModules returns the modules named in enabled and, transitively, the
+// modules they require, in declared order. All modules are enabled when the
+// list is empty.
+func enabledModules(modules []Module, enabled []string) ([]Module, error) {
+	if len(enabled) == 0 {
+		return modules, nil
+	}
+
+	byName := make(map[string]Module, len(modules))
+	for _, m := range modules {
+		byName[m.Name] = m
+	}
+
+	set := make(map[string]bool, len(modules))
+	var enable func(name, by string) error
+	enable = func(name, by string) error {
+		if set[name] {
+			return nil
+		}
+		m, ok := byName[name]
+		if !ok && by == "" {
+			return fmt.Errorf("unknown repository %s", name)
+		} else if !ok {
+			return fmt.Errorf("repository %s requires %s, which is not registered", by, name)
+		}
+		set[name] = true
+		for _, dep := range m.Requires {
+			if err := enable(dep, name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, name := range enabled {
+		if err := enable(name, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	result := make([]Module, 0, len(set))
+	for _, m := range modules {
+		if set[m.Name] {
+			result = append(result, m)
+		}
+	}
+	return result, nil
+}
+
+// sortModules orders modules so every module comes after the modules it
+// requires. Modules without a dependency between them keep their declared
+// order. Unknown dependencies and cycles are reported as errors.
+func sortModules(modules []Module) ([]Module, error) {
+	byName := make(map[string]Module, len(modules))
+	for _, m := range modules {
+		if _, ok := byName[m.Name]; ok {
+			return nil, fmt.Errorf("duplicated repository module %s", m.Name)
+		}
+		byName[m.Name] = m
+	}
+
+	const (
+		visiting = iota + 1
+		visited
+	)
+
+	state := make(map[string]int, len(modules))
+	sorted := make([]Module, 0, len(modules))
+	path := make([]string, 0)
+
+	var visit func(m Module) error
+	visit = func(m Module) error {
+		switch state[m.Name] {
+		case visited:
+			return nil
+		case visiting:
+			cycle := append(path[slices.Index(path, m.Name):], m.Name)
+			return fmt.Errorf("repository dependency cycle: %s", strings.Join(cycle, " -> "))
+		}
+
+		state[m.Name] = visiting
+		path = append(path, m.Name)
+		for _, name := range m.Requires {
+			dep, ok := byName[name]
+			if !ok {
+				return fmt.Errorf("repository %s requires %s, which is not registered", m.Name, name)
+			}
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[m.Name] = visited
+
+		sorted = append(sorted, m)
+		return nil
+	}
+
+	for _, m := range modules {
+		if err := visit(m); err != nil {
+			return nil, err
+		}
+	}
+
+	return sorted, nil
+}
@@ -0,0 +1,161 @@
+package db
+
+import (
+	"slices"
+	"testing"
+)
+
+func modules(specs ...[]string) []Module {
+	modules := make([]Module, 0, len(specs))
+	for _, spec := range specs {
+		modules = append(modules, Module{Name: spec[0], Requires: spec[1:]})
+	}
+	return modules
+}
+
+func names(modules []Module) []string {
+	names := make([]string, 0, len(modules))
+	for _, m := range modules {
+		names = append(names, m.Name)
+	}
+	return names
+}
+
+func TestSortModules(t *testing.T) {
+	tests := []struct {
+		name    string
+		modules []Module
+		want    []string
+		err     string
+	}{
+		{
+			name:    "no dependencies keep their order",
+			modules: modules([]string{"b"}, []string{"a"}, []string{"c"}),
+			want:    []string{"b", "a", "c"},
+		},
+		{
+			name:    "dependency moves first",
+			modules: modules([]string{"a", "b"}, []string{"b"}),
+			want:    []string{"b", "a"},
+		},
+		{
+			name:    "transitive dependencies",
+			modules: modules([]string{"a", "b"}, []string{"b", "c"}, []string{"c"}, []string{"d"}),
+			want:    []string{"c", "b", "a", "d"},
+		},
+		{
+			name:    "shared dependency once",
+			modules: modules([]string{"a", "c"}, []string{"b", "c"}, []string{"c"}),
+			want:    []string{"c", "a", "b"},
+		},
+		{
+			name:    "cycle",
+			modules: modules([]string{"a", "b"}, []string{"b", "a"}),
+			err:     "repository dependency cycle: a -> b -> a",
+		},
+		{
+			name:    "cycle past a module",
+			modules: modules([]string{"a", "b"}, []string{"b", "c"}, []string{"c", "b"}),
+			err:     "repository dependency cycle: b -> c -> b",
+		},
+		{
+			name:    "self dependency",
+			modules: modules([]string{"a", "a"}),
+			err:     "repository dependency cycle: a -> a",
+		},
+		{
+			name:    "unknown dependency",
+			modules: modules([]string{"a", "b"}),
+			err:     "repository a requires b, which is not registered",
+		},
+		{
+			name:    "duplicated module",
+			modules: modules([]string{"a"}, []string{"a"}),
+			err:     "duplicated repository module a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sorted, err := sortModules(tt.modules)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := names(sorted); !slices.Equal(got, tt.want) {
+				t.Errorf("order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnabledModules(t *testing.T) {
+	registered := modules([]string{"key"}, []string{"contract", "key"}, []string{"market", "contract"}, []string{"vault", "contract"}, []string{"farm"})
+
+	tests := []struct {
+		name    string
+		modules []Module
+		enabled []string
+		want    []string
+		err     string
+	}{
+		{
+			name:    "all when none enabled",
+			modules: registered,
+			want:    []string{"key", "contract", "market", "vault", "farm"},
+		},
+		{
+			name:    "without dependencies",
+			modules: registered,
+			enabled: []string{"farm", "key"},
+			want:    []string{"key", "farm"},
+		},
+		{
+			name:    "with transitive dependencies",
+			modules: registered,
+			enabled: []string{"market"},
+			want:    []string{"key", "contract", "market"},
+		},
+		{
+			name:    "shared dependencies once",
+			modules: registered,
+			enabled: []string{"vault", "market", "contract"},
+			want:    []string{"key", "contract", "market", "vault"},
+		},
+		{
+			name:    "unknown repository",
+			modules: registered,
+			enabled: []string{"chart"},
+			err:     "unknown repository chart",
+		},
+		{
+			name:    "unknown dependency",
+			modules: modules([]string{"a", "b"}),
+			enabled: []string{"a"},
+			err:     "repository a requires b, which is not registered",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enabled, err := enabledModules(tt.modules, tt.enabled)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := names(enabled); !slices.Equal(got, tt.want) {
+				t.Errorf("modules = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/coinmeca/db-connector/contractdb"
+	"github.com/coinmeca/go-common/commonlog"
+	"go.uber.org/zap"
+)
+
+// BlockRollbacker is implemented by repositories that tag their records with
+// the hash of the block they come from, like historyDB. RollbackBlocks
+// returns the hashes of the transactions it removed.
+type BlockRollbacker interface {
+	RollbackBlocks(ctx context.Context, chainId string, blockHashes []string) ([]string, error)
+}
+
+// TxRollbacker is implemented by repositories that tag their records with the
+// hash of the transaction they come from, like the history of marketDB,
+// vaultDB and farmDB.
+type TxRollbacker interface {
+	RollbackTxs(ctx context.Context, chainId string, txHashes []string) (int64, error)
+}
+
+// ChartRollbacker is implemented by repositories keeping aggregates, like the
+// charts of marketDB, vaultDB and farmDB, whose writes are journaled.
+// RollbackCharts undoes the writes made at or after since, in unix
+// nanoseconds.
+type ChartRollbacker interface {
+	RollbackCharts(ctx context.Context, chainId string, since int64) (int64, error)
+}
+
+// Rollback removes the records of the blocks orphaned by reorg and moves the
+// checkpoint of the chain back to the common ancestor, so the blocks after it
+// are indexed again. Records tagged with an orphaned block go first, adding
+// their transactions to reorg.TxHashes, then the records tagged with one of
+// those transactions. Aggregates are restored to what they were before the
+// indexer reached the first orphaned block, see reorg.Since; writes made for
+// the chain since then by OnFinalized handlers are undone as well, while
+// writes older than the last Checkpoint.Window revisions of a document cannot
+// be. Records tagged with a transaction only are kept unless its hash is
+// found, either in the history of an orphaned block or through
+// eth_getBlockByHash, which providers may stop serving for orphaned blocks.
+// The checkpoint is only moved once every repository succeeded, so a failed
+// rollback is found and run again.
+func (r *Repositories) Rollback(ctx context.Context, reorg *contractdb.Reorg) error {
+	c, err := Get[contractdb.ContractDBInterface](r)
+	if err != nil {
+		return err
+	}
+
+	r.lock.RLock()
+	order := make([]string, len(r.order))
+	copy(order, r.order)
+	reps := make([]interface{}, len(order))
+	for i, name := range order {
+		reps[i] = r.elems[r.names[name]].Interface()
+	}
+	r.lock.RUnlock()
+
+	blockHashes := reorg.BlockHashes()
+	for i, rep := range reps {
+		if rollbacker, ok := rep.(BlockRollbacker); ok && len(blockHashes) > 0 {
+			hashes, err := rollbacker.RollbackBlocks(ctx, reorg.ChainId, blockHashes)
+			if err != nil {
+				return fmt.Errorf("rollback %s: %w", order[i], err)
+			}
+			reorg.AddTxHashes(hashes...)
+		}
+	}
+
+	for i, rep := range reps {
+		if rollbacker, ok := rep.(TxRollbacker); ok && len(reorg.TxHashes) > 0 {
+			removed, err := rollbacker.RollbackTxs(ctx, reorg.ChainId, reorg.TxHashes)
+			if err != nil {
+				return fmt.Errorf("rollback %s: %w", order[i], err)
+			}
+			commonlog.Logger.Info("Rollback",
+				zap.String("repository", order[i]),
+				zap.String("chainId", reorg.ChainId),
+				zap.Int64("removed", removed),
+			)
+		}
+	}
+
+	since := reorg.Since()
+	for i, rep := range reps {
+		rollbacker, ok := rep.(ChartRollbacker)
+		if !ok {
+			continue
+		}
+		if since == 0 {
+			commonlog.Logger.Warn("Rollback",
+				zap.String("repository", order[i]),
+				zap.String("chainId", reorg.ChainId),
+				zap.String("charts", "kept, the orphaned blocks were indexed without a time"),
+			)
+			continue
+		}
+		undone, err := rollbacker.RollbackCharts(ctx, reorg.ChainId, since)
+		if err != nil {
+			return fmt.Errorf("rollback %s: %w", order[i], err)
+		}
+		commonlog.Logger.Info("Rollback",
+			zap.String("repository", order[i]),
+			zap.String("chainId", reorg.ChainId),
+			zap.Int64("charts", undone),
+		)
+	}
+
+	return c.RewindCheckpoint(&reorg.ChainId, reorg.Ancestor)
+}
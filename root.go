@@ -1,47 +1,94 @@
 package db
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"reflect"
+	"slices"
+	"strings"
 	"sync"
 
-	"github.com/coinmeca/db-connector/accountdb"
-	"github.com/coinmeca/db-connector/batch"
 	"github.com/coinmeca/db-connector/conf"
-	"github.com/coinmeca/db-connector/contractdb"
-	"github.com/coinmeca/db-connector/farmdb"
-	"github.com/coinmeca/db-connector/historydb"
-	"github.com/coinmeca/db-connector/key"
-	"github.com/coinmeca/db-connector/marketdb"
-	"github.com/coinmeca/db-connector/treasurydb"
-	"github.com/coinmeca/db-connector/vaultdb"
 
 	"github.com/coinmeca/go-common/commondatabase"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type RepositoryConstructor func(config *conf.Config, root *Repositories) (commondatabase.IRepository, error)
 
 type Repositories struct {
-	lock  sync.RWMutex
-	conf  *conf.Config
-	elems map[reflect.Type]reflect.Value
+	lock    sync.RWMutex
+	conf    *conf.Config
+	clients *clientRegistry
+	modules []Module
+	extra   []string
+	enabled []string
+	elems   map[reflect.Type]reflect.Value
+	names   map[string]reflect.Type
+	order   []string
 }
 
 type IRepository interface {
 	Start() error
 }
 
-func NewRepositories(c *conf.Config) (*Repositories, error) {
+// Closer is implemented by repositories that hold connections or background
+// workers which have to be released on shutdown.
+type Closer interface {
+	Close(ctx context.Context) error
+}
+
+// Option configures Repositories before the repositories are built.
+type Option func(r *Repositories)
+
+// WithModules adds repositories that are built and started together with the
+// built-in ones, in dependency order. A module named like a built-in one, e.g.
+// "marketDB", replaces it, which lets tests swap in their own implementation.
+// Modules added here are always enabled.
+func WithModules(modules ...Module) Option {
+	return func(r *Repositories) {
+		for _, m := range modules {
+			r.extra = append(r.extra, m.Name)
+			if i := slices.IndexFunc(r.modules, func(e Module) bool { return e.Name == m.Name }); i >= 0 {
+				r.modules[i] = m
+			} else {
+				r.modules = append(r.modules, m)
+			}
+		}
+	}
+}
+
+// WithRepositories enables only the named repositories and the ones they
+// require, overriding Common.Repositories of the config. Repositories that are
+// not enabled need no settings in conf.Repositories.
+func WithRepositories(names ...string) Option {
+	return func(r *Repositories) {
+		r.enabled = names
+	}
+}
+
+func NewRepositories(c *conf.Config, opts ...Option) (*Repositories, error) {
 	r := &Repositories{
-		conf:  c,
-		elems: make(map[reflect.Type]reflect.Value),
+		conf:    c,
+		clients: newClientRegistry(c),
+		modules: slices.Clone(builtinModules),
+		enabled: c.Common.Repositories,
+		elems:   make(map[reflect.Type]reflect.Value),
+		names:   make(map[string]reflect.Type),
+	}
+
+	for _, opt := range opts {
+		opt(r)
 	}
 
 	if err := r.initializeRepositories(); err != nil {
+		r.Close(context.Background())
 		return nil, err
 	}
 
 	if err := r.startAll(); err != nil {
+		r.Close(context.Background())
 		return nil, err
 	}
 
@@ -49,51 +96,103 @@ func NewRepositories(c *conf.Config) (*Repositories, error) {
 }
 
 func (r *Repositories) initializeRepositories() error {
-	key, err := key.NewKeyManager(r.conf)
-	if err != nil {
-		return fmt.Errorf("Key Manager initialization failed: %v", err)
+	enabled := r.enabled
+	if len(enabled) > 0 {
+		enabled = append(slices.Clone(enabled), r.extra...)
 	}
-	r.register(key)
 
-	rep, err := contractdb.NewDB(r.conf, key)
+	modules, err := enabledModules(r.modules, enabled)
 	if err != nil {
 		return err
 	}
-	r.register(rep)
 
-	repoInitializers := []func(*conf.Config) (commondatabase.IRepository, error){
-		batch.NewDB,
-		historydb.NewDB,
-		vaultdb.NewDB,
-		marketdb.NewDB,
-		farmdb.NewDB,
-		treasurydb.NewDB,
-		accountdb.NewDB,
+	if modules, err = sortModules(modules); err != nil {
+		return err
+	}
+
+	if err := r.checkSettings(modules); err != nil {
+		return err
 	}
 
-	for _, initializer := range repoInitializers {
-		rep, err := initializer(r.conf)
+	for _, m := range modules {
+		rep, err := m.Constructor(r.conf, r)
 		if err != nil {
+			return fmt.Errorf("%s initialization failed: %w", m.Name, err)
+		}
+		if err := r.register(m.Name, rep); err != nil {
 			return err
 		}
-		r.register(rep)
 	}
 
 	return nil
 }
 
+// checkSettings reports every missing or malformed conf.Repositories setting of
+// the built-in modules at once, before any client is connected.
+func (r *Repositories) checkSettings(modules []Module) error {
+	var errs []error
+	for _, m := range modules {
+		if !slices.ContainsFunc(builtinModules, func(b Module) bool { return b.Name == m.Name }) || slices.Contains(r.extra, m.Name) {
+			continue
+		}
+		errs = append(errs, checkSetting(r.conf, m.Name))
+	}
+	return errors.Join(errs...)
+}
+
+// Client returns the mongo client for the named entry of conf.Repositories.
+// Entries with the same datasource and credential share one client, so
+// module constructors should use it instead of connecting on their own. The
+// client stays connected until Close.
+func (r *Repositories) Client(name string) (*mongo.Client, error) {
+	client, _, err := r.clients.acquire(name)
+	return client, err
+}
+
 func (r *Repositories) startAll() error {
 	r.lock.Lock()
 	defer r.lock.Unlock()
-	for _, elem := range r.elems {
-		if err := elem.Interface().(commondatabase.IRepository).Start(); err != nil {
-			return err
+	for _, name := range r.order {
+		if err := r.elems[r.names[name]].Interface().(commondatabase.IRepository).Start(); err != nil {
+			return fmt.Errorf("%s start failed: %w", name, err)
 		}
 	}
 	return nil
 }
 
-func (r *Repositories) register(rep commondatabase.IRepository) error {
+// Close shuts the repositories down in reverse start order, so a repository
+// is closed before the ones it depends on, and then disconnects the shared
+// clients still referenced. Built-in repositories release their client on
+// Close, so a client is disconnected once the last of them is closed. The
+// mongo driver waits for in-use connections to be returned, so writes already
+// in flight are drained as long as ctx allows. Every repository is closed even
+// if an earlier one fails, and the errors are joined.
+func (r *Repositories) Close(ctx context.Context) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var errs []error
+	for i := len(r.order) - 1; i >= 0; i-- {
+		name := r.order[i]
+		t := r.names[name]
+		if closer, ok := r.elems[t].Interface().(Closer); ok {
+			if err := closer.Close(ctx); err != nil {
+				errs = append(errs, fmt.Errorf("close %s: %w", name, err))
+			}
+		}
+		delete(r.elems, t)
+		delete(r.names, name)
+	}
+	r.order = nil
+
+	if err := r.clients.disconnectAll(ctx); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+func (r *Repositories) register(name string, rep commondatabase.IRepository) error {
 	r.lock.Lock()
 	defer r.lock.Unlock()
 
@@ -101,55 +200,130 @@ func (r *Repositories) register(rep commondatabase.IRepository) error {
 	if _, exists := r.elems[repoType]; exists {
 		return fmt.Errorf("duplicate repository instance: %v", repoType)
 	}
+	if _, exists := r.names[name]; exists {
+		return fmt.Errorf("duplicate repository name: %s", name)
+	}
 	r.elems[repoType] = reflect.ValueOf(rep)
+	r.names[name] = repoType
+	r.order = append(r.order, name)
 	return nil
 }
 
+// Register builds a repository after NewRepositories has returned. It is
+// registered under its type name and is not started.
 func (r *Repositories) Register(constructor RepositoryConstructor, config *conf.Config) error {
 	if p, err := constructor(config, r); err != nil {
 		return err
 	} else if r != nil {
-		r.lock.Lock()
-		defer r.lock.Unlock()
+		return r.register(reflect.TypeOf(p).String(), p)
+	}
+	return nil
+}
 
-		if _, ok := r.elems[reflect.TypeOf(p)]; ok == true {
-			return fmt.Errorf("duplicated instance of %v", reflect.TypeOf(p))
-		} else {
-			r.elems[reflect.TypeOf(p)] = reflect.ValueOf(p)
+// RegisterModule builds and starts a module after NewRepositories has
+// returned. Every module it requires must already be registered; it is closed
+// before them.
+func (r *Repositories) RegisterModule(m Module) error {
+	r.lock.RLock()
+	for _, name := range m.Requires {
+		if _, ok := r.names[name]; !ok {
+			r.lock.RUnlock()
+			return fmt.Errorf("repository %s requires %s, which is not registered", m.Name, name)
 		}
 	}
+	r.lock.RUnlock()
+
+	rep, err := m.Constructor(r.conf, r)
+	if err != nil {
+		return fmt.Errorf("%s initialization failed: %w", m.Name, err)
+	}
+	if err := r.register(m.Name, rep); err != nil {
+		return err
+	}
+	if err := rep.Start(); err != nil {
+		return fmt.Errorf("%s start failed: %w", m.Name, err)
+	}
 	return nil
 }
 
+// Get fills each pointer in rs with the repository of the pointed-to concrete
+// type, e.g. Get(&market) with market of type *marketdb.MarketDB. Prefer the
+// generic Get, which also resolves interfaces.
 func (r *Repositories) Get(rs ...interface{}) error {
 	r.lock.RLock()
 	defer r.lock.RUnlock()
 
-	notFounds := make([]reflect.Type, 0)
+	notFounds := make([]string, 0)
 	for _, v := range rs {
 		elem := reflect.ValueOf(v).Elem()
 		if e, ok := r.elems[elem.Type()]; ok == true {
 			elem.Set(e)
 		} else {
-			notFounds = append(notFounds, elem.Type())
+			notFounds = append(notFounds, elem.Type().String())
 		}
 	}
 
 	if len(notFounds) > 0 {
-		err := fmt.Errorf("unknown repository ")
-		for _, e := range notFounds {
-			err = fmt.Errorf("%v, %v ", err.Error(), e)
-		}
-		return err
+		return fmt.Errorf("%w: %s (registered: %s)", ErrRepositoryNotFound, strings.Join(notFounds, ", "), strings.Join(r.order, ", "))
 	}
 
 	return nil
 }
 
+var (
+	ErrRepositoryNotFound  = errors.New("repository not found")
+	ErrRepositoryAmbiguous = errors.New("repository is ambiguous")
+)
+
+// Get returns the repository assignable to T. T is usually one of the
+// repository interfaces such as marketdb.MarketDBInterface, so callers do not
+// depend on the concrete type and tests can swap the implementation through
+// WithModules. A concrete pointer type works as well.
+func Get[T any](r *Repositories) (T, error) {
+	var zero T
+	target := reflect.TypeOf((*T)(nil)).Elem()
+
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	if e, ok := r.elems[target]; ok {
+		return e.Interface().(T), nil
+	}
+
+	var found T
+	matches := make([]string, 0)
+	for _, name := range r.order {
+		if rep, ok := r.elems[r.names[name]].Interface().(T); ok {
+			found = rep
+			matches = append(matches, name)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return zero, fmt.Errorf("%w: no repository implements %v (registered: %s)", ErrRepositoryNotFound, target, strings.Join(r.order, ", "))
+	case 1:
+		return found, nil
+	default:
+		return zero, fmt.Errorf("%w: %v is implemented by %s", ErrRepositoryAmbiguous, target, strings.Join(matches, ", "))
+	}
+}
+
+// MustGet is like Get but panics if the repository cannot be resolved.
+func MustGet[T any](r *Repositories) T {
+	rep, err := Get[T](r)
+	if err != nil {
+		panic(err)
+	}
+	return rep
+}
+
 func NewRepositoriesBackup(c *conf.Config) (*Repositories, error) {
 	r := &Repositories{
-		conf:  c,
-		elems: make(map[reflect.Type]reflect.Value),
+		conf:    c,
+		clients: newClientRegistry(c),
+		elems:   make(map[reflect.Type]reflect.Value),
+		names:   make(map[string]reflect.Type),
 	}
 
 	for _, c := range []struct {
@@ -1,9 +1,9 @@
 ﻿package treasurydb
 
 import (
-	"context"
 	"time"
 
+	"github.com/coinmeca/db-connector/conf"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 
@@ -18,8 +18,10 @@ func (t *TreasuryDB) SaveTreasuryChart(chart *treasury.Chart) error {
 	filter, update := t.BsonForChart(chart)
 	option := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
 
-	err := t.ColChart.FindOneAndUpdate(
-		context.Background(),
+	col, ctx, cancel := t.collection(t.ColChart, conf.OpChartWrite)
+	defer cancel()
+	err := col.FindOneAndUpdate(
+		ctx,
 		filter,
 		update,
 		option,
@@ -38,14 +40,16 @@ func (t *TreasuryDB) GetTreasuryChart(chainId *string) []*treasury.Chart {
 	}
 
 	var chart []*treasury.Chart
-	cursor, err := t.ColChart.Find(context.Background(), filter)
+	col, ctx, cancel := t.collection(t.ColChart, conf.OpChartRead)
+	defer cancel()
+	cursor, err := col.Find(ctx, filter)
 
 	if err != nil {
 		return nil
 	}
-	defer cursor.Close(context.Background())
+	defer cursor.Close(ctx)
 
-	for cursor.Next(context.Background()) {
+	for cursor.Next(ctx) {
 		var c *treasury.Chart
 		if err := cursor.Decode(&chart); err == nil {
 			chart = append(chart, c)
@@ -63,7 +67,9 @@ func (t *TreasuryDB) GetTreasuryChartLast(chainId *string) (*treasury.Last, erro
 		"time":    now,
 	}
 	var chart *treasury.Chart
-	err := t.ColChart.FindOne(context.Background(), filter).Decode(&chart)
+	col, ctx, cancel := t.collection(t.ColChart, conf.OpChartRead)
+	defer cancel()
+	err := col.FindOne(ctx, filter).Decode(&chart)
 	if err != nil {
 		commonlog.Logger.Error("SaveTreasuryChart",
 			zap.String("Failed to update chart", err.Error()),
@@ -85,7 +91,9 @@ func (t *TreasuryDB) GetLatestTVValue(chainId string) (primitive.Decimal128, err
 	}
 	filter := bson.M{"chainId": chainId}
 	opts := options.FindOne().SetSort(bson.D{{"time", -1}})
-	err := t.ColChart.FindOne(context.Background(), filter, opts).Decode(&result)
+	col, ctx, cancel := t.collection(t.ColChart, conf.OpChartRead)
+	defer cancel()
+	err := col.FindOne(ctx, filter, opts).Decode(&result)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return primitive.NewDecimal128(0, 0), nil
@@ -1,9 +1,9 @@
 ﻿package treasurydb
 
 import (
-	"context"
 	"fmt"
 
+	"github.com/coinmeca/db-connector/conf"
 	"github.com/coinmeca/go-common/commonlog"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -13,7 +13,9 @@ import (
 )
 
 func (t *TreasuryDB) BulkWriteTokens(models *[]mongo.WriteModel) error {
-	result, err := t.ColToken.BulkWrite(context.Background(), *models)
+	col, ctx, cancel := t.collection(t.ColToken, conf.OpInfoWrite)
+	defer cancel()
+	result, err := col.BulkWrite(ctx, *models)
 	if err != nil {
 		commonlog.Logger.Error("TreasuryDB",
 			zap.String("BulkWriteTokens", err.Error()),
@@ -28,7 +30,9 @@ func (t *TreasuryDB) SetValue(symbol, name string, value *primitive.Decimal128)
 	filter, update := t.BsonForSetValue(symbol, name, value)
 	opts := options.Update().SetUpsert(false)
 
-	_, err := t.ColToken.UpdateOne(context.Background(), filter, update, opts)
+	col, ctx, cancel := t.collection(t.ColToken, conf.OpInfoWrite)
+	defer cancel()
+	_, err := col.UpdateOne(ctx, filter, update, opts)
 	if err != nil {
 		return err
 	}
@@ -43,7 +47,9 @@ func (t *TreasuryDB) GetValue(symbol, name *string) (*primitive.Decimal128, erro
 	}
 
 	value := &primitive.Decimal128{}
-	err := t.ColToken.FindOne(context.Background(), filter).Decode(&value)
+	col, ctx, cancel := t.collection(t.ColToken, conf.OpInfoRead)
+	defer cancel()
+	err := col.FindOne(ctx, filter).Decode(&value)
 	if err != nil {
 		return nil, err
 	}
@@ -52,15 +58,17 @@ func (t *TreasuryDB) GetValue(symbol, name *string) (*primitive.Decimal128, erro
 }
 
 func (t *TreasuryDB) GetValues() (*map[string]primitive.Decimal128, error) {
-	cursor, err := t.ColToken.Find(context.Background(), bson.M{})
+	col, ctx, cancel := t.collection(t.ColToken, conf.OpInfoRead)
+	defer cancel()
+	cursor, err := col.Find(ctx, bson.M{})
 	if err != nil {
 		return nil, err
 	}
-	defer cursor.Close(context.Background())
+	defer cursor.Close(ctx)
 
 	valueMap := make(map[string]primitive.Decimal128)
 
-	for cursor.Next(context.Background()) {
+	for cursor.Next(ctx) {
 		var token bson.M
 		if err := cursor.Decode(&token); err != nil {
 			continue
@@ -86,15 +94,17 @@ func (t *TreasuryDB) GetTokens() ([]*bson.M, error) {
 		}}},
 	}
 
-	cursor, err := t.ColToken.Aggregate(context.Background(), pipeline)
+	col, ctx, cancel := t.collection(t.ColToken, conf.OpAggregate)
+	defer cancel()
+	cursor, err := col.Aggregate(ctx, pipeline)
 	if err != nil {
 		commonlog.Logger.Error("TreasuryDB",
 			zap.String("GetTokens ", err.Error()),
 		)
 	}
-	defer cursor.Close(context.Background())
+	defer cursor.Close(ctx)
 
-	for cursor.Next(context.Background()) {
+	for cursor.Next(ctx) {
 		var model *bson.M
 		if err := cursor.Decode(&model); err != nil {
 			commonlog.Logger.Error("TreasuryDB",
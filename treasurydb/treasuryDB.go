@@ -19,6 +19,7 @@ type TreasuryDB struct {
 	config *conf.Config
 
 	client      *mongo.Client
+	release     func(ctx context.Context) error
 	ColTreasury *mongo.Collection
 	ColChart    *mongo.Collection
 	ColToken    *mongo.Collection
@@ -41,7 +42,7 @@ type TreasuryDBInterface interface {
 	GetLatestChart(chainId string) (*treasury.Chart, error)
 	GetLatestTVValue(chainId string) (primitive.Decimal128, error)
 	GetTokens() ([]*bson.M, error)
-	GetTreasuryChart(chainId *string) ([]*treasury.Chart, error)
+	GetTreasuryChart(chainId *string) []*treasury.Chart
 	GetTreasuryChartLast(chainId *string) (*treasury.Last, error)
 	GetValue(symbol *string, name *string) (*primitive.Decimal128, error)
 	GetValues() (*map[string]primitive.Decimal128, error)
@@ -53,37 +54,44 @@ type TreasuryDBInterface interface {
 
 	// update
 	UpdateTradingVolume(chainId string, volume *primitive.Decimal128) error
-	UpsertDailyChart(chart *treasury.Chart) error
 
 	Start() error
+	Close(ctx context.Context) error
 }
 
-func NewDB(config *conf.Config) (commondatabase.IRepository, error) {
-	r := &TreasuryDB{
-		config: config,
-		start:  make(chan struct{}),
-	}
+var _ TreasuryDBInterface = (*TreasuryDB)(nil)
 
-	var err error
-	credential := options.Credential{
-		Username: r.config.Repositories["treasuryDB"]["username"].(string),
-		Password: r.config.Repositories["treasuryDB"]["pass"].(string),
+// NewDB connects a client of its own for [Repositories.treasuryDB], which Close
+// disconnects.
+func NewDB(config *conf.Config) (commondatabase.IRepository, error) {
+	client, err := config.Connect(context.Background(), "treasuryDB")
+	if err != nil {
+		return nil, err
 	}
 
-	clientOptions := options.Client().ApplyURI(config.Repositories["treasuryDB"]["datasource"].(string)).SetAuth(credential)
-	if r.client, err = mongo.Connect(context.Background(), clientOptions); err != nil {
+	r, err := NewDBWithClient(config, client, client.Disconnect)
+	if err != nil {
+		client.Disconnect(context.Background())
 		return nil, err
 	}
+	return r, nil
+}
 
-	if err = r.client.Ping(context.Background(), nil); err == nil {
-		db := r.client.Database(config.Repositories["treasuryDB"]["db"].(string))
-		r.ColTreasury = db.Collection("treasury")
-		r.ColToken = db.Collection("token")
-		r.ColChart = db.Collection("chart")
-	} else {
-		return nil, err
+// NewDBWithClient builds the repository on a client shared with other
+// repositories. Close calls release instead of disconnecting the client.
+func NewDBWithClient(config *conf.Config, client *mongo.Client, release func(ctx context.Context) error) (commondatabase.IRepository, error) {
+	r := &TreasuryDB{
+		config:  config,
+		client:  client,
+		release: release,
+		start:   make(chan struct{}),
 	}
 
+	db := r.client.Database(config.Repositories["treasuryDB"].DB, config.Repositories["treasuryDB"].DatabaseOptions())
+	r.ColTreasury = db.Collection("treasury")
+	r.ColToken = db.Collection("token")
+	r.ColChart = db.Collection("chart")
+
 	if err := tokenIndex(r.ColToken); err != nil {
 		return nil, err
 	}
@@ -110,6 +118,17 @@ func (t *TreasuryDB) Start() error {
 	}()
 }
 
+// Close releases the client of the repository.
+func (t *TreasuryDB) Close(ctx context.Context) error {
+	return t.release(ctx)
+}
+
+// collection returns col tuned for an operation class of
+// [Repositories.treasuryDB.operations] and the context to run the operation with.
+func (t *TreasuryDB) collection(col *mongo.Collection, class string) (*mongo.Collection, context.Context, context.CancelFunc) {
+	return t.config.Repositories["treasuryDB"].Collection(col, class)
+}
+
 func tokenIndex(col *mongo.Collection) error {
 	index := mongo.IndexModel{
 		Keys: bson.D{
@@ -142,7 +161,9 @@ func (t *TreasuryDB) GetLatestChart(chainId string) (*treasury.Chart, error) {
 	filter := bson.M{"chainId": chainId}
 	opts := options.FindOne().SetSort(bson.D{{"time", -1}})
 
-	err := t.ColChart.FindOne(context.Background(), filter, opts).Decode(&latestChart)
+	col, ctx, cancel := t.collection(t.ColChart, conf.OpChartRead)
+	defer cancel()
+	err := col.FindOne(ctx, filter, opts).Decode(&latestChart)
 	if err != nil {
 		return nil, err
 	}
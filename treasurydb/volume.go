@@ -1,9 +1,9 @@
 ﻿package treasurydb
 
 import (
-	"context"
 	"time"
 
+	"github.com/coinmeca/db-connector/conf"
 	"github.com/coinmeca/go-common/commonlog"
 	"github.com/coinmeca/go-common/commonmethod/treasury"
 	"go.mongodb.org/mongo-driver/bson"
@@ -16,7 +16,9 @@ func (t *TreasuryDB) SaveTradingVolume(chart *treasury.Chart) error {
 	filter, update := t.BsonForTradingVolume(chart)
 	option := options.Update().SetUpsert(true)
 
-	_, err := t.ColChart.UpdateOne(context.Background(), filter, update, option)
+	col, ctx, cancel := t.collection(t.ColChart, conf.OpChartWrite)
+	defer cancel()
+	_, err := col.UpdateOne(ctx, filter, update, option)
 	if err != nil {
 		commonlog.Logger.Error("Treasury SaveTradingVolume",
 			zap.String("Failed to update chart", err.Error()),
@@ -42,7 +44,9 @@ func (c *TreasuryDB) UpdateTradingVolume(chainId string, volume *primitive.Decim
 	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
 
 	var updatedDoc treasury.Chart
-	err := c.ColChart.FindOneAndUpdate(context.Background(), filter, update, opts).Decode(&updatedDoc)
+	col, ctx, cancel := c.collection(c.ColChart, conf.OpChartWrite)
+	defer cancel()
+	err := col.FindOneAndUpdate(ctx, filter, update, opts).Decode(&updatedDoc)
 	if err != nil {
 		commonlog.Logger.Error("UpdateTradingVolume", zap.String("Failed to update tv value", err.Error()))
 		return err
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/coinmeca/db-connector/conf"
+	"github.com/coinmeca/db-connector/journal"
 	"github.com/coinmeca/go-common/commonlog"
 	"github.com/coinmeca/go-common/commonmethod/vault"
 	"github.com/mitchellh/mapstructure"
@@ -16,7 +18,9 @@ import (
 )
 
 func (v *VaultDB) BulkWriteChart(models []mongo.WriteModel) error {
-	result, err := v.ColChart.BulkWrite(context.Background(), models)
+	col, ctx, cancel := v.collection(v.ColChart, conf.OpChartWrite)
+	defer cancel()
+	result, err := col.BulkWrite(ctx, models)
 	if err != nil {
 		commonlog.Logger.Error("VaultDB",
 			zap.String("BulkWriteChart", err.Error()),
@@ -28,7 +32,9 @@ func (v *VaultDB) BulkWriteChart(models []mongo.WriteModel) error {
 }
 
 func (v *VaultDB) BulkWriteChartSub(models []mongo.WriteModel) error {
-	result, err := v.ColChartSub.BulkWrite(context.Background(), models)
+	col, ctx, cancel := v.collection(v.ColChartSub, conf.OpChartWrite)
+	defer cancel()
+	result, err := col.BulkWrite(ctx, models)
 	if err != nil {
 		commonlog.Logger.Error("VaultDB",
 			zap.String("BulkWriteChartSub", err.Error()),
@@ -46,7 +52,14 @@ func (v *VaultDB) SaveChartFromModel(models *[]mongo.WriteModel, exchange *primi
 	}
 
 	filter, update := v.BsonForChart(t, &interval)
-	*models = append(*models, mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update).SetUpsert(true))
+	pipeline, err := v.chartUpdate(t.ChainId, update)
+	if err != nil {
+		commonlog.Logger.Error("Vault SaveChartFromModel",
+			zap.String("error", err.Error()),
+		)
+		return
+	}
+	*models = append(*models, mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(pipeline).SetUpsert(true))
 }
 
 func (v *VaultDB) SaveChart(t *vault.Chart, interval int64) error {
@@ -56,11 +69,17 @@ func (v *VaultDB) SaveChart(t *vault.Chart, interval int64) error {
 	}
 
 	filter, update := v.BsonForChart(t, &interval)
+	pipeline, err := v.chartUpdate(t.ChainId, update)
+	if err != nil {
+		return err
+	}
 	option := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
-	err := v.ColChart.FindOneAndUpdate(
-		context.Background(),
+	col, ctx, cancel := v.collection(v.ColChart, conf.OpChartWrite)
+	defer cancel()
+	err = col.FindOneAndUpdate(
+		ctx,
 		filter,
-		update,
+		pipeline,
 		option,
 	).Decode(t)
 
@@ -78,13 +97,19 @@ func (v *VaultDB) SaveChartByIntervals(chart *vault.Chart) error {
 
 	var models []mongo.WriteModel
 	for _, update := range updates {
+		pipeline, err := v.chartUpdate(chart.ChainId, update["update"])
+		if err != nil {
+			return err
+		}
 		models = append(models, mongo.NewUpdateOneModel().
 			SetFilter(update["filter"]).
-			SetUpdate(update["update"]).
+			SetUpdate(pipeline).
 			SetUpsert(true))
 	}
 
-	_, err := v.ColChart.BulkWrite(context.Background(), models)
+	col, ctx, cancel := v.collection(v.ColChart, conf.OpChartWrite)
+	defer cancel()
+	_, err := col.BulkWrite(ctx, models)
 	if err != nil {
 		commonlog.Logger.Error("Vault SaveChartByIntervals bulk write failed",
 			zap.String("error", err.Error()),
@@ -104,8 +129,10 @@ func (v *VaultDB) SaveChartSub(t *vault.ChartSub) error {
 	filter, update := v.BsonForChartSub(t)
 	option := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
 
-	err := v.ColChartSub.FindOneAndUpdate(
-		context.Background(),
+	col, ctx, cancel := v.collection(v.ColChartSub, conf.OpChartWrite)
+	defer cancel()
+	err := col.FindOneAndUpdate(
+		ctx,
 		filter,
 		update,
 		option,
@@ -126,12 +153,18 @@ func (v *VaultDB) SaveChartVolume(chart *vault.Chart, interval int64) error {
 	}
 
 	filter, update := v.BsonForChart(chart, &interval)
+	pipeline, err := v.chartUpdate(chart.ChainId, update)
+	if err != nil {
+		return err
+	}
 	option := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
 
-	err := v.ColChart.FindOneAndUpdate(
-		context.Background(),
+	col, ctx, cancel := v.collection(v.ColChart, conf.OpChartWrite)
+	defer cancel()
+	err = col.FindOneAndUpdate(
+		ctx,
 		filter,
-		update,
+		pipeline,
 		option,
 	).Decode(chart)
 	if err != nil {
@@ -147,13 +180,19 @@ func (v *VaultDB) SaveChartVolumesByIntervals(chart *vault.Chart) error {
 
 	var models []mongo.WriteModel
 	for _, update := range updates {
+		pipeline, err := v.chartUpdate(chart.ChainId, update["update"])
+		if err != nil {
+			return err
+		}
 		models = append(models, mongo.NewUpdateOneModel().
 			SetFilter(update["filter"]).
-			SetUpdate(update["update"]).
+			SetUpdate(pipeline).
 			SetUpsert(true))
 	}
 
-	_, err := v.ColChart.BulkWrite(context.Background(), models)
+	col, ctx, cancel := v.collection(v.ColChart, conf.OpChartWrite)
+	defer cancel()
+	_, err := col.BulkWrite(ctx, models)
 	if err != nil {
 		commonlog.Logger.Error("Vault SaveChartByIntervals bulk write failed",
 			zap.String("error", err.Error()),
@@ -172,14 +211,16 @@ func (v *VaultDB) GetChart(chainId, address *string, interval *int64) []*vault.C
 	}
 
 	var chart []*vault.Chart
-	cursor, err := v.ColChartSub.Find(context.Background(), filter)
+	col, ctx, cancel := v.collection(v.ColChartSub, conf.OpChartRead)
+	defer cancel()
+	cursor, err := col.Find(ctx, filter)
 
 	if err != nil {
 		return chart
 	}
-	defer cursor.Close(context.Background())
+	defer cursor.Close(ctx)
 
-	for cursor.Next(context.Background()) {
+	for cursor.Next(ctx) {
 		var c *vault.Chart
 		if err := cursor.Decode(&chart); err == nil {
 			chart = append(chart, c)
@@ -198,8 +239,10 @@ func (v *VaultDB) GetChartLast(chainId, address *string, interval *int64) *vault
 		"interval": interval,
 	}
 
-	err := v.ColChart.FindOne(
-		context.Background(),
+	col, ctx, cancel := v.collection(v.ColChart, conf.OpChartRead)
+	defer cancel()
+	err := col.FindOne(
+		ctx,
 		filter,
 		options.FindOne().SetSort(bson.D{{"time", -1}}),
 	).Decode(chart)
@@ -217,14 +260,16 @@ func (v *VaultDB) GetChartSub(chainId, address *string) ([]*vault.ChartSub, erro
 	}
 
 	var chart []*vault.ChartSub
-	cursor, err := v.ColChartSub.Find(context.Background(), filter)
+	col, ctx, cancel := v.collection(v.ColChartSub, conf.OpChartRead)
+	defer cancel()
+	cursor, err := col.Find(ctx, filter)
 
 	if err != nil {
 		return chart, err
 	}
-	defer cursor.Close(context.Background())
+	defer cursor.Close(ctx)
 
-	for cursor.Next(context.Background()) {
+	for cursor.Next(ctx) {
 		var c *vault.ChartSub
 		if err := cursor.Decode(&chart); err == nil {
 			chart = append(chart, c)
@@ -240,8 +285,10 @@ func (v *VaultDB) GetChartSubLast(chainId, address *string) (chartSub *vault.Cha
 		"address": strings.ToLower(*address),
 	}
 
-	err := v.ColChartSub.FindOne(
-		context.Background(),
+	col, ctx, cancel := v.collection(v.ColChartSub, conf.OpChartRead)
+	defer cancel()
+	err := col.FindOne(
+		ctx,
 		filter,
 		options.FindOne().SetSort(bson.D{{"time", -1}}),
 	).Decode(chartSub)
@@ -253,8 +300,10 @@ func (v *VaultDB) GetChartSubLast(chainId, address *string) (chartSub *vault.Cha
 }
 
 func (v *VaultDB) GetChartSubAtTime(chainId, address *string, time *int64) (chartSub *vault.ChartSub) {
-	cursor, err := v.ColChartSub.Aggregate(
-		context.Background(),
+	col, ctx, cancel := v.collection(v.ColChartSub, conf.OpAggregate)
+	defer cancel()
+	cursor, err := col.Aggregate(
+		ctx,
 		v.BsonForChartSubAtTime(time, *chainId, *address),
 	)
 	if err != nil {
@@ -263,9 +312,9 @@ func (v *VaultDB) GetChartSubAtTime(chainId, address *string, time *int64) (char
 		)
 		return nil
 	}
-	defer cursor.Close(context.Background())
+	defer cursor.Close(ctx)
 
-	if cursor.Next(context.Background()) {
+	if cursor.Next(ctx) {
 		err = cursor.Decode(&chartSub)
 		if err != nil {
 			commonlog.Logger.Error("Vault",
@@ -278,8 +327,10 @@ func (v *VaultDB) GetChartSubAtTime(chainId, address *string, time *int64) (char
 }
 
 func (v *VaultDB) GetChartSubsAtTime(time *int64, chainId *string, addresses []string) map[string]*vault.ChartSub {
-	cursor, err := v.ColChartSub.Aggregate(
-		context.Background(),
+	col, ctx, cancel := v.collection(v.ColChartSub, conf.OpAggregate)
+	defer cancel()
+	cursor, err := col.Aggregate(
+		ctx,
 		v.BsonForChartSubsAtTime(time, *chainId, addresses),
 	)
 
@@ -289,11 +340,11 @@ func (v *VaultDB) GetChartSubsAtTime(time *int64, chainId *string, addresses []s
 			zap.String("Cursor Error", err.Error()),
 		)
 	}
-	defer cursor.Close(context.Background())
+	defer cursor.Close(ctx)
 
 	result := make(map[string]*vault.ChartSub)
 
-	for cursor.Next(context.Background()) {
+	for cursor.Next(ctx) {
 		var docs bson.M
 		if err := cursor.Decode(&docs); err != nil {
 			commonlog.Logger.Error(
@@ -332,3 +383,29 @@ func (v *VaultDB) GetChartSubsAtTime(time *int64, chainId *string, addresses []s
 
 	return result
 }
+
+// RollbackCharts undoes the writes made to the charts of chainId at or after
+// since, in unix nanoseconds, for blocks orphaned by a reorganization.
+func (v *VaultDB) RollbackCharts(ctx context.Context, chainId string, since int64) (int64, error) {
+	col, opCtx, cancel := v.collection(v.ColChart, conf.OpChartWrite)
+	defer cancel()
+	defer context.AfterFunc(ctx, cancel)()
+	undone, err := journal.Rollback(opCtx, col, bson.M{"chainId": chainId}, since)
+	if err != nil {
+		commonlog.Logger.Error("RollbackCharts",
+			zap.String("chainId", chainId),
+			zap.String("error", err.Error()),
+		)
+	}
+	return undone, err
+}
+
+// chartUpdate turns update into a pipeline keeping the revision of the bucket,
+// so RollbackCharts can undo it.
+func (v *VaultDB) chartUpdate(chainId string, update interface{}) (mongo.Pipeline, error) {
+	doc, ok := update.(bson.M)
+	if !ok {
+		return nil, fmt.Errorf("chart update must be a document, got %T", update)
+	}
+	return journal.Update(doc, "close", journal.Stamp(chainId), v.config.Checkpoint.WindowSize())
+}
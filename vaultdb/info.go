@@ -1,10 +1,10 @@
 ﻿package vaultdb
 
 import (
-	"context"
 	"fmt"
 	"strings"
 
+	"github.com/coinmeca/db-connector/conf"
 	"github.com/coinmeca/go-common/commonlog"
 	"github.com/coinmeca/go-common/commonmethod/vault"
 	"go.mongodb.org/mongo-driver/bson"
@@ -14,7 +14,9 @@ import (
 )
 
 func (v *VaultDB) BulkWriteInfo(models []mongo.WriteModel) error {
-	result, err := v.ColVault.BulkWrite(context.Background(), models)
+	col, ctx, cancel := v.collection(v.ColVault, conf.OpInfoWrite)
+	defer cancel()
+	result, err := col.BulkWrite(ctx, models)
 	if err != nil {
 		commonlog.Logger.Error("VaultDB",
 			zap.String("BulkWriteInfo", err.Error()),
@@ -36,8 +38,10 @@ func (v *VaultDB) SaveVaultInfo(info *vault.Vault) error {
 	filter, update := v.BsonForInfo(info)
 	option := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
 
-	err := v.ColVault.FindOneAndUpdate(
-		context.Background(),
+	col, ctx, cancel := v.collection(v.ColVault, conf.OpInfoWrite)
+	defer cancel()
+	err := col.FindOneAndUpdate(
+		ctx,
 		filter,
 		update,
 		option,
@@ -55,8 +59,10 @@ func (v *VaultDB) SaveVaultInfoWithWeight(recent *vault.Recent, info *vault.Vaul
 	filter, update := v.BsonForVaultWeight(recent)
 	option := options.FindOneAndUpdate().SetUpsert(true)
 
-	err := v.ColVault.FindOneAndUpdate(
-		context.Background(),
+	col, ctx, cancel := v.collection(v.ColVault, conf.OpInfoWrite)
+	defer cancel()
+	err := col.FindOneAndUpdate(
+		ctx,
 		filter,
 		update,
 		option,
@@ -74,7 +80,9 @@ func (v *VaultDB) SaveVaultInfoWithWeight(recent *vault.Recent, info *vault.Vaul
 func (v *VaultDB) GetVault(chainId, address *string) (*vault.Vault, error) {
 	var vault vault.Vault
 	filter := bson.M{"chainId": chainId, "address": strings.ToLower(*address)}
-	if err := v.ColVault.FindOne(context.Background(), filter, nil).Decode(&vault); err != nil {
+	col, ctx, cancel := v.collection(v.ColVault, conf.OpInfoRead)
+	defer cancel()
+	if err := col.FindOne(ctx, filter, nil).Decode(&vault); err != nil {
 		commonlog.Logger.Error("GetVaults",
 			zap.String("not found ", err.Error()),
 		)
@@ -86,7 +94,9 @@ func (v *VaultDB) GetVault(chainId, address *string) (*vault.Vault, error) {
 func (v *VaultDB) GetVaults(chainId *string) ([]*vault.Vault, error) {
 	var vaults []*vault.Vault
 	filter := bson.M{"chainId": chainId}
-	cursor, err := v.ColVault.Find(context.Background(), filter)
+	col, ctx, cancel := v.collection(v.ColVault, conf.OpInfoRead)
+	defer cancel()
+	cursor, err := col.Find(ctx, filter)
 
 	if err != nil {
 		commonlog.Logger.Error("GetVaults",
@@ -94,9 +104,9 @@ func (v *VaultDB) GetVaults(chainId *string) ([]*vault.Vault, error) {
 		)
 		return vaults, err
 	}
-	defer cursor.Close(context.Background())
+	defer cursor.Close(ctx)
 
-	for cursor.Next(context.Background()) {
+	for cursor.Next(ctx) {
 		var v *vault.Vault
 		if err := cursor.Decode(&v); err == nil {
 			vaults = append(vaults, v)
@@ -108,14 +118,16 @@ func (v *VaultDB) GetVaults(chainId *string) ([]*vault.Vault, error) {
 
 func (v *VaultDB) GetAllVaults() ([]*vault.Vault, error) {
 	var vaults []*vault.Vault
-	cursor, err := v.ColVault.Find(context.Background(), bson.M{})
+	col, ctx, cancel := v.collection(v.ColVault, conf.OpInfoRead)
+	defer cancel()
+	cursor, err := col.Find(ctx, bson.M{})
 
 	if err != nil {
 		return vaults, err
 	}
-	defer cursor.Close(context.Background())
+	defer cursor.Close(ctx)
 
-	for cursor.Next(context.Background()) {
+	for cursor.Next(ctx) {
 		var v *vault.Vault
 		if err := cursor.Decode(&v); err == nil {
 			vaults = append(vaults, v)
@@ -128,15 +140,17 @@ func (v *VaultDB) GetAllVaults() ([]*vault.Vault, error) {
 func (v *VaultDB) GetKeyTokens(chainId *string) ([]*vault.Vault, error) {
 	var keys []*vault.Vault
 	filter := bson.M{"chainId": chainId, "key": true}
-	cursor, err := v.ColVault.Find(context.Background(), filter)
+	col, ctx, cancel := v.collection(v.ColVault, conf.OpInfoRead)
+	defer cancel()
+	cursor, err := col.Find(ctx, filter)
 	if err != nil {
 		commonlog.Logger.Error("GetKeyTokens",
 			zap.String("GetKeyTokens ", err.Error()),
 		)
 	}
-	defer cursor.Close(context.Background())
+	defer cursor.Close(ctx)
 
-	for cursor.Next(context.Background()) {
+	for cursor.Next(ctx) {
 		var v *vault.Vault
 		if err := cursor.Decode(&keys); err != nil {
 			commonlog.Logger.Error("GetKeyTokens",
@@ -162,15 +176,17 @@ func (v *VaultDB) GetAllKeyTokenSymbols() ([]*vault.Vault, error) {
 		}}},
 	}
 
-	cursor, err := v.ColVault.Aggregate(context.Background(), pipeline)
+	col, ctx, cancel := v.collection(v.ColVault, conf.OpAggregate)
+	defer cancel()
+	cursor, err := col.Aggregate(ctx, pipeline)
 	if err != nil {
 		commonlog.Logger.Error("GetAllKeyTokenSymbols",
 			zap.String("GetAllKeyTokenSymbols ", err.Error()),
 		)
 	}
-	defer cursor.Close(context.Background())
+	defer cursor.Close(ctx)
 
-	for cursor.Next(context.Background()) {
+	for cursor.Next(ctx) {
 		var model *vault.Vault
 		if err := cursor.Decode(&model); err != nil {
 			commonlog.Logger.Error("GetAllKeyTokenSymbols",
@@ -190,16 +206,18 @@ func (v *VaultDB) GetKeyTokenSymbols(chainId *string) ([]*vault.Vault, error) {
 		{{"$group", bson.D{{"symbol", "$symbol"}, {"address", "$address"}}}},
 	}
 
-	cursor, err := v.ColVault.Aggregate(context.Background(), pipeline)
+	col, ctx, cancel := v.collection(v.ColVault, conf.OpAggregate)
+	defer cancel()
+	cursor, err := col.Aggregate(ctx, pipeline)
 	if err != nil {
 		commonlog.Logger.Error("GetKeyTokenSymbols",
 			zap.String("GetKeyTokenSymbols ", err.Error()),
 		)
 		return nil, err
 	}
-	defer cursor.Close(context.Background())
+	defer cursor.Close(ctx)
 
-	for cursor.Next(context.Background()) {
+	for cursor.Next(ctx) {
 		var model *vault.Vault
 		if err := cursor.Decode(&model); err != nil {
 			commonlog.Logger.Error("GetKeyTokenSymbols",
@@ -248,14 +266,16 @@ func (v *VaultDB) GetNonKeyTokenSymbols(chainId *string) ([]*vault.Vault, error)
 		{{"$group", bson.D{{"symbol", "$symbol"}, {"address", "$address"}}}},
 	}
 
-	cursor, err := v.ColVault.Aggregate(context.Background(), pipeline)
+	col, ctx, cancel := v.collection(v.ColVault, conf.OpAggregate)
+	defer cancel()
+	cursor, err := col.Aggregate(ctx, pipeline)
 	if err != nil {
 		return nil, err
 	}
-	defer cursor.Close(context.Background())
+	defer cursor.Close(ctx)
 
 	var results []bson.M
-	if err = cursor.All(context.Background(), &results); err != nil {
+	if err = cursor.All(ctx, &results); err != nil {
 		fmt.Println(err)
 		return nil, err
 	}
@@ -1,10 +1,10 @@
 ﻿package vaultdb
 
 import (
-	"context"
 	"strings"
 	"time"
 
+	"github.com/coinmeca/db-connector/conf"
 	"github.com/coinmeca/go-common/commonutils"
 
 	"github.com/coinmeca/go-common/commonlog"
@@ -19,9 +19,10 @@ import (
 func (v *VaultDB) GetLastAll(nowTime *int64, last *vault.Last) error {
 	ago24h := *nowTime - 86400
 
-	ctx := context.Background()
 	executePipeline := func(pipeline mongo.Pipeline) (bson.M, error) {
-		cursor, err := v.ColHistory.Aggregate(ctx, pipeline)
+		col, ctx, cancel := v.collection(v.ColHistory, conf.OpAggregate)
+		defer cancel()
+		cursor, err := col.Aggregate(ctx, pipeline)
 		if err != nil {
 			return nil, err
 		}
@@ -190,7 +191,9 @@ func (v *VaultDB) GetLastAll(nowTime *int64, last *vault.Last) error {
 		}},
 	}
 
-	cursor, err := v.ColChartSub.Aggregate(ctx, pipeline)
+	col, ctx, cancel := v.collection(v.ColChartSub, conf.OpAggregate)
+	defer cancel()
+	cursor, err := col.Aggregate(ctx, pipeline)
 	if err != nil {
 		commonlog.Logger.Error("VaultLast",
 			zap.String("GetVault valueLocked", err.Error()),
@@ -221,7 +224,9 @@ func (v *VaultDB) GetLastAll(nowTime *int64, last *vault.Last) error {
 		{{"$limit", 1}},
 	}
 
-	cursor, err = v.ColChart.Aggregate(ctx, pipeline)
+	col, ctx, cancel = v.collection(v.ColChart, conf.OpAggregate)
+	defer cancel()
+	cursor, err = col.Aggregate(ctx, pipeline)
 	if err != nil {
 		commonlog.Logger.Error("VaultLast",
 			zap.String("Aggregate Error:", err.Error()),
@@ -257,8 +262,9 @@ func (v *VaultDB) GetDeposit24h(chainId, address *string) (*primitive.Decimal128
 		bson.D{{"$group", bson.M{"_id": nil, "total": bson.M{"$sum": bson.M{"$toDecimal": "$amount"}}}}},
 	}
 
-	ctx := context.Background()
-	cursor, err := v.ColHistory.Aggregate(ctx, pipeline)
+	col, ctx, cancel := v.collection(v.ColHistory, conf.OpAggregate)
+	defer cancel()
+	cursor, err := col.Aggregate(ctx, pipeline)
 	if err != nil {
 		return nil, err
 	}
@@ -292,8 +298,9 @@ func (v *VaultDB) GetWithdraw24h(chainId, address *string) (*primitive.Decimal12
 		bson.D{{"$group", bson.M{"_id": nil, "total": bson.M{"$sum": bson.M{"$toDecimal": "$quantity"}}}}},
 	}
 
-	ctx := context.Background()
-	cursor, err := v.ColHistory.Aggregate(ctx, pipeline)
+	col, ctx, cancel := v.collection(v.ColHistory, conf.OpAggregate)
+	defer cancel()
+	cursor, err := col.Aggregate(ctx, pipeline)
 	if err != nil {
 		return nil, err
 	}
@@ -327,8 +334,9 @@ func (v *VaultDB) GetMint24h(chainId, address *string) (*primitive.Decimal128, e
 		bson.D{{"$group", bson.M{"_id": nil, "total": bson.M{"$sum": bson.M{"$toDecimal": "$quantity"}}}}},
 	}
 
-	ctx := context.Background()
-	cursor, err := v.ColHistory.Aggregate(ctx, pipeline)
+	col, ctx, cancel := v.collection(v.ColHistory, conf.OpAggregate)
+	defer cancel()
+	cursor, err := col.Aggregate(ctx, pipeline)
 	if err != nil {
 		return nil, err
 	}
@@ -362,8 +370,9 @@ func (v *VaultDB) GetBurn24h(chainId, address *string) (*primitive.Decimal128, e
 		bson.D{{"$group", bson.M{"_id": nil, "total": bson.M{"$sum": bson.M{"$toDecimal": "$quantity"}}}}},
 	}
 
-	ctx := context.Background()
-	cursor, err := v.ColHistory.Aggregate(ctx, pipeline)
+	col, ctx, cancel := v.collection(v.ColHistory, conf.OpAggregate)
+	defer cancel()
+	cursor, err := col.Aggregate(ctx, pipeline)
 	if err != nil {
 		return nil, err
 	}
@@ -397,8 +406,9 @@ func (v *VaultDB) GetRate24hAgo(chainId, address *string) (*primitive.Decimal128
 		{{"$limit", 1}},
 	}
 
-	ctx := context.Background()
-	cursor, err := v.ColChart.Aggregate(ctx, pipeline)
+	col, ctx, cancel := v.collection(v.ColChart, conf.OpAggregate)
+	defer cancel()
+	cursor, err := col.Aggregate(ctx, pipeline)
 	if err != nil {
 		return nil, err
 	}
@@ -431,8 +441,9 @@ func (v *VaultDB) GetLocked24hAgo(chainId, address *string) (*primitive.Decimal1
 		{{"$limit", 1}},
 	}
 
-	ctx := context.Background()
-	cursor, err := v.ColChartSub.Aggregate(ctx, pipeline)
+	col, ctx, cancel := v.collection(v.ColChartSub, conf.OpAggregate)
+	defer cancel()
+	cursor, err := col.Aggregate(ctx, pipeline)
 	if err != nil {
 		return nil, err
 	}
@@ -465,8 +476,9 @@ func (v *VaultDB) GetWeight24hAgo(chainId, address *string) (*primitive.Decimal1
 		{{"$limit", 1}},
 	}
 
-	ctx := context.Background()
-	cursor, err := v.ColChartSub.Aggregate(ctx, pipeline)
+	col, ctx, cancel := v.collection(v.ColChartSub, conf.OpAggregate)
+	defer cancel()
+	cursor, err := col.Aggregate(ctx, pipeline)
 	if err != nil {
 		return nil, err
 	}
@@ -500,8 +512,9 @@ func (v *VaultDB) GetValueLocked24hAgo(chainId, address *string) (*primitive.Dec
 		{{"$limit", 1}},
 	}
 
-	ctx := context.Background()
-	cursor, err := v.ColChartSub.Aggregate(ctx, pipeline)
+	col, ctx, cancel := v.collection(v.ColChartSub, conf.OpAggregate)
+	defer cancel()
+	cursor, err := col.Aggregate(ctx, pipeline)
 	if err != nil {
 		return nil, err
 	}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"errors"
 
+	"github.com/coinmeca/db-connector/conf"
 	"github.com/coinmeca/go-common/commonlog"
 	"github.com/coinmeca/go-common/commonmethod/vault"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.uber.org/zap"
 )
@@ -14,8 +16,10 @@ func (v *VaultDB) SaveVaultRecent(recent *vault.Recent) error {
 	filter, update := v.BsonForVaultRecent(recent)
 	option := options.Update().SetUpsert(true)
 
-	result, err := v.ColHistory.UpdateOne(
-		context.Background(),
+	col, ctx, cancel := v.collection(v.ColHistory, conf.OpHistoryWrite)
+	defer cancel()
+	result, err := col.UpdateOne(
+		ctx,
 		filter,
 		update,
 		option,
@@ -31,3 +35,25 @@ func (v *VaultDB) SaveVaultRecent(recent *vault.Recent) error {
 	}
 	return nil
 }
+
+// RollbackTxs removes the history of chainId recorded for the transactions of
+// txHashes, orphaned by a reorganization.
+func (v *VaultDB) RollbackTxs(ctx context.Context, chainId string, txHashes []string) (int64, error) {
+	filter := bson.M{
+		"chainId": chainId,
+		"txHash":  bson.M{"$in": txHashes},
+	}
+
+	col, opCtx, cancel := v.collection(v.ColHistory, conf.OpHistoryWrite)
+	defer cancel()
+	defer context.AfterFunc(ctx, cancel)()
+	result, err := col.DeleteMany(opCtx, filter)
+	if err != nil {
+		commonlog.Logger.Error("RollbackTxs",
+			zap.String("chainId", chainId),
+			zap.String("error", err.Error()),
+		)
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
@@ -1,9 +1,9 @@
 ﻿package vaultdb
 
 import (
-	"context"
 	"strings"
 
+	"github.com/coinmeca/db-connector/conf"
 	"github.com/coinmeca/go-common/commonlog"
 	"github.com/coinmeca/go-common/commonmethod/vault"
 	"go.mongodb.org/mongo-driver/bson"
@@ -26,7 +26,9 @@ func (v *VaultDB) UpdateVaultDepositAmount(chainId, address string, amount primi
 
 	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
 	var updatedVault vault.Vault
-	err := v.ColVault.FindOneAndUpdate(context.Background(), filter, update, opts).Decode(&updatedVault)
+	col, ctx, cancel := v.collection(v.ColVault, conf.OpInfoWrite)
+	defer cancel()
+	err := col.FindOneAndUpdate(ctx, filter, update, opts).Decode(&updatedVault)
 	if err != nil {
 		commonlog.Logger.Error("UpdateVaultDepositAmount",
 			zap.String("FindOneAndUpdate", err.Error()),
@@ -51,7 +53,9 @@ func (v *VaultDB) UpdateVaultWithdrawAmount(chainId, address string, amount prim
 
 	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
 	var updatedVault vault.Vault
-	err := v.ColVault.FindOneAndUpdate(context.Background(), filter, update, opts).Decode(&updatedVault)
+	col, ctx, cancel := v.collection(v.ColVault, conf.OpInfoWrite)
+	defer cancel()
+	err := col.FindOneAndUpdate(ctx, filter, update, opts).Decode(&updatedVault)
 	if err != nil {
 		commonlog.Logger.Error("UpdateVaultWithdrawAmount",
 			zap.String("FindOneAndUpdate", err.Error()),
@@ -1,10 +1,10 @@
 ﻿package vaultdb
 
 import (
-	"context"
 	"fmt"
 	"strings"
 
+	"github.com/coinmeca/db-connector/conf"
 	"github.com/coinmeca/go-common/commonlog"
 	"github.com/coinmeca/go-common/commonmethod/vault"
 	"go.mongodb.org/mongo-driver/bson"
@@ -18,7 +18,9 @@ func (v *VaultDB) SaveValue(chainId, address *string, value *primitive.Decimal12
 	filter, update := v.BsonForValue(chainId, address, value)
 	opts := options.Update().SetUpsert(false)
 
-	_, err := v.ColVault.UpdateOne(context.Background(), filter, update, opts)
+	col, ctx, cancel := v.collection(v.ColVault, conf.OpInfoWrite)
+	defer cancel()
+	_, err := col.UpdateOne(ctx, filter, update, opts)
 	if err != nil {
 		return err
 	}
@@ -29,7 +31,9 @@ func (v *VaultDB) SaveValue(chainId, address *string, value *primitive.Decimal12
 func (v *VaultDB) GetValue(chainId, address *string) *primitive.Decimal128 {
 	filter := bson.M{"chainId": chainId, "address": strings.ToLower(*address)}
 	var vault *vault.Vault
-	if err := v.ColVault.FindOne(context.Background(), filter, nil).Decode(&vault); err != nil {
+	col, ctx, cancel := v.collection(v.ColVault, conf.OpInfoRead)
+	defer cancel()
+	if err := col.FindOne(ctx, filter, nil).Decode(&vault); err != nil {
 		return nil
 	} else {
 		return &vault.Value
@@ -39,7 +43,9 @@ func (v *VaultDB) GetValue(chainId, address *string) *primitive.Decimal128 {
 func (v *VaultDB) GetValueAtTime(time *int64, chainId *string, address *string) *primitive.Decimal128 {
 	pipeline := v.BsonForValueAtTime(time, *chainId, *address)
 
-	cursor, err := v.ColChartSub.Aggregate(context.Background(), pipeline)
+	col, ctx, cancel := v.collection(v.ColChartSub, conf.OpAggregate)
+	defer cancel()
+	cursor, err := col.Aggregate(ctx, pipeline)
 	if err != nil {
 		commonlog.Logger.Error(
 			"GetValueAtTime",
@@ -47,13 +53,13 @@ func (v *VaultDB) GetValueAtTime(time *int64, chainId *string, address *string)
 		)
 		return nil
 	}
-	defer cursor.Close(context.Background())
+	defer cursor.Close(ctx)
 
 	var result struct {
 		Value *primitive.Decimal128 `bson:"value"`
 	}
 
-	if cursor.Next(context.Background()) {
+	if cursor.Next(ctx) {
 		if err := cursor.Decode(&result); err != nil {
 			commonlog.Logger.Error(
 				"GetValueAtTime",
@@ -77,7 +83,9 @@ func (v *VaultDB) GetValueAtTime(time *int64, chainId *string, address *string)
 
 func (v *VaultDB) GetValuesAtTime(time *int64, chainId *string, addresses []string) map[string]*primitive.Decimal128 {
 	pipeline := v.BsonForValuesAtTime(time, *chainId, addresses)
-	cursor, err := v.ColChartSub.Aggregate(context.Background(), pipeline)
+	col, ctx, cancel := v.collection(v.ColChartSub, conf.OpAggregate)
+	defer cancel()
+	cursor, err := col.Aggregate(ctx, pipeline)
 
 	if err != nil {
 		commonlog.Logger.Error(
@@ -86,11 +94,11 @@ func (v *VaultDB) GetValuesAtTime(time *int64, chainId *string, addresses []stri
 		)
 		return nil
 	}
-	defer cursor.Close(context.Background())
+	defer cursor.Close(ctx)
 
 	result := make(map[string]*primitive.Decimal128)
 
-	for cursor.Next(context.Background()) {
+	for cursor.Next(ctx) {
 		var docs bson.M
 		if err := cursor.Decode(&docs); err != nil {
 			commonlog.Logger.Error(
@@ -19,6 +19,7 @@ type VaultDB struct {
 	config *conf.Config
 
 	client      *mongo.Client
+	release     func(ctx context.Context) error
 	ColVault    *mongo.Collection
 	ColChart    *mongo.Collection
 	ColChartSub *mongo.Collection
@@ -30,7 +31,7 @@ type VaultDB struct {
 type VaultDBInterface interface {
 	// query
 	BsonForChart(chart *vault.Chart, interval *int64) (bson.M, bson.M)
-	BsonForChartByIntervals(chart *vault.Chart) *[]bson.M
+	BsonForChartByIntervals(chart *vault.Chart) []bson.M
 	BsonForChartPrice(chart *vault.Chart, interval *int64) (bson.M, bson.M)
 	BsonForChartSub(chart *vault.ChartSub) (bson.M, bson.M)
 	BsonForChartSubAtTime(time *int64, chainId string, address string) mongo.Pipeline
@@ -73,6 +74,8 @@ type VaultDBInterface interface {
 	GetLastAll(nowTime *int64, last *vault.Last) error
 
 	// setter
+	RollbackCharts(ctx context.Context, chainId string, since int64) (int64, error)
+	RollbackTxs(ctx context.Context, chainId string, txHashes []string) (int64, error)
 	SaveChart(t *vault.Chart, interval int64) error
 	SaveChartByIntervals(t *vault.Chart) error
 	SaveChartFromModel(models *[]mongo.WriteModel, exchange *primitive.Decimal128, t *vault.Chart, interval int64)
@@ -90,35 +93,43 @@ type VaultDBInterface interface {
 	UpdateVaultWithdrawAmount(chainId string, address string, amount primitive.Decimal128) error
 
 	Start() error
+	Close(ctx context.Context) error
 }
 
-func NewDB(config *conf.Config) (commondatabase.IRepository, error) {
-	r := &VaultDB{
-		config: config,
-		start:  make(chan struct{}),
-	}
+var _ VaultDBInterface = (*VaultDB)(nil)
 
-	var err error
-	credential := options.Credential{
-		Username: r.config.Repositories["vaultDB"]["username"].(string),
-		Password: r.config.Repositories["vaultDB"]["pass"].(string),
+// NewDB connects a client of its own for [Repositories.vaultDB], which Close
+// disconnects.
+func NewDB(config *conf.Config) (commondatabase.IRepository, error) {
+	client, err := config.Connect(context.Background(), "vaultDB")
+	if err != nil {
+		return nil, err
 	}
 
-	clientOptions := options.Client().ApplyURI(config.Repositories["vaultDB"]["datasource"].(string)).SetAuth(credential)
-	if r.client, err = mongo.Connect(context.Background(), clientOptions); err != nil {
+	r, err := NewDBWithClient(config, client, client.Disconnect)
+	if err != nil {
+		client.Disconnect(context.Background())
 		return nil, err
 	}
+	return r, nil
+}
 
-	if err = r.client.Ping(context.Background(), nil); err == nil {
-		db := r.client.Database(config.Repositories["vaultDB"]["db"].(string))
-		r.ColVault = db.Collection("vault")
-		r.ColChart = db.Collection("chart")
-		r.ColChartSub = db.Collection("chart_sub")
-		r.ColHistory = db.Collection("history")
-	} else {
-		return nil, err
+// NewDBWithClient builds the repository on a client shared with other
+// repositories. Close calls release instead of disconnecting the client.
+func NewDBWithClient(config *conf.Config, client *mongo.Client, release func(ctx context.Context) error) (commondatabase.IRepository, error) {
+	r := &VaultDB{
+		config:  config,
+		client:  client,
+		release: release,
+		start:   make(chan struct{}),
 	}
 
+	db := r.client.Database(config.Repositories["vaultDB"].DB, config.Repositories["vaultDB"].DatabaseOptions())
+	r.ColVault = db.Collection("vault")
+	r.ColChart = db.Collection("chart")
+	r.ColChartSub = db.Collection("chart_sub")
+	r.ColHistory = db.Collection("history")
+
 	if err := vaultIndex(r.ColVault); err != nil {
 		return nil, err
 	}
@@ -149,6 +160,17 @@ func (v *VaultDB) Start() error {
 	}()
 }
 
+// Close releases the client of the repository.
+func (v *VaultDB) Close(ctx context.Context) error {
+	return v.release(ctx)
+}
+
+// collection returns col tuned for an operation class of
+// [Repositories.vaultDB.operations] and the context to run the operation with.
+func (v *VaultDB) collection(col *mongo.Collection, class string) (*mongo.Collection, context.Context, context.CancelFunc) {
+	return v.config.Repositories["vaultDB"].Collection(col, class)
+}
+
 func vaultIndex(col *mongo.Collection) error {
 	index := mongo.IndexModel{
 		Keys: bson.D{
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"sync"
+
+	"github.com/coinmeca/db-connector/conf"
+	"github.com/coinmeca/go-common/commonlog"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// ConfigSubscriber is implemented by repositories that apply reloaded
+// settings without a restart.
+type ConfigSubscriber interface {
+	OnConfigChange(event conf.Event)
+}
+
+var (
+	baseLogger     *zap.Logger
+	baseLoggerOnce sync.Once
+)
+
+// Watch subscribes the logger and every repository implementing
+// ConfigSubscriber to the events of w. The caller runs w.
+func (r *Repositories) Watch(w *conf.Watcher) (unsubscribe func()) {
+	return w.Subscribe(func(event conf.Event) {
+		if e, ok := event.(conf.VerbosityChanged); ok {
+			setVerbosity(max(e.Terminal, e.File))
+		}
+
+		r.lock.RLock()
+		subs := make([]ConfigSubscriber, 0)
+		for _, name := range r.order {
+			if sub, ok := r.elems[r.names[name]].Interface().(ConfigSubscriber); ok {
+				subs = append(subs, sub)
+			}
+		}
+		r.lock.RUnlock()
+
+		for _, sub := range subs {
+			sub.OnConfigChange(event)
+		}
+	})
+}
+
+// setVerbosity raises the level of commonlog.Logger to match verbosity:
+// 1 or less logs errors only, 2 warnings, 3 info and 4 or more debug. The
+// logger built by commonlog.InitLog is kept as the base, so the level can be
+// lowered again later. commonlog has a single logger for terminal and file,
+// so the more verbose of both settings applies.
+func setVerbosity(verbosity int) {
+	baseLoggerOnce.Do(func() {
+		baseLogger = commonlog.Logger
+	})
+	if baseLogger == nil {
+		return
+	}
+
+	level := zapcore.DebugLevel
+	switch {
+	case verbosity <= 1:
+		level = zapcore.ErrorLevel
+	case verbosity == 2:
+		level = zapcore.WarnLevel
+	case verbosity == 3:
+		level = zapcore.InfoLevel
+	}
+
+	commonlog.Logger = baseLogger.WithOptions(zap.IncreaseLevel(level))
+	zap.ReplaceGlobals(commonlog.Logger)
+
+	commonlog.Logger.Info("setVerbosity",
+		zap.Int("verbosity", verbosity),
+		zap.String("level", level.String()),
+	)
+}